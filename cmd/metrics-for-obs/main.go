@@ -3,16 +3,24 @@ package main
 import (
 	"flag"
 	"fmt"
+	"net/url"
 	"os"
 	"os/signal"
 	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
 	"syscall"
 	"time"
 
+	"github.com/joepadmiraal/metrics-for-obs/internal/metric"
 	"github.com/joepadmiraal/metrics-for-obs/internal/monitor"
+	"github.com/joepadmiraal/metrics-for-obs/internal/writer"
 	"golang.org/x/term"
 )
 
+var pingTargetName = regexp.MustCompile(`^[a-z][a-z0-9_]*$`)
+
 var (
 	version = "dev"
 	commit  = "none"
@@ -26,8 +34,31 @@ func main() {
 	port := flag.String("port", "4455", "OBS WebSocket port")
 	defaultCSVFile := fmt.Sprintf("metrics-for-obs-%s.csv", time.Now().Format("2006-01-02-15-04-05"))
 	csvFile := flag.String("csv", defaultCSVFile, "Optional CSV file to write metrics to")
+	jsonlFile := flag.String("jsonl", "", "Optional JSON Lines file to write metrics to")
+	sqliteFile := flag.String("sqlite", "", "Optional SQLite database to store sessions and metrics in, reused across runs")
+	eventsFile := flag.String("events", "", "Optional JSON Lines file to log OBS events such as scene switches to")
+	prometheusAddr := flag.String("prometheus", "", "Optional listen address for a Prometheus /metrics endpoint, e.g. :9464")
+	influxURL := flag.String("influx-url", "", "Optional InfluxDB URL, http(s)://host:8086 for the v2 write API or udp://host:8089")
+	influxOrg := flag.String("influx-org", "", "InfluxDB organization")
+	influxBucket := flag.String("influx-bucket", "", "InfluxDB bucket")
+	influxToken := flag.String("influx-token", "", "InfluxDB API token")
+	influxBatchSize := flag.Int("influx-batch-size", 10, "Number of rows sent to InfluxDB per request")
+	otlpEndpoint := flag.String("otlp-endpoint", "", "Optional OpenTelemetry collector OTLP/HTTP endpoint, e.g. http://localhost:4318")
+	otlpHeaders := flag.String("otlp-headers", "", "Comma separated key=value headers sent with every OTLP export")
+	statsdAddr := flag.String("statsd", "", "Optional StatsD agent address, e.g. localhost:8125")
+	statsdPrefix := flag.String("statsd-prefix", "metrics_for_obs", "Prefix of the StatsD metric names")
+	dogStatsD := flag.Bool("dogstatsd", false, "Add DogStatsD tags to the StatsD metrics")
+	statsdTags := flag.String("statsd-tags", "", "Comma separated key:value DogStatsD tags added to every StatsD metric")
+	pingTargets := flag.String("ping-targets", "google=google.com", "Comma separated name=host targets pinged next to the stream server, each reported as <name>_rtt_ms. Use name=tcp://host:port, name=rtmp://host:port or name=rtmps://host:port to probe the TCP connect or RTMP handshake instead")
+	obsProbe := flag.String("obs-probe", "icmp", "How the stream server is probed: icmp, tcp or rtmp. The TCP and RTMP probes use the port and protocol of the stream server URL")
 	metricIntervalMs := flag.Int("metric-interval", 1000, "Metric collection interval in milliseconds (default 1000ms)")
 	writerIntervalMs := flag.Int("writer-interval", 1000, "Writer interval in milliseconds (default 1000ms)")
+	silenceThreshold := flag.Float64("silence-threshold", metric.DefaultSilenceThreshold, "Level in dBFS below which an audio input counts as silent")
+	silenceDuration := flag.Int("silence-duration", int(metric.DefaultSilenceDuration/time.Second), "Seconds an audio input has to stay below the silence threshold to be flagged")
+	lowBitrateFraction := flag.Float64("low-bitrate-fraction", metric.DefaultLowBitrateFraction, "Share of the configured bitrate below which the stream bitrate counts as low")
+	lowBitrateDuration := flag.Int("low-bitrate-duration", int(metric.DefaultLowBitrateDuration/time.Second), "Seconds the stream bitrate has to stay low to be flagged")
+	wait := flag.Bool("wait", false, "Keep retrying until OBS accepts the connection instead of exiting")
+	waitTimeout := flag.Int("wait-timeout", 0, "Maximum time to wait for OBS in seconds when -wait is set, 0 waits forever")
 	flag.Parse()
 
 	if *versionFlag {
@@ -38,6 +69,36 @@ func main() {
 	}
 
 	csvFilePath := resolveCsvPath(*csvFile)
+	jsonlFilePath := ""
+	if *jsonlFile != "" {
+		jsonlFilePath = resolveCsvPath(*jsonlFile)
+	}
+	sqliteFilePath := ""
+	if *sqliteFile != "" {
+		sqliteFilePath = resolveCsvPath(*sqliteFile)
+	}
+
+	eventsFilePath := ""
+	if *eventsFile != "" {
+		eventsFilePath = resolveCsvPath(*eventsFile)
+	}
+
+	headers, err := parseHeaders(*otlpHeaders)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	targets, err := parsePingTargets(*pingTargets)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	obsProbeType, err := parseProbe(*obsProbe)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
 
 	if *password == "" {
 		fmt.Print("Enter OBS WebSocket password: ")
@@ -59,8 +120,37 @@ func main() {
 		Host:           fmt.Sprintf("%s:%s", *host, *port),
 		Password:       *password,
 		CSVFile:        csvFilePath,
-		MetricInterval: *metricIntervalMs,
-		WriterInterval: *writerIntervalMs,
+		JSONLFile:      jsonlFilePath,
+		SQLiteFile:     sqliteFilePath,
+		EventsFile:     eventsFilePath,
+		PrometheusAddr: *prometheusAddr,
+		Influx: writer.InfluxConfig{
+			URL:       *influxURL,
+			Org:       *influxOrg,
+			Bucket:    *influxBucket,
+			Token:     *influxToken,
+			BatchSize: *influxBatchSize,
+		},
+		OTLP: writer.OTLPConfig{
+			Endpoint: *otlpEndpoint,
+			Headers:  headers,
+		},
+		StatsD: writer.StatsDConfig{
+			Addr:      *statsdAddr,
+			Prefix:    *statsdPrefix,
+			DogStatsD: *dogStatsD || *statsdTags != "",
+			Tags:      splitList(*statsdTags),
+		},
+		PingTargets:        targets,
+		ObsProbe:           obsProbeType,
+		MetricInterval:     *metricIntervalMs,
+		WriterInterval:     *writerIntervalMs,
+		SilenceThreshold:   *silenceThreshold,
+		SilenceDuration:    *silenceDuration,
+		LowBitrateFraction: *lowBitrateFraction,
+		LowBitrateDuration: *lowBitrateDuration,
+		Wait:               *wait,
+		WaitTimeout:        *waitTimeout,
 	})
 	if err != nil {
 		panic(err)
@@ -91,6 +181,93 @@ func waitForExit(mon *monitor.Monitor) {
 	}
 }
 
+// parseHeaders parses headers in the OTEL_EXPORTER_OTLP_HEADERS format: key1=value1,key2=value2
+func parseHeaders(s string) (map[string]string, error) {
+	headers := make(map[string]string)
+	if s == "" {
+		return headers, nil
+	}
+
+	for _, pair := range strings.Split(s, ",") {
+		key, value, ok := strings.Cut(pair, "=")
+		if !ok || strings.TrimSpace(key) == "" {
+			return nil, fmt.Errorf("invalid header %q, expected key=value", pair)
+		}
+		headers[strings.TrimSpace(key)] = strings.TrimSpace(value)
+	}
+	return headers, nil
+}
+
+// parsePingTargets parses name=host pairs, an empty value only pings the stream server. The name ends up in
+// a column name, so it is limited to lowercase letters, digits and underscores. A tcp://, rtmp:// or
+// rtmps:// host selects the TCP or RTMP probe.
+func parsePingTargets(s string) ([]metric.PingTarget, error) {
+	targets := []metric.PingTarget{}
+	used := map[string]bool{"obs": true}
+	for _, pair := range splitList(s) {
+		name, host, ok := strings.Cut(pair, "=")
+		name, host = strings.TrimSpace(name), strings.TrimSpace(host)
+		if !ok || name == "" || host == "" {
+			return nil, fmt.Errorf("invalid ping target %q, expected name=host", pair)
+		}
+		target := metric.PingTarget{Name: name, Host: host}
+		if scheme, rest, ok := strings.Cut(host, "://"); ok {
+			probeName := scheme
+			if strings.EqualFold(scheme, "rtmps") {
+				probeName = "rtmp"
+				target.TLS = true
+			}
+			probe, err := parseProbe(probeName)
+			if err != nil || probe == metric.ICMPProbe {
+				return nil, fmt.Errorf("invalid ping target %q, use tcp://, rtmp:// or rtmps:// to select a probe", pair)
+			}
+			u, err := url.Parse("//" + rest)
+			if err != nil || u.Hostname() == "" {
+				return nil, fmt.Errorf("invalid ping target %q, expected %s://host:port", pair, scheme)
+			}
+			target.Probe = probe
+			target.Host = u.Hostname()
+			if u.Port() != "" {
+				if target.Port, err = strconv.Atoi(u.Port()); err != nil {
+					return nil, fmt.Errorf("invalid port in ping target %q", pair)
+				}
+			}
+		}
+		if !pingTargetName.MatchString(name) {
+			return nil, fmt.Errorf("invalid ping target name %q, use lowercase letters, digits and underscores", name)
+		}
+		if used[name] {
+			return nil, fmt.Errorf("ping target name %q is already used", name)
+		}
+		used[name] = true
+		targets = append(targets, target)
+	}
+	return targets, nil
+}
+
+func parseProbe(s string) (metric.Probe, error) {
+	switch strings.ToLower(s) {
+	case "icmp":
+		return metric.ICMPProbe, nil
+	case "tcp":
+		return metric.TCPProbe, nil
+	case "rtmp":
+		return metric.RTMPProbe, nil
+	}
+	return 0, fmt.Errorf("unknown probe %q, expected icmp, tcp or rtmp", s)
+}
+
+// splitList splits a comma separated flag value and drops empty entries
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
 func resolveCsvPath(csvFile string) string {
 	if filepath.IsAbs(csvFile) {
 		return csvFile
@@ -0,0 +1,201 @@
+package metric
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/andreykaipov/goobs"
+	"github.com/andreykaipov/goobs/api/events"
+	"github.com/andreykaipov/goobs/api/requests/inputs"
+)
+
+const (
+	// DefaultSilenceThreshold is the level in dBFS below which an input counts as silent
+	DefaultSilenceThreshold = -60.0
+	// DefaultSilenceDuration is how long an input has to stay below the threshold to be flagged
+	DefaultSilenceDuration = 10 * time.Second
+	// clippingThreshold is the peak level in dBFS that counts as clipping
+	clippingThreshold = -0.1
+	// minDBFS is reported for digital silence, which would otherwise be -Inf
+	minDBFS = -100.0
+)
+
+// audioInput holds the levels of one input within the current interval
+type audioInput struct {
+	name         string
+	measured     bool
+	maxPeak      float64
+	sumMagnitude float64
+	meters       int
+	quietSince   time.Time
+	silent       bool
+	clipping     bool
+}
+
+// AudioLevels records the peak and magnitude of every audio input from the InputVolumeMeters events
+// OBS sends every 50ms, and flags inputs that went silent or clipped. Only the inputs with audio that
+// existed at startup get columns.
+type AudioLevels struct {
+	client           *goobs.Client
+	inputs           []*audioInput
+	byName           map[string]*audioInput
+	fields           []Field
+	silenceThreshold float64
+	silenceDuration  time.Duration
+	mu               sync.Mutex
+}
+
+// NewAudioLevels finds the inputs with audio, zero values for the threshold and duration select the defaults
+func NewAudioLevels(client *goobs.Client, silenceThreshold float64, silenceDuration time.Duration) (*AudioLevels, error) {
+	var names []string
+	if client != nil {
+		list, err := client.Inputs.GetInputList()
+		if err != nil {
+			return nil, fmt.Errorf("failed to list inputs: %w", err)
+		}
+		for _, input := range list.Inputs {
+			// OBS rejects the request for inputs without audio, such as a browser source
+			if _, err := client.Inputs.GetInputVolume(&inputs.GetInputVolumeParams{InputName: &input.InputName}); err == nil {
+				names = append(names, input.InputName)
+			}
+		}
+	}
+
+	return newAudioLevels(client, names, silenceThreshold, silenceDuration), nil
+}
+
+func newAudioLevels(client *goobs.Client, names []string, silenceThreshold float64, silenceDuration time.Duration) *AudioLevels {
+	if silenceThreshold == 0 {
+		silenceThreshold = DefaultSilenceThreshold
+	}
+	if silenceDuration == 0 {
+		silenceDuration = DefaultSilenceDuration
+	}
+
+	a := &AudioLevels{
+		client:           client,
+		silenceThreshold: silenceThreshold,
+		silenceDuration:  silenceDuration,
+		byName:           make(map[string]*audioInput, len(names)),
+	}
+	for i, column := range columnNames("audio", names) {
+		in := &audioInput{name: names[i]}
+		a.inputs = append(a.inputs, in)
+		a.byName[in.name] = in
+		a.fields = append(a.fields,
+			Field{Name: column + "_peak_dbfs", Type: FloatValue, Kind: Gauge, Precision: 1},
+			Field{Name: column + "_magnitude_dbfs", Type: FloatValue, Kind: Gauge, Precision: 1},
+			Field{Name: column + "_silent", Type: BoolValue, Kind: Gauge},
+			Field{Name: column + "_clipping", Type: BoolValue, Kind: Gauge},
+		)
+	}
+	return a
+}
+
+func (a *AudioLevels) Name() string {
+	return "audio"
+}
+
+func (a *AudioLevels) Fields() []Field {
+	return a.fields
+}
+
+// Start has nothing to poll, the monitor hands the InputVolumeMeters events to Update
+func (a *AudioLevels) Start(ctx context.Context) error {
+	<-ctx.Done()
+	return nil
+}
+
+// Update applies an InputVolumeMeters event received at the given time. Every input carries a
+// magnitude, peak and input peak per channel as a multiplier, the loudest channel counts.
+func (a *AudioLevels) Update(meters *events.InputVolumeMeters, received time.Time) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.client == nil {
+		return
+	}
+
+	for _, meter := range meters.Inputs {
+		in, ok := a.byName[meter.Name]
+		if !ok {
+			continue
+		}
+
+		var magnitude, peak float64
+		for _, channel := range meter.Levels {
+			magnitude = max(magnitude, channel[0])
+			peak = max(peak, channel[1])
+		}
+		peakDBFS := toDBFS(peak)
+
+		if !in.measured || peakDBFS > in.maxPeak {
+			in.maxPeak = peakDBFS
+		}
+		in.sumMagnitude += magnitude
+		in.meters++
+		in.measured = true
+
+		if peakDBFS >= clippingThreshold {
+			in.clipping = true
+		}
+		if peakDBFS >= a.silenceThreshold {
+			in.quietSince = time.Time{}
+		} else if in.quietSince.IsZero() {
+			in.quietSince = received
+		}
+		if !in.quietSince.IsZero() && received.Sub(in.quietSince) >= a.silenceDuration {
+			in.silent = true
+		}
+	}
+}
+
+// toDBFS converts a level multiplier to dBFS, limited to minDBFS for silence
+func toDBFS(mul float64) float64 {
+	if mul <= 0 {
+		return minDBFS
+	}
+	return max(20*math.Log10(mul), minDBFS)
+}
+
+// Collect returns the highest peak, the average magnitude and the silence and clipping flags of every
+// input. Inputs OBS didn't report in the interval, such as hidden sources, have no values.
+func (a *AudioLevels) Collect() ([]Sample, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	var samples []Sample
+	for i, in := range a.inputs {
+		if !in.measured {
+			continue
+		}
+		fields := a.fields[i*4:]
+		samples = append(samples,
+			Sample{Field: fields[0], Value: in.maxPeak},
+			Sample{Field: fields[1], Value: toDBFS(in.sumMagnitude / float64(in.meters))},
+			Sample{Field: fields[2], Value: in.silent},
+			Sample{Field: fields[3], Value: in.clipping},
+		)
+
+		in.measured = false
+		in.sumMagnitude = 0
+		in.meters = 0
+		in.clipping = false
+		in.silent = false
+	}
+	return samples, nil
+}
+
+// SetClient binds a new OBS connection, a nil client stops the reporting until OBS is back
+func (a *AudioLevels) SetClient(client *goobs.Client) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.client = client
+	for _, in := range a.inputs {
+		*in = audioInput{name: in.name}
+	}
+}
@@ -0,0 +1,121 @@
+package metric
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/andreykaipov/goobs"
+	"github.com/andreykaipov/goobs/api/events"
+	"github.com/andreykaipov/goobs/api/typedefs"
+)
+
+func volumeMeters(name string, levels ...[3]float64) *events.InputVolumeMeters {
+	return &events.InputVolumeMeters{Inputs: []*typedefs.InputVolumeMeter{{Name: name, Levels: levels}}}
+}
+
+func TestToDBFS(t *testing.T) {
+	tests := []struct {
+		mul      float64
+		expected float64
+	}{
+		{mul: 1, expected: 0},
+		{mul: 0.1, expected: -20},
+		{mul: 0, expected: minDBFS},
+		{mul: 1e-9, expected: minDBFS},
+	}
+
+	for _, tt := range tests {
+		if got := toDBFS(tt.mul); math.Abs(got-tt.expected) > 1e-9 {
+			t.Errorf("Expected %v dBFS for %v, got %v", tt.expected, tt.mul, got)
+		}
+	}
+}
+
+func TestAudioLevels_Collect_PeakAndMagnitude(t *testing.T) {
+	a := newAudioLevels(&goobs.Client{}, []string{"Mic/Aux", "Desktop Audio"}, 0, 0)
+	now := time.Now()
+
+	// The loudest channel counts
+	a.Update(volumeMeters("Mic/Aux", [3]float64{0.01, 0.1, 0.1}, [3]float64{0.1, 0.5, 0.5}), now)
+	a.Update(volumeMeters("Mic/Aux", [3]float64{0.1, 0.2, 0.2}), now.Add(50*time.Millisecond))
+
+	samples, err := a.Collect()
+	if err != nil {
+		t.Fatalf("Collect returned error: %v", err)
+	}
+
+	if v := valueOf(t, samples, "audio_mic_aux_peak_dbfs").(float64); math.Abs(v-toDBFS(0.5)) > 1e-9 {
+		t.Errorf("Expected the highest peak, got %v", v)
+	}
+	if v := valueOf(t, samples, "audio_mic_aux_magnitude_dbfs").(float64); math.Abs(v-(-20)) > 1e-9 {
+		t.Errorf("Expected the average magnitude of -20 dBFS, got %v", v)
+	}
+	if v := valueOf(t, samples, "audio_mic_aux_silent"); v != false {
+		t.Errorf("Expected audio_mic_aux_silent to be false, got %v", v)
+	}
+	if v := valueOf(t, samples, "audio_mic_aux_clipping"); v != false {
+		t.Errorf("Expected audio_mic_aux_clipping to be false, got %v", v)
+	}
+	for _, s := range samples {
+		if s.Name == "audio_desktop_audio_peak_dbfs" {
+			t.Errorf("Expected no values for an input OBS didn't report, got %v", s.Value)
+		}
+	}
+}
+
+func TestAudioLevels_Update_Silence(t *testing.T) {
+	a := newAudioLevels(&goobs.Client{}, []string{"Mic/Aux"}, -50, 2*time.Second)
+	start := time.Now()
+
+	tests := []struct {
+		name     string
+		after    time.Duration
+		peak     float64
+		expected bool
+	}{
+		{name: "quiet for a moment", after: 0, peak: 0.001, expected: false},
+		{name: "quiet just below the duration", after: 1900 * time.Millisecond, peak: 0.001, expected: false},
+		{name: "quiet for the whole duration", after: 2 * time.Second, peak: 0, expected: true},
+		{name: "sound again", after: 2100 * time.Millisecond, peak: 0.1, expected: false},
+		{name: "quiet again", after: 3 * time.Second, peak: 0.001, expected: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a.Update(volumeMeters("Mic/Aux", [3]float64{tt.peak, tt.peak, tt.peak}), start.Add(tt.after))
+			samples, _ := a.Collect()
+			if v := valueOf(t, samples, "audio_mic_aux_silent"); v != tt.expected {
+				t.Errorf("Expected audio_mic_aux_silent to be %v, got %v", tt.expected, v)
+			}
+		})
+	}
+}
+
+func TestAudioLevels_Update_Clipping(t *testing.T) {
+	a := newAudioLevels(&goobs.Client{}, []string{"Mic/Aux"}, 0, 0)
+
+	a.Update(volumeMeters("Mic/Aux", [3]float64{0.7, 1.0, 1.0}), time.Now())
+	samples, _ := a.Collect()
+	if v := valueOf(t, samples, "audio_mic_aux_clipping"); v != true {
+		t.Errorf("Expected a full scale peak to be clipping, got %v", v)
+	}
+
+	a.Update(volumeMeters("Mic/Aux", [3]float64{0.3, 0.5, 0.5}), time.Now())
+	samples, _ = a.Collect()
+	if v := valueOf(t, samples, "audio_mic_aux_clipping"); v != false {
+		t.Errorf("Expected clipping to be reset in the next interval, got %v", v)
+	}
+}
+
+func TestAudioLevels_SetClient_Detached(t *testing.T) {
+	a := newAudioLevels(&goobs.Client{}, []string{"Mic/Aux"}, 0, 0)
+	a.Update(volumeMeters("Mic/Aux", [3]float64{0.1, 0.2, 0.2}), time.Now())
+
+	a.SetClient(nil)
+	a.Update(volumeMeters("Mic/Aux", [3]float64{0.1, 0.2, 0.2}), time.Now())
+
+	if samples, _ := a.Collect(); len(samples) != 0 {
+		t.Errorf("Expected no samples while detached, got %v", samples)
+	}
+}
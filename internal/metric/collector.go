@@ -0,0 +1,225 @@
+package metric
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/andreykaipov/goobs"
+)
+
+// ValueType describes the Go type stored in Sample.Value
+type ValueType int
+
+const (
+	// FloatValue samples hold a float64
+	FloatValue ValueType = iota
+	// BoolValue samples hold a bool
+	BoolValue
+	// DurationValue samples hold a time.Duration
+	DurationValue
+	// StringValue samples hold a string, only the text based writers export them
+	StringValue
+)
+
+// Kind describes how a sample relates to the interval it was collected in
+type Kind int
+
+const (
+	// Gauge is a point-in-time value, usually the max within the interval
+	Gauge Kind = iota
+	// Counter is the increase of a cumulative value within the interval
+	Counter
+)
+
+// Field describes a single named value produced by a collector
+type Field struct {
+	Name      string
+	Type      ValueType
+	Kind      Kind
+	Precision int
+}
+
+// Sample is the value of a field for one writer interval, Value is nil when no value is available
+type Sample struct {
+	Field
+	Value any
+}
+
+// columnNames turns names chosen in OBS, such as "Replay Buffer", into unique column prefixes such as
+// output_replay_buffer. Names that end up the same get a _2, _3 suffix.
+func columnNames(prefix string, names []string) []string {
+	columns := make([]string, len(names))
+	used := make(map[string]bool)
+	for i, name := range names {
+		var b strings.Builder
+		underscore := false
+		for _, r := range strings.ToLower(name) {
+			if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+				b.WriteRune(r)
+				underscore = false
+			} else if !underscore && b.Len() > 0 {
+				b.WriteByte('_')
+				underscore = true
+			}
+		}
+		base := prefix + "_" + strings.TrimSuffix(b.String(), "_")
+
+		column := base
+		for n := 2; used[column]; n++ {
+			column = fmt.Sprintf("%s_%d", base, n)
+		}
+		used[column] = true
+		columns[i] = column
+	}
+	return columns
+}
+
+// Float64 returns the sample as a number, booleans become 0 or 1 and durations milliseconds. Strings
+// have no numeric value.
+func (s Sample) Float64() (float64, bool) {
+	switch v := s.Value.(type) {
+	case float64:
+		return v, true
+	case bool:
+		if v {
+			return 1, true
+		}
+		return 0, true
+	case time.Duration:
+		return float64(v.Microseconds()) / 1000.0, true
+	}
+	return 0, false
+}
+
+// SourceError is an error reported by the collector with the given name
+type SourceError struct {
+	Source string
+	Err    error
+}
+
+// Collector periodically measures one or more values and hands out the aggregate per writer interval
+type Collector interface {
+	// Name identifies the collector in error reports
+	Name() string
+	// Fields lists the values returned by Collect, in column order
+	Fields() []Field
+	// Start measures until the context is cancelled
+	Start(ctx context.Context) error
+	// Collect returns the aggregated samples since the previous call and resets the aggregation
+	Collect() ([]Sample, error)
+}
+
+// ObsCollector is a collector that queries OBS. After a reconnect the monitor hands it the new
+// client, a nil client means OBS is unreachable and the collector reports no values.
+type ObsCollector interface {
+	Collector
+	SetClient(client *goobs.Client)
+}
+
+// Registry holds the collectors the monitor reads from every writer interval
+type Registry struct {
+	collectors []Collector
+	running    sync.WaitGroup
+	mu         sync.Mutex
+}
+
+// NewRegistry creates an empty collector registry
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// Register adds a collector, its name and field names must be unique
+func (r *Registry) Register(c Collector) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	fieldNames := make(map[string]bool)
+	for _, existing := range r.collectors {
+		if existing.Name() == c.Name() {
+			return fmt.Errorf("collector %q already registered", c.Name())
+		}
+		for _, f := range existing.Fields() {
+			fieldNames[f.Name] = true
+		}
+	}
+	for _, f := range c.Fields() {
+		if fieldNames[f.Name] {
+			return fmt.Errorf("field %q of collector %q already registered", f.Name, c.Name())
+		}
+	}
+
+	r.collectors = append(r.collectors, c)
+	return nil
+}
+
+// Collectors returns the registered collectors in registration order
+func (r *Registry) Collectors() []Collector {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]Collector(nil), r.collectors...)
+}
+
+// Fields returns the fields of all registered collectors in registration order
+func (r *Registry) Fields() []Field {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var fields []Field
+	for _, c := range r.collectors {
+		fields = append(fields, c.Fields()...)
+	}
+	return fields
+}
+
+// Start runs every registered collector in its own goroutine until the context is cancelled
+func (r *Registry) Start(ctx context.Context) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, c := range r.collectors {
+		r.running.Add(1)
+		go func(c Collector) {
+			defer r.running.Done()
+			if err := c.Start(ctx); err != nil {
+				fmt.Printf("%s collector error: %v\n", c.Name(), err)
+			}
+		}(c)
+	}
+}
+
+// Wait blocks until the collectors started by Start returned after their context was cancelled
+func (r *Registry) Wait() {
+	r.running.Wait()
+}
+
+// Collect reads all registered collectors. Every field is always present in the result, so a
+// collector that returns fewer samples than it declared gets nil values for the missing fields.
+func (r *Registry) Collect() ([]Sample, []SourceError) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var samples []Sample
+	var errs []SourceError
+	for _, c := range r.collectors {
+		collected, err := c.Collect()
+		if err != nil {
+			errs = append(errs, SourceError{Source: c.Name(), Err: err})
+		}
+
+		byName := make(map[string]Sample, len(collected))
+		for _, s := range collected {
+			byName[s.Name] = s
+		}
+		for _, f := range c.Fields() {
+			s, ok := byName[f.Name]
+			if !ok {
+				s = Sample{Field: f}
+			}
+			samples = append(samples, s)
+		}
+	}
+	return samples, errs
+}
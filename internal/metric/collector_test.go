@@ -0,0 +1,226 @@
+package metric
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func valueOf(t *testing.T, samples []Sample, name string) any {
+	t.Helper()
+	for _, s := range samples {
+		if s.Name == name {
+			return s.Value
+		}
+	}
+	t.Fatalf("No sample named %s in %v", name, samples)
+	return nil
+}
+
+type fakeCollector struct {
+	name    string
+	fields  []Field
+	samples []Sample
+	err     error
+}
+
+func (c *fakeCollector) Name() string                    { return c.name }
+func (c *fakeCollector) Fields() []Field                 { return c.fields }
+func (c *fakeCollector) Start(ctx context.Context) error { <-ctx.Done(); return nil }
+func (c *fakeCollector) Collect() ([]Sample, error)      { return c.samples, c.err }
+
+func TestSample_Float64(t *testing.T) {
+	tests := []struct {
+		name     string
+		value    any
+		expected float64
+		ok       bool
+	}{
+		{name: "float", value: 12.5, expected: 12.5, ok: true},
+		{name: "true", value: true, expected: 1, ok: true},
+		{name: "false", value: false, expected: 0, ok: true},
+		{name: "duration in milliseconds", value: 1500 * time.Microsecond, expected: 1.5, ok: true},
+		{name: "missing", value: nil, expected: 0, ok: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, ok := Sample{Value: tt.value}.Float64()
+			if ok != tt.ok {
+				t.Errorf("Expected ok %v, got %v", tt.ok, ok)
+			}
+			if f != tt.expected {
+				t.Errorf("Expected %f, got %f", tt.expected, f)
+			}
+		})
+	}
+}
+
+func TestRegistry_Register_RejectsDuplicates(t *testing.T) {
+	r := NewRegistry()
+	field := Field{Name: "value"}
+	if err := r.Register(&fakeCollector{name: "a", fields: []Field{field}}); err != nil {
+		t.Fatalf("Register failed: %v", err)
+	}
+
+	if err := r.Register(&fakeCollector{name: "a"}); err == nil {
+		t.Error("Expected error for duplicate collector name")
+	}
+	if err := r.Register(&fakeCollector{name: "b", fields: []Field{field}}); err == nil {
+		t.Error("Expected error for duplicate field name")
+	}
+	if len(r.Collectors()) != 1 {
+		t.Errorf("Expected 1 collector, got %d", len(r.Collectors()))
+	}
+}
+
+func TestRegistry_Fields_InRegistrationOrder(t *testing.T) {
+	r := NewRegistry()
+	r.Register(&fakeCollector{name: "a", fields: []Field{{Name: "a1"}, {Name: "a2"}}})
+	r.Register(&fakeCollector{name: "b", fields: []Field{{Name: "b1"}}})
+
+	fields := r.Fields()
+
+	expected := []string{"a1", "a2", "b1"}
+	if len(fields) != len(expected) {
+		t.Fatalf("Expected %d fields, got %d", len(expected), len(fields))
+	}
+	for i, name := range expected {
+		if fields[i].Name != name {
+			t.Errorf("Expected field %d to be %s, got %s", i, name, fields[i].Name)
+		}
+	}
+}
+
+func TestRegistry_Collect_FillsMissingSamplesAndErrors(t *testing.T) {
+	testError := fmt.Errorf("collect failed")
+	r := NewRegistry()
+	r.Register(&fakeCollector{
+		name:    "a",
+		fields:  []Field{{Name: "a1"}, {Name: "a2"}},
+		samples: []Sample{{Field: Field{Name: "a2"}, Value: 2.0}},
+	})
+	r.Register(&fakeCollector{
+		name:   "b",
+		fields: []Field{{Name: "b1"}},
+		err:    testError,
+	})
+
+	samples, errs := r.Collect()
+
+	if len(samples) != 3 {
+		t.Fatalf("Expected a sample for every field, got %d", len(samples))
+	}
+	if samples[0].Name != "a1" || samples[0].Value != nil {
+		t.Errorf("Expected missing a1 sample to have a nil value, got %+v", samples[0])
+	}
+	if samples[1].Value != 2.0 {
+		t.Errorf("Expected a2 to be 2.0, got %v", samples[1].Value)
+	}
+	if len(errs) != 1 || errs[0].Source != "b" || errs[0].Err != testError {
+		t.Errorf("Expected a single error from b, got %v", errs)
+	}
+}
+
+func TestRegistry_Start_StopsOnCancel(t *testing.T) {
+	r := NewRegistry()
+	r.Register(&fakeCollector{name: "a"})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	r.Start(ctx)
+	cancel()
+
+	done := make(chan struct{})
+	go func() {
+		r.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Collectors did not stop after cancel")
+	}
+}
+
+func TestRunEvery_StopsOnCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	calls := make(chan struct{}, 10)
+
+	done := make(chan error)
+	go func() {
+		done <- runEvery(ctx, 10*time.Millisecond, func() { calls <- struct{}{} })
+	}()
+
+	<-calls
+	cancel()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Expected nil error, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("runEvery did not stop after cancel")
+	}
+}
+
+func TestCumulativeCounter_Delta(t *testing.T) {
+	tests := []struct {
+		name     string
+		updates  [][]float64
+		expected []float64
+	}{
+		{
+			name:     "no measurements",
+			updates:  [][]float64{nil, nil},
+			expected: []float64{0, 0},
+		},
+		{
+			name:     "first read takes the baseline",
+			updates:  [][]float64{{100}, {130}, {130}},
+			expected: []float64{0, 30, 0},
+		},
+		{
+			name:     "last value of the interval counts",
+			updates:  [][]float64{{100}, {110, 120, 150}},
+			expected: []float64{0, 50},
+		},
+		{
+			name:     "baseline waits for the first measurement",
+			updates:  [][]float64{nil, {100}, {140}},
+			expected: []float64{0, 0, 40},
+		},
+		{
+			name:     "counter reset by OBS",
+			updates:  [][]float64{{100}, {150}, {20}},
+			expected: []float64{0, 50, 20},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var c cumulativeCounter
+			for i, values := range tt.updates {
+				for _, v := range values {
+					c.update(v)
+				}
+				if got := c.delta(); got != tt.expected[i] {
+					t.Errorf("Interval %d: expected delta %v, got %v", i, tt.expected[i], got)
+				}
+			}
+		})
+	}
+}
+
+func TestColumnNames(t *testing.T) {
+	names := []string{"adv_file_output", "Replay Buffer", "  Multi RTMP (YouTube)!", "multi-rtmp youtube"}
+
+	expected := []string{"output_adv_file_output", "output_replay_buffer", "output_multi_rtmp_youtube", "output_multi_rtmp_youtube_2"}
+	got := columnNames("output", names)
+	for i := range expected {
+		if got[i] != expected[i] {
+			t.Errorf("Expected %s for %q, got %s", expected[i], names[i], got[i])
+		}
+	}
+}
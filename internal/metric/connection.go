@@ -0,0 +1,63 @@
+package metric
+
+import (
+	"context"
+	"sync"
+)
+
+var connectionStatusFields = []Field{
+	{Name: "obs_connected", Type: BoolValue, Kind: Gauge},
+}
+
+// ConnectionStatus reports whether the OBS WebSocket connection was up during the whole writer interval
+type ConnectionStatus struct {
+	connected       bool
+	droppedSinceGet bool
+	mu              sync.Mutex
+}
+
+func NewConnectionStatus(connected bool) *ConnectionStatus {
+	return &ConnectionStatus{
+		connected:       connected,
+		droppedSinceGet: !connected,
+	}
+}
+
+func (c *ConnectionStatus) Name() string {
+	return "obs_connection"
+}
+
+func (c *ConnectionStatus) Fields() []Field {
+	return connectionStatusFields
+}
+
+func (c *ConnectionStatus) SetConnected(connected bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.connected = connected
+	if !connected {
+		c.droppedSinceGet = true
+	}
+}
+
+func (c *ConnectionStatus) Connected() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.connected
+}
+
+func (c *ConnectionStatus) Start(ctx context.Context) error {
+	<-ctx.Done()
+	return nil
+}
+
+func (c *ConnectionStatus) Collect() ([]Sample, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	connected := c.connected && !c.droppedSinceGet
+	c.droppedSinceGet = !c.connected
+
+	return []Sample{{Field: connectionStatusFields[0], Value: connected}}, nil
+}
@@ -0,0 +1,68 @@
+package metric
+
+import "testing"
+
+func TestConnectionStatus_Collect(t *testing.T) {
+	tests := []struct {
+		name     string
+		initial  bool
+		changes  []bool
+		expected []bool
+	}{
+		{
+			name:     "stays connected",
+			initial:  true,
+			expected: []bool{true, true},
+		},
+		{
+			name:     "starts disconnected",
+			initial:  false,
+			expected: []bool{false, false},
+		},
+		{
+			name:     "disconnect is reported",
+			initial:  true,
+			changes:  []bool{false},
+			expected: []bool{false, false},
+		},
+		{
+			name:     "short drop within one interval is reported once",
+			initial:  true,
+			changes:  []bool{false, true},
+			expected: []bool{false, true},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewConnectionStatus(tt.initial)
+			for _, connected := range tt.changes {
+				c.SetConnected(connected)
+			}
+
+			for i, expected := range tt.expected {
+				samples, err := c.Collect()
+				if err != nil {
+					t.Fatalf("Unexpected error: %v", err)
+				}
+				if got := valueOf(t, samples, "obs_connected"); got != expected {
+					t.Errorf("Collect %d: expected obs_connected to be %v, got %v", i, expected, got)
+				}
+			}
+		})
+	}
+}
+
+func TestConnectionStatus_SetConnected(t *testing.T) {
+	c := NewConnectionStatus(true)
+
+	c.SetConnected(false)
+	if c.Connected() {
+		t.Error("Expected Connected to be false")
+	}
+
+	c.SetConnected(true)
+	if !c.Connected() {
+		t.Error("Expected Connected to be true")
+	}
+}
@@ -0,0 +1,211 @@
+package metric
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"slices"
+	"strings"
+	"time"
+)
+
+// dnsHistorySize is the number of recently seen addresses a new answer is compared with
+const dnsHistorySize = 16
+
+// DNSProbe resolves a hostname every metric interval and reports the resolution time and the addresses
+// per writer interval. When the host moves to other addresses, for example because the ingest moved to
+// another server mid-stream, onChange receives an IngestAddressChanged event. A host that rotates
+// through a set of addresses, like round-robin DNS, doesn't count as moving: the host moved when an
+// answer has none of the recently seen addresses, or no longer has the watched address.
+type DNSProbe struct {
+	intervalTracker
+	name      string
+	domain    string
+	fields    []Field
+	lookup    func(ctx context.Context, host string) ([]net.IPAddr, error)
+	onChange  func(Event)
+	maxTime   time.Duration
+	addresses []string // union of the addresses resolved during the interval
+	current   []string // addresses of the last lookup, reported as the old ones on a change
+	recent    []string // addresses seen in the last lookups, oldest first
+	watched   func() string
+	gone      string // watched address that was already reported as no longer resolved
+	changed   bool
+	interval  time.Duration
+}
+
+// NewDNSProbe creates a probe for domain whose results are reported as <name>_dns_ms and friends,
+// onChange may be nil
+func NewDNSProbe(name, domain string, interval time.Duration, onChange func(Event)) *DNSProbe {
+	return &DNSProbe{
+		name:   name,
+		domain: domain,
+		fields: []Field{
+			{Name: name + "_dns_ms", Type: DurationValue, Kind: Gauge, Precision: 2},
+			{Name: name + "_dns_addresses", Type: StringValue, Kind: Gauge},
+			{Name: name + "_dns_changed", Type: BoolValue, Kind: Gauge},
+		},
+		lookup:   net.DefaultResolver.LookupIPAddr,
+		onChange: onChange,
+		interval: interval,
+	}
+}
+
+func (d *DNSProbe) Name() string {
+	return d.name + "_dns"
+}
+
+func (d *DNSProbe) Fields() []Field {
+	return d.fields
+}
+
+// SetDomain changes the resolved domain, a new domain resolving to other addresses is not a change
+func (d *DNSProbe) SetDomain(domain string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if domain != d.domain {
+		d.current = nil
+		d.recent = nil
+	}
+	d.domain = domain
+}
+
+// SetWatched sets a function returning the address another collector uses, e.g. the one a pinger
+// pings, so a host no longer resolving to it counts as moved. An empty address isn't watched.
+func (d *DNSProbe) SetWatched(watched func() string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.watched = watched
+}
+
+func (d *DNSProbe) getDomain() string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.domain
+}
+
+// Resolved returns the addresses of the last lookup
+func (d *DNSProbe) Resolved() []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return slices.Clone(d.current)
+}
+
+// getWatched returns the watched address, empty when there is none
+func (d *DNSProbe) getWatched() string {
+	d.mu.Lock()
+	watched := d.watched
+	d.mu.Unlock()
+
+	if watched == nil {
+		return ""
+	}
+	return watched()
+}
+
+// Collect returns the slowest resolution of the interval, every address the host resolved to and
+// whether the addresses changed
+func (d *DNSProbe) Collect() ([]Sample, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	samples := []Sample{{Field: d.fields[0]}, {Field: d.fields[1]}, {Field: d.fields[2]}}
+	if d.stale() {
+		return samples, errNoNewMeasurements
+	}
+
+	if len(d.addresses) > 0 {
+		samples[0].Value = d.maxTime
+		samples[1].Value = strings.Join(d.addresses, ", ")
+	}
+	samples[2].Value = d.changed
+
+	d.maxTime = 0
+	d.addresses = nil
+	d.changed = false
+	return samples, d.reset()
+}
+
+func (d *DNSProbe) Start(ctx context.Context) error {
+	return runEvery(ctx, d.interval, func() {
+		d.resolve(ctx)
+	})
+}
+
+// resolve looks the domain up once, the change event is sent after releasing the lock
+func (d *DNSProbe) resolve(ctx context.Context) {
+	domain, watched := d.getDomain(), d.getWatched()
+
+	lookupCtx, cancel := context.WithTimeout(ctx, probeTimeout)
+	defer cancel()
+	start := time.Now()
+	ips, err := d.lookup(lookupCtx, domain)
+	elapsed := time.Since(start)
+
+	d.mu.Lock()
+	if err != nil {
+		d.lastError = err
+		d.measured()
+		d.mu.Unlock()
+		return
+	}
+	if domain != d.domain {
+		// The domain changed while resolving, the result belongs to the old one
+		d.mu.Unlock()
+		return
+	}
+
+	resolved := make([]string, len(ips))
+	for i, ip := range ips {
+		resolved[i] = ip.IP.String()
+	}
+	slices.Sort(resolved)
+	resolved = slices.Compact(resolved)
+
+	var event *Event
+	if d.current != nil && d.moved(resolved, watched) {
+		d.changed = true
+		event = &Event{
+			Time:   time.Now(),
+			Type:   "IngestAddressChanged",
+			Detail: fmt.Sprintf("%s %s -> %s", domain, strings.Join(d.current, ", "), strings.Join(resolved, ", ")),
+		}
+	}
+	d.current = resolved
+	d.remember(resolved)
+	d.maxTime = max(d.maxTime, elapsed)
+	for _, addr := range resolved {
+		if !slices.Contains(d.addresses, addr) {
+			d.addresses = append(d.addresses, addr)
+		}
+	}
+	slices.Sort(d.addresses)
+	d.measured()
+	d.mu.Unlock()
+
+	if event != nil && d.onChange != nil {
+		d.onChange(*event)
+	}
+}
+
+// moved tells whether resolved has none of the recently seen addresses, or lost the watched address
+// for the first time. The caller must hold mu.
+func (d *DNSProbe) moved(resolved []string, watched string) bool {
+	if watched != "" && watched != d.gone && !slices.Contains(resolved, watched) {
+		d.gone = watched
+		return true
+	}
+	return !slices.ContainsFunc(resolved, func(addr string) bool { return slices.Contains(d.recent, addr) })
+}
+
+// remember adds the addresses to the recently seen ones, dropping the oldest beyond dnsHistorySize.
+// The caller must hold mu.
+func (d *DNSProbe) remember(addresses []string) {
+	for _, addr := range addresses {
+		d.recent = slices.DeleteFunc(d.recent, func(a string) bool { return a == addr })
+		d.recent = append(d.recent, addr)
+	}
+	if len(d.recent) > dnsHistorySize {
+		d.recent = d.recent[len(d.recent)-dnsHistorySize:]
+	}
+}
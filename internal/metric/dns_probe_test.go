@@ -0,0 +1,152 @@
+package metric
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+// newTestDNSProbe returns a probe that resolves to the addresses in answers, one lookup at a time
+func newTestDNSProbe(answers ...[]string) (*DNSProbe, *[]Event) {
+	var events []Event
+	d := NewDNSProbe("obs", "ingest.example.com", time.Second, func(e Event) {
+		events = append(events, e)
+	})
+	d.lookup = func(ctx context.Context, host string) ([]net.IPAddr, error) {
+		answer := answers[0]
+		answers = answers[1:]
+		if answer == nil {
+			return nil, errors.New("no such host")
+		}
+		var ips []net.IPAddr
+		for _, a := range answer {
+			ips = append(ips, net.IPAddr{IP: net.ParseIP(a)})
+		}
+		return ips, nil
+	}
+	return d, &events
+}
+
+func TestDNSProbe_Collect(t *testing.T) {
+	d, events := newTestDNSProbe([]string{"192.0.2.2", "192.0.2.1"}, []string{"192.0.2.1", "192.0.2.2"})
+	d.resolve(context.Background())
+	d.resolve(context.Background())
+
+	samples, err := d.Collect()
+
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if v, ok := valueOf(t, samples, "obs_dns_ms").(time.Duration); !ok || v < 0 {
+		t.Errorf("Expected a resolution time, got %v", v)
+	}
+	if v := valueOf(t, samples, "obs_dns_addresses"); v != "192.0.2.1, 192.0.2.2" {
+		t.Errorf("Expected the sorted addresses, got %v", v)
+	}
+	if v := valueOf(t, samples, "obs_dns_changed"); v != false {
+		t.Errorf("Expected a reordered answer not to be a change, got %v", v)
+	}
+	if len(*events) != 0 {
+		t.Errorf("Expected no events, got %v", *events)
+	}
+}
+
+func TestDNSProbe_Collect_AddressChanged(t *testing.T) {
+	d, events := newTestDNSProbe([]string{"192.0.2.1"}, []string{"192.0.2.1"}, []string{"198.51.100.7"})
+	d.resolve(context.Background())
+	d.Collect()
+	d.resolve(context.Background())
+	d.resolve(context.Background())
+
+	samples, _ := d.Collect()
+
+	if v := valueOf(t, samples, "obs_dns_addresses"); v != "192.0.2.1, 198.51.100.7" {
+		t.Errorf("Expected both addresses of the interval, got %v", v)
+	}
+	if v := valueOf(t, samples, "obs_dns_changed"); v != true {
+		t.Errorf("Expected obs_dns_changed to be true, got %v", v)
+	}
+	if len(*events) != 1 {
+		t.Fatalf("Expected 1 event, got %v", *events)
+	}
+	expected := "IngestAddressChanged: ingest.example.com 192.0.2.1 -> 198.51.100.7"
+	if (*events)[0].String() != expected {
+		t.Errorf("Expected event %q, got %q", expected, (*events)[0].String())
+	}
+}
+
+func TestDNSProbe_Collect_RoundRobinIsNoChange(t *testing.T) {
+	// A host rotating through three addresses, two per answer
+	d, events := newTestDNSProbe(
+		[]string{"192.0.2.1", "192.0.2.2"},
+		[]string{"192.0.2.2", "192.0.2.3"},
+		[]string{"192.0.2.3", "192.0.2.1"},
+		[]string{"192.0.2.1", "192.0.2.2"},
+		[]string{"192.0.2.2", "192.0.2.3"},
+	)
+	for range 5 {
+		d.resolve(context.Background())
+	}
+
+	samples, _ := d.Collect()
+
+	if v := valueOf(t, samples, "obs_dns_changed"); v != false {
+		t.Errorf("Expected alternating answers not to be a change, got %v", v)
+	}
+	if len(*events) != 0 {
+		t.Errorf("Expected no events, got %v", *events)
+	}
+}
+
+func TestDNSProbe_Collect_WatchedAddressGone(t *testing.T) {
+	d, events := newTestDNSProbe([]string{"192.0.2.1", "192.0.2.2"}, []string{"192.0.2.2"}, []string{"192.0.2.2"})
+	d.SetWatched(func() string { return "192.0.2.1" })
+	d.resolve(context.Background())
+	d.resolve(context.Background())
+	d.resolve(context.Background())
+
+	samples, _ := d.Collect()
+
+	if v := valueOf(t, samples, "obs_dns_changed"); v != true {
+		t.Errorf("Expected obs_dns_changed to be true, got %v", v)
+	}
+	if len(*events) != 1 {
+		t.Fatalf("Expected 1 event for the watched address, got %v", *events)
+	}
+	expected := "IngestAddressChanged: ingest.example.com 192.0.2.1, 192.0.2.2 -> 192.0.2.2"
+	if (*events)[0].String() != expected {
+		t.Errorf("Expected event %q, got %q", expected, (*events)[0].String())
+	}
+}
+
+func TestDNSProbe_Collect_LookupError(t *testing.T) {
+	d, _ := newTestDNSProbe(nil)
+	d.resolve(context.Background())
+
+	samples, err := d.Collect()
+
+	if err == nil {
+		t.Error("Expected the lookup error")
+	}
+	if v := valueOf(t, samples, "obs_dns_addresses"); v != nil {
+		t.Errorf("Expected no addresses, got %v", v)
+	}
+}
+
+func TestDNSProbe_SetDomain_IsNoChange(t *testing.T) {
+	d, events := newTestDNSProbe([]string{"192.0.2.1"}, []string{"203.0.113.5"})
+	d.resolve(context.Background())
+
+	d.SetDomain("other.example.com")
+	d.resolve(context.Background())
+
+	samples, _ := d.Collect()
+	if v := valueOf(t, samples, "obs_dns_changed"); v != false {
+		t.Errorf("Expected a new domain not to count as a change, got %v", v)
+	}
+	if len(*events) != 0 {
+		t.Errorf("Expected no events, got %v", *events)
+	}
+}
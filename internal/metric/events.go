@@ -0,0 +1,121 @@
+package metric
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/andreykaipov/goobs/api/events"
+)
+
+var eventRecorderFields = []Field{
+	{Name: "events", Type: StringValue, Kind: Gauge},
+}
+
+// Event is an OBS state change together with the moment it was received
+type Event struct {
+	Time   time.Time
+	Type   string
+	Detail string
+}
+
+func (e Event) String() string {
+	if e.Detail == "" {
+		return e.Type
+	}
+	return e.Type + ": " + e.Detail
+}
+
+// NewEvent describes the OBS events that help explain the metrics, such as a scene switch around a
+// frame drop. Other events return false.
+func NewEvent(received time.Time, event any) (Event, bool) {
+	e := Event{Time: received}
+	switch ev := event.(type) {
+	case *events.ExitStarted:
+		e.Type = "ExitStarted"
+	case *events.StreamStateChanged:
+		e.Type, e.Detail = "StreamStateChanged", ev.OutputState
+	case *events.RecordStateChanged:
+		e.Type, e.Detail = "RecordStateChanged", ev.OutputState
+	case *events.ReplayBufferStateChanged:
+		e.Type, e.Detail = "ReplayBufferStateChanged", ev.OutputState
+	case *events.VirtualcamStateChanged:
+		e.Type, e.Detail = "VirtualcamStateChanged", ev.OutputState
+	case *events.CurrentProgramSceneChanged:
+		e.Type, e.Detail = "CurrentProgramSceneChanged", ev.SceneName
+	case *events.CurrentPreviewSceneChanged:
+		e.Type, e.Detail = "CurrentPreviewSceneChanged", ev.SceneName
+	case *events.CurrentSceneCollectionChanged:
+		e.Type, e.Detail = "CurrentSceneCollectionChanged", ev.SceneCollectionName
+	case *events.CurrentProfileChanged:
+		e.Type, e.Detail = "CurrentProfileChanged", ev.ProfileName
+	case *events.InputMuteStateChanged:
+		e.Type, e.Detail = "InputMuteStateChanged", ev.InputName+" "+onOff(ev.InputMuted, "muted", "unmuted")
+	case *events.SceneItemEnableStateChanged:
+		e.Type = "SceneItemEnableStateChanged"
+		e.Detail = fmt.Sprintf("%s item %d %s", ev.SceneName, ev.SceneItemId, onOff(ev.SceneItemEnabled, "shown", "hidden"))
+	case *events.StudioModeStateChanged:
+		e.Type, e.Detail = "StudioModeStateChanged", onOff(ev.StudioModeEnabled, "enabled", "disabled")
+	default:
+		return Event{}, false
+	}
+	return e, true
+}
+
+func onOff(on bool, yes, no string) string {
+	if on {
+		return yes
+	}
+	return no
+}
+
+// EventRecorder lists the OBS events received during a writer interval in the events column
+type EventRecorder struct {
+	events []Event
+	mu     sync.Mutex
+}
+
+func NewEventRecorder() *EventRecorder {
+	return &EventRecorder{}
+}
+
+func (r *EventRecorder) Name() string {
+	return "events"
+}
+
+func (r *EventRecorder) Fields() []Field {
+	return eventRecorderFields
+}
+
+// Start has nothing to measure, the monitor hands events to Record as they arrive
+func (r *EventRecorder) Start(ctx context.Context) error {
+	<-ctx.Done()
+	return nil
+}
+
+// Record adds an event to the current interval
+func (r *EventRecorder) Record(e Event) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, e)
+}
+
+// Collect returns the events of the interval separated by semicolons, or no value without events
+func (r *EventRecorder) Collect() ([]Sample, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if len(r.events) == 0 {
+		return nil, nil
+	}
+
+	parts := make([]string, len(r.events))
+	for i, e := range r.events {
+		parts[i] = e.String()
+	}
+	r.events = nil
+
+	return []Sample{{Field: eventRecorderFields[0], Value: strings.Join(parts, "; ")}}, nil
+}
@@ -0,0 +1,66 @@
+package metric
+
+import (
+	"testing"
+	"time"
+
+	"github.com/andreykaipov/goobs/api/events"
+)
+
+func TestNewEvent(t *testing.T) {
+	received := time.Date(2025, 12, 23, 15, 1, 25, 123000000, time.UTC)
+
+	tests := []struct {
+		name     string
+		event    any
+		expected string
+		ok       bool
+	}{
+		{name: "stream state", event: &events.StreamStateChanged{OutputActive: true, OutputState: "OBS_WEBSOCKET_OUTPUT_STARTED"}, expected: "StreamStateChanged: OBS_WEBSOCKET_OUTPUT_STARTED", ok: true},
+		{name: "scene switch", event: &events.CurrentProgramSceneChanged{SceneName: "Gameplay"}, expected: "CurrentProgramSceneChanged: Gameplay", ok: true},
+		{name: "mute", event: &events.InputMuteStateChanged{InputName: "Mic/Aux", InputMuted: true}, expected: "InputMuteStateChanged: Mic/Aux muted", ok: true},
+		{name: "scene item", event: &events.SceneItemEnableStateChanged{SceneName: "Gameplay", SceneItemId: 3}, expected: "SceneItemEnableStateChanged: Gameplay item 3 hidden", ok: true},
+		{name: "profile", event: &events.CurrentProfileChanged{ProfileName: "Low latency"}, expected: "CurrentProfileChanged: Low latency", ok: true},
+		{name: "without detail", event: &events.ExitStarted{}, expected: "ExitStarted", ok: true},
+		{name: "untracked", event: &events.InputVolumeMeters{}, ok: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e, ok := NewEvent(received, tt.event)
+			if ok != tt.ok {
+				t.Fatalf("Expected ok to be %v, got %v", tt.ok, ok)
+			}
+			if !ok {
+				return
+			}
+			if e.String() != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, e.String())
+			}
+			if !e.Time.Equal(received) {
+				t.Errorf("Expected time %v, got %v", received, e.Time)
+			}
+		})
+	}
+}
+
+func TestEventRecorder_Collect(t *testing.T) {
+	r := NewEventRecorder()
+
+	if samples, err := r.Collect(); len(samples) != 0 || err != nil {
+		t.Errorf("Expected no value without events, got %v, %v", samples, err)
+	}
+
+	r.Record(Event{Type: "CurrentProgramSceneChanged", Detail: "Gameplay"})
+	r.Record(Event{Type: "StreamStateChanged", Detail: "OBS_WEBSOCKET_OUTPUT_STARTED"})
+	samples, _ := r.Collect()
+
+	expected := "CurrentProgramSceneChanged: Gameplay; StreamStateChanged: OBS_WEBSOCKET_OUTPUT_STARTED"
+	if v := valueOf(t, samples, "events"); v != expected {
+		t.Errorf("Expected %q, got %v", expected, v)
+	}
+
+	if samples, _ := r.Collect(); len(samples) != 0 {
+		t.Errorf("Expected the events to be cleared after a read, got %v", samples)
+	}
+}
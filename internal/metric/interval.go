@@ -0,0 +1,100 @@
+package metric
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+var errNoNewMeasurements = errors.New("no new measurements collected since last read")
+
+// intervalTracker holds the bookkeeping every collector needs between two reads
+type intervalTracker struct {
+	lastError            error
+	measurementCount     int
+	measurementsSinceGet int
+	detached             bool
+	mu                   sync.Mutex
+}
+
+func (t *intervalTracker) recordError(err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.lastError = err
+}
+
+// measured counts a successful measurement, the caller must hold mu
+func (t *intervalTracker) measured() {
+	t.measurementCount++
+	t.measurementsSinceGet++
+}
+
+// stale reports whether nothing was measured since the previous read, the caller must hold mu
+func (t *intervalTracker) stale() bool {
+	return t.measurementsSinceGet == 0 && t.measurementCount > 0
+}
+
+// reset starts a new interval and returns the last error of the finished one, the caller must hold mu
+func (t *intervalTracker) reset() error {
+	err := t.lastError
+	t.lastError = nil
+	t.measurementsSinceGet = 0
+	return err
+}
+
+// restart discards all measurements and marks whether the source is unreachable, the caller must hold mu
+func (t *intervalTracker) restart(detached bool) {
+	t.lastError = nil
+	t.measurementCount = 0
+	t.measurementsSinceGet = 0
+	t.detached = detached
+}
+
+// runEvery calls fn on every tick of interval until the context is cancelled
+func runEvery(ctx context.Context, interval time.Duration, fn func()) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			fn()
+		}
+	}
+}
+
+// cumulativeCounter turns a counter that OBS keeps since it started into per-interval deltas. The
+// first read only takes a baseline, so the counts from before the monitor started aren't reported.
+type cumulativeCounter struct {
+	last      float64
+	prev      float64
+	seen      bool
+	baselined bool
+}
+
+func (c *cumulativeCounter) update(value float64) {
+	c.last = value
+	c.seen = true
+}
+
+// delta returns the increase since the previous call, a counter that went down was reset by OBS
+func (c *cumulativeCounter) delta() float64 {
+	if !c.seen {
+		return 0
+	}
+	if !c.baselined {
+		c.prev = c.last
+		c.baselined = true
+		return 0
+	}
+
+	d := c.last - c.prev
+	if d < 0 {
+		d = c.last
+	}
+	c.prev = c.last
+	return d
+}
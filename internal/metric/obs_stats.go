@@ -1,102 +1,315 @@
 package metric
 
 import (
-	"fmt"
-	"sync"
+	"context"
+	"strings"
 	"time"
 
 	"github.com/andreykaipov/goobs"
+	"github.com/andreykaipov/goobs/api/requests/general"
+	"github.com/andreykaipov/goobs/api/requests/sceneitems"
+	"github.com/andreykaipov/goobs/api/typedefs"
 )
 
-type ObsStats struct {
-	client               *goobs.Client
-	maxObsCpuUsage       float64
-	maxObsMemoryUsage    float64
-	lastError            error
-	measurementCount     int
-	measurementsSinceGet int
-	mu                   sync.Mutex
-	interval             time.Duration
+var obsStatsFields = []Field{
+	{Name: "obs_cpu_percent", Type: FloatValue, Kind: Gauge, Precision: 2},
+	{Name: "obs_memory_mb", Type: FloatValue, Kind: Gauge, Precision: 2},
+	{Name: "obs_active_fps", Type: FloatValue, Kind: Gauge, Precision: 2},
+	{Name: "obs_frame_render_time_ms", Type: FloatValue, Kind: Gauge, Precision: 2},
+	{Name: "render_skipped_frames", Type: FloatValue, Kind: Counter},
+	{Name: "render_frames", Type: FloatValue, Kind: Counter},
+	{Name: "encoding_skipped_frames", Type: FloatValue, Kind: Counter},
+	{Name: "encoding_frames", Type: FloatValue, Kind: Counter},
+	{Name: "obs_disk_space_mb", Type: FloatValue, Kind: Gauge},
+	{Name: "websocket_incoming_messages", Type: FloatValue, Kind: Counter},
+	{Name: "websocket_outgoing_messages", Type: FloatValue, Kind: Counter},
+	{Name: "program_scene", Type: StringValue, Kind: Gauge},
+	{Name: "visible_sources", Type: StringValue, Kind: Gauge},
+	{Name: "visible_source_count", Type: FloatValue, Kind: Gauge},
 }
 
-type ObsStatsData struct {
-	Timestamp      time.Time
-	ObsCpuUsage    float64
-	ObsMemoryUsage float64
-	Error          error
+// compositionRefreshInterval limits how long a cached scene composition is used, in case the event
+// announcing a change was missed
+const compositionRefreshInterval = 10 * time.Second
+
+// sceneComposition is the program scene and the sources visible in it, including the sources of
+// nested scenes and groups
+type sceneComposition struct {
+	scene   string
+	sources []string
+}
+
+type ObsStats struct {
+	intervalTracker
+	client                *goobs.Client
+	maxObsCpuUsage        float64
+	maxObsMemoryUsage     float64
+	minActiveFps          float64
+	maxFrameRenderTime    float64
+	availableDiskSpace    float64
+	renderSkippedFrames   cumulativeCounter
+	renderTotalFrames     cumulativeCounter
+	outputSkippedFrames   cumulativeCounter
+	outputTotalFrames     cumulativeCounter
+	webSocketIncomingMsgs cumulativeCounter
+	webSocketOutgoingMsgs cumulativeCounter
+	composition           *sceneComposition
+	compositionRenderTime float64
+	cached                *sceneComposition
+	cachedAt              time.Time
+	cacheGeneration       int
+	readComposition       func(client *goobs.Client) (sceneComposition, error)
+	interval              time.Duration
 }
 
 func NewObsStats(client *goobs.Client, interval time.Duration) (*ObsStats, error) {
 	return &ObsStats{
-		client:   client,
-		interval: interval,
+		client:          client,
+		readComposition: currentComposition,
+		interval:        interval,
 	}, nil
 }
 
-func (s *ObsStats) GetAndResetMaxValues() ObsStatsData {
+func (s *ObsStats) Name() string {
+	return "obs_stats"
+}
+
+func (s *ObsStats) Fields() []Field {
+	return obsStatsFields
+}
+
+func (s *ObsStats) Collect() ([]Sample, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	maxCpu := s.maxObsCpuUsage
-	maxMemory := s.maxObsMemoryUsage
-	err := s.lastError
+	if s.detached {
+		s.reset()
+		return nil, nil
+	}
 
-	if s.measurementsSinceGet == 0 && s.measurementCount > 0 {
-		return ObsStatsData{
-			Timestamp:      time.Now(),
-			ObsCpuUsage:    0,
-			ObsMemoryUsage: 0,
-			Error:          fmt.Errorf("no new measurements collected since last read"),
+	if s.stale() {
+		var samples []Sample
+		for _, f := range obsStatsFields {
+			if f.Type == FloatValue {
+				samples = append(samples, Sample{Field: f, Value: 0.0})
+			}
 		}
+		return samples, errNoNewMeasurements
+	}
+
+	values := []float64{
+		s.maxObsCpuUsage,
+		s.maxObsMemoryUsage,
+		s.minActiveFps,
+		s.maxFrameRenderTime,
+		s.renderSkippedFrames.delta(),
+		s.renderTotalFrames.delta(),
+		s.outputSkippedFrames.delta(),
+		s.outputTotalFrames.delta(),
+		s.availableDiskSpace,
+		s.webSocketIncomingMsgs.delta(),
+		s.webSocketOutgoingMsgs.delta(),
+	}
+	samples := make([]Sample, len(values))
+	for i, v := range values {
+		samples[i] = Sample{Field: obsStatsFields[i], Value: v}
+	}
+	if c := s.composition; c != nil {
+		samples = append(samples,
+			Sample{Field: obsStatsFields[len(values)], Value: c.scene},
+			Sample{Field: obsStatsFields[len(values)+1], Value: strings.Join(c.sources, ", ")},
+			Sample{Field: obsStatsFields[len(values)+2], Value: float64(len(c.sources))},
+		)
 	}
 
 	s.maxObsCpuUsage = 0
 	s.maxObsMemoryUsage = 0
-	s.lastError = nil
-	s.measurementsSinceGet = 0
-
-	return ObsStatsData{
-		Timestamp:      time.Now(),
-		ObsCpuUsage:    maxCpu,
-		ObsMemoryUsage: maxMemory,
-		Error:          err,
-	}
+	s.minActiveFps = 0
+	s.maxFrameRenderTime = 0
+	s.composition = nil
+
+	return samples, s.reset()
 }
 
-func (s *ObsStats) updateStats(cpuUsage, memoryUsage float64) {
+// SetClient binds a new OBS connection. A restarted OBS starts its counters from zero, so they
+// get a fresh baseline.
+func (s *ObsStats) SetClient(client *goobs.Client) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	if cpuUsage > s.maxObsCpuUsage {
-		s.maxObsCpuUsage = cpuUsage
+	s.client = client
+	s.maxObsCpuUsage = 0
+	s.maxObsMemoryUsage = 0
+	s.minActiveFps = 0
+	s.maxFrameRenderTime = 0
+	s.availableDiskSpace = 0
+	s.renderSkippedFrames = cumulativeCounter{}
+	s.renderTotalFrames = cumulativeCounter{}
+	s.outputSkippedFrames = cumulativeCounter{}
+	s.outputTotalFrames = cumulativeCounter{}
+	s.webSocketIncomingMsgs = cumulativeCounter{}
+	s.webSocketOutgoingMsgs = cumulativeCounter{}
+	s.composition = nil
+	s.cached = nil
+	s.cacheGeneration++
+	s.restart(client == nil)
+}
+
+// RefreshComposition makes the next poll read the program scene composition again, the monitor calls it
+// for the events that change what is on screen, such as a scene switch or a hidden item
+func (s *ObsStats) RefreshComposition() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.cached = nil
+	s.cacheGeneration++
+}
+
+// cachedComposition returns the program scene composition, reading it from OBS only after a change or
+// once the cache is compositionRefreshInterval old. Reading it takes a request per nested scene or
+// group, too many to send on every poll to the OBS whose render time is measured.
+func (s *ObsStats) cachedComposition(client *goobs.Client) (sceneComposition, error) {
+	s.mu.Lock()
+	if s.cached != nil && time.Since(s.cachedAt) < compositionRefreshInterval {
+		c := *s.cached
+		s.mu.Unlock()
+		return c, nil
 	}
-	if memoryUsage > s.maxObsMemoryUsage {
-		s.maxObsMemoryUsage = memoryUsage
+	generation := s.cacheGeneration
+	s.mu.Unlock()
+
+	c, err := s.readComposition(client)
+	if err != nil {
+		return sceneComposition{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// A change announced while reading may not be part of the result, so it is read again next time
+	if generation == s.cacheGeneration {
+		s.cached = &c
+		s.cachedAt = time.Now()
+	}
+	return c, nil
+}
+
+func (s *ObsStats) getClient() *goobs.Client {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.client
+}
+
+// updateStats records a GetStats response. The frame rate keeps the lowest value of the interval as
+// a dip is what shows lag, the other gauges keep the highest value.
+func (s *ObsStats) updateStats(stats *general.GetStatsResponse) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.maxObsCpuUsage = max(s.maxObsCpuUsage, stats.CpuUsage)
+	s.maxObsMemoryUsage = max(s.maxObsMemoryUsage, stats.MemoryUsage)
+	if s.measurementsSinceGet == 0 {
+		s.minActiveFps = stats.ActiveFps
+	} else {
+		s.minActiveFps = min(s.minActiveFps, stats.ActiveFps)
 	}
-	s.measurementCount++
-	s.measurementsSinceGet++
+	s.maxFrameRenderTime = max(s.maxFrameRenderTime, stats.AverageFrameRenderTime)
+	s.availableDiskSpace = stats.AvailableDiskSpace
+	s.renderSkippedFrames.update(stats.RenderSkippedFrames)
+	s.renderTotalFrames.update(stats.RenderTotalFrames)
+	s.outputSkippedFrames.update(stats.OutputSkippedFrames)
+	s.outputTotalFrames.update(stats.OutputTotalFrames)
+	s.webSocketIncomingMsgs.update(stats.WebSocketSessionIncomingMessages)
+	s.webSocketOutgoingMsgs.update(stats.WebSocketSessionOutgoingMessages)
+	s.measured()
 }
 
-func (s *ObsStats) recordError(err error) {
+// updateComposition keeps the scene composition of the poll with the highest frame render time, so a
+// render time spike can be traced back to what was on screen
+func (s *ObsStats) updateComposition(c sceneComposition, renderTime float64) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	s.lastError = err
+
+	if s.composition == nil || renderTime >= s.compositionRenderTime {
+		s.composition = &c
+		s.compositionRenderTime = renderTime
+	}
 }
 
-func (s *ObsStats) Start() error {
-	ticker := time.NewTicker(s.interval)
-	defer ticker.Stop()
+// currentComposition lists the visible sources of the program scene
+func currentComposition(client *goobs.Client) (sceneComposition, error) {
+	scene, err := client.Scenes.GetCurrentProgramScene()
+	if err != nil {
+		return sceneComposition{}, err
+	}
+	name := scene.SceneName
+	if name == "" {
+		// OBS WebSocket before 5.5 only fills the deprecated field
+		name = scene.CurrentProgramSceneName
+	}
 
-	for range ticker.C {
-		stats, err := s.client.General.GetStats()
+	c := sceneComposition{scene: name}
+	c.sources, err = visibleSources(client, name, false, map[string]bool{name: true})
+	return c, err
+}
 
+// visibleSources returns the enabled items of a scene or group, descending into nested scenes and
+// groups. A scene nested in itself through another scene is only visited once.
+func visibleSources(client *goobs.Client, name string, group bool, visited map[string]bool) ([]string, error) {
+	var items []*typedefs.SceneItem
+	if group {
+		list, err := client.SceneItems.GetGroupSceneItemList(&sceneitems.GetGroupSceneItemListParams{SceneName: &name})
 		if err != nil {
-			s.recordError(err)
+			return nil, err
+		}
+		items = list.SceneItems
+	} else {
+		list, err := client.SceneItems.GetSceneItemList(&sceneitems.GetSceneItemListParams{SceneName: &name})
+		if err != nil {
+			return nil, err
+		}
+		items = list.SceneItems
+	}
+
+	var sources []string
+	for _, item := range items {
+		if !item.SceneItemEnabled {
 			continue
 		}
+		sources = append(sources, item.SourceName)
 
-		s.updateStats(stats.CpuUsage, stats.MemoryUsage)
+		nested := item.IsGroup || item.SourceType == "OBS_SOURCE_TYPE_SCENE"
+		if !nested || visited[item.SourceName] {
+			continue
+		}
+		visited[item.SourceName] = true
+		children, err := visibleSources(client, item.SourceName, item.IsGroup, visited)
+		if err != nil {
+			return nil, err
+		}
+		sources = append(sources, children...)
 	}
+	return sources, nil
+}
+
+func (s *ObsStats) Start(ctx context.Context) error {
+	return runEvery(ctx, s.interval, func() {
+		client := s.getClient()
+		if client == nil {
+			return
+		}
 
-	return nil
+		stats, err := client.General.GetStats()
+		if err != nil {
+			s.recordError(err)
+			return
+		}
+
+		s.updateStats(stats)
+
+		composition, err := s.cachedComposition(client)
+		if err != nil {
+			s.recordError(err)
+			return
+		}
+		s.updateComposition(composition, stats.AverageFrameRenderTime)
+	})
 }
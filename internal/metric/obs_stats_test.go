@@ -5,35 +5,38 @@ import (
 	"sync"
 	"testing"
 	"time"
+
+	"github.com/andreykaipov/goobs"
+	"github.com/andreykaipov/goobs/api/requests/general"
 )
 
-func TestObsStats_GetAndResetMaxValues_ReturnsCorrectMaxValues(t *testing.T) {
+func TestObsStats_Collect_ReturnsCorrectMaxValues(t *testing.T) {
 	obs := &ObsStats{
-		maxObsCpuUsage:       25.5,
-		maxObsMemoryUsage:    1024.0,
-		measurementCount:     5,
-		measurementsSinceGet: 3,
+		maxObsCpuUsage:    25.5,
+		maxObsMemoryUsage: 1024.0,
 	}
+	obs.measurementCount = 5
+	obs.measurementsSinceGet = 3
 
-	data := obs.GetAndResetMaxValues()
+	samples, _ := obs.Collect()
 
-	if data.ObsCpuUsage != 25.5 {
-		t.Errorf("Expected ObsCpuUsage to be 25.5, got %f", data.ObsCpuUsage)
+	if cpu := valueOf(t, samples, "obs_cpu_percent"); cpu != 25.5 {
+		t.Errorf("Expected obs_cpu_percent to be 25.5, got %v", cpu)
 	}
-	if data.ObsMemoryUsage != 1024.0 {
-		t.Errorf("Expected ObsMemoryUsage to be 1024.0, got %f", data.ObsMemoryUsage)
+	if mem := valueOf(t, samples, "obs_memory_mb"); mem != 1024.0 {
+		t.Errorf("Expected obs_memory_mb to be 1024.0, got %v", mem)
 	}
 }
 
-func TestObsStats_GetAndResetMaxValues_ResetsValues(t *testing.T) {
+func TestObsStats_Collect_ResetsValues(t *testing.T) {
 	obs := &ObsStats{
-		maxObsCpuUsage:       25.5,
-		maxObsMemoryUsage:    1024.0,
-		measurementCount:     5,
-		measurementsSinceGet: 2,
+		maxObsCpuUsage:    25.5,
+		maxObsMemoryUsage: 1024.0,
 	}
+	obs.measurementCount = 5
+	obs.measurementsSinceGet = 2
 
-	_ = obs.GetAndResetMaxValues()
+	_, _ = obs.Collect()
 
 	if obs.maxObsCpuUsage != 0 {
 		t.Errorf("Expected maxObsCpuUsage to be reset to 0, got %f", obs.maxObsCpuUsage)
@@ -46,35 +49,33 @@ func TestObsStats_GetAndResetMaxValues_ResetsValues(t *testing.T) {
 	}
 }
 
-func TestObsStats_GetAndResetMaxValues_ErrorHandling(t *testing.T) {
+func TestObsStats_Collect_ErrorHandling(t *testing.T) {
 	testError := fmt.Errorf("test error")
-	obs := &ObsStats{
-		maxObsCpuUsage:       10.0,
-		lastError:            testError,
-		measurementCount:     3,
-		measurementsSinceGet: 1,
-	}
+	obs := &ObsStats{maxObsCpuUsage: 10.0}
+	obs.lastError = testError
+	obs.measurementCount = 3
+	obs.measurementsSinceGet = 1
 
-	data := obs.GetAndResetMaxValues()
+	_, err := obs.Collect()
 
-	if data.Error == nil {
+	if err == nil {
 		t.Error("Expected error to be returned")
 	}
-	if data.Error != testError {
+	if err != testError {
 		t.Error("Expected error pointer to match")
 	}
 
 	if obs.lastError != nil {
-		t.Error("Expected lastError to be reset to nil after GetAndResetMaxValues")
+		t.Error("Expected lastError to be reset to nil after Collect")
 	}
 }
 
-func TestObsStats_GetAndResetMaxValues_ConcurrentAccess(t *testing.T) {
+func TestObsStats_Collect_ConcurrentAccess(t *testing.T) {
 	obs := &ObsStats{
 		maxObsCpuUsage:    15.0,
 		maxObsMemoryUsage: 512.0,
-		measurementCount:  10,
 	}
+	obs.measurementCount = 10
 
 	var wg sync.WaitGroup
 	iterations := 100
@@ -83,52 +84,46 @@ func TestObsStats_GetAndResetMaxValues_ConcurrentAccess(t *testing.T) {
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
-			_ = obs.GetAndResetMaxValues()
+			_, _ = obs.Collect()
 		}()
 	}
 
 	wg.Wait()
 }
 
-func TestObsStats_GetAndResetMaxValues_ZeroValues(t *testing.T) {
-	obs := &ObsStats{
-		maxObsCpuUsage:    0,
-		maxObsMemoryUsage: 0,
-		measurementCount:  0,
-	}
+func TestObsStats_Collect_ZeroValues(t *testing.T) {
+	obs := &ObsStats{}
 
-	data := obs.GetAndResetMaxValues()
+	samples, err := obs.Collect()
 
-	if data.ObsCpuUsage != 0 {
-		t.Errorf("Expected ObsCpuUsage to be 0, got %f", data.ObsCpuUsage)
+	if cpu := valueOf(t, samples, "obs_cpu_percent"); cpu != 0.0 {
+		t.Errorf("Expected obs_cpu_percent to be 0, got %v", cpu)
 	}
-	if data.ObsMemoryUsage != 0 {
-		t.Errorf("Expected ObsMemoryUsage to be 0, got %f", data.ObsMemoryUsage)
+	if mem := valueOf(t, samples, "obs_memory_mb"); mem != 0.0 {
+		t.Errorf("Expected obs_memory_mb to be 0, got %v", mem)
 	}
-	if data.Error != nil {
+	if err != nil {
 		t.Error("Expected no error with zero values")
 	}
 }
 
-func TestObsStats_GetAndResetMaxValues_TracksMaximum(t *testing.T) {
-	obs := &ObsStats{
-		maxObsCpuUsage:       10.0,
-		measurementCount:     2,
-		measurementsSinceGet: 1,
-	}
+func TestObsStats_Collect_TracksMaximum(t *testing.T) {
+	obs := &ObsStats{maxObsCpuUsage: 10.0}
+	obs.measurementCount = 2
+	obs.measurementsSinceGet = 1
 
-	data1 := obs.GetAndResetMaxValues()
-	if data1.ObsCpuUsage != 10.0 {
-		t.Errorf("Expected first call to return 10.0, got %f", data1.ObsCpuUsage)
+	samples, _ := obs.Collect()
+	if cpu := valueOf(t, samples, "obs_cpu_percent"); cpu != 10.0 {
+		t.Errorf("Expected first call to return 10.0, got %v", cpu)
 	}
 
 	obs.maxObsCpuUsage = 20.0
 	obs.measurementCount = 3
 	obs.measurementsSinceGet = 1
 
-	data2 := obs.GetAndResetMaxValues()
-	if data2.ObsCpuUsage != 20.0 {
-		t.Errorf("Expected second call to return 20.0 (new max), got %f", data2.ObsCpuUsage)
+	samples, _ = obs.Collect()
+	if cpu := valueOf(t, samples, "obs_cpu_percent"); cpu != 20.0 {
+		t.Errorf("Expected second call to return 20.0 (new max), got %v", cpu)
 	}
 }
 
@@ -146,86 +141,52 @@ func TestObsStats_NewObsStats(t *testing.T) {
 	if obs.interval != interval {
 		t.Errorf("Expected interval %v, got %v", interval, obs.interval)
 	}
-}
-
-func TestObsStats_GetAndResetMaxValues_SetsTimestamp(t *testing.T) {
-	obs := &ObsStats{
-		maxObsCpuUsage: 15.0,
-	}
-
-	before := time.Now()
-	data := obs.GetAndResetMaxValues()
-	after := time.Now()
-
-	if data.Timestamp.Before(before) || data.Timestamp.After(after) {
-		t.Error("Expected timestamp to be set to current time")
+	if obs.Name() != "obs_stats" {
+		t.Errorf("Expected name obs_stats, got %s", obs.Name())
 	}
 }
 
 func TestObsStats_ErrorHandlingDuringCollection(t *testing.T) {
-	obs := &ObsStats{
-		maxObsCpuUsage:       20.0,
-		measurementCount:     5,
-		measurementsSinceGet: 3,
-	}
+	obs := &ObsStats{maxObsCpuUsage: 20.0}
+	obs.measurementCount = 5
+	obs.measurementsSinceGet = 3
 
 	testError := fmt.Errorf("stats collection error")
+	obs.recordError(testError)
 
 	obs.mu.Lock()
-	obs.lastError = testError
-	obs.mu.Unlock()
-
-	obs.mu.Lock()
-	if obs.lastError != testError {
-		t.Error("Expected lastError to be set")
-	}
 	if obs.maxObsCpuUsage != 20.0 {
 		t.Error("Expected maxObsCpuUsage to remain unchanged after error")
 	}
 	obs.mu.Unlock()
 
-	data := obs.GetAndResetMaxValues()
-	if data.Error != testError {
-		t.Error("Expected error to be returned in data")
+	_, err := obs.Collect()
+	if err != testError {
+		t.Error("Expected error to be returned from Collect")
 	}
 }
 
-func TestObsStats_MeasurementCountIncrement(t *testing.T) {
+func TestObsStats_Collect_NoNewMeasurements(t *testing.T) {
 	obs := &ObsStats{
-		measurementCount: 5,
+		maxObsCpuUsage:    20.0,
+		maxObsMemoryUsage: 500.0,
 	}
+	obs.measurementCount = 5
+	obs.measurementsSinceGet = 0
 
-	obs.mu.Lock()
-	obs.maxObsCpuUsage = 10.0
-	obs.measurementCount++
-	obs.mu.Unlock()
+	samples, err := obs.Collect()
 
-	if obs.measurementCount != 6 {
-		t.Errorf("Expected measurementCount to be 6, got %d", obs.measurementCount)
+	if err == nil {
+		t.Fatal("Expected error when no new measurements collected")
 	}
-}
-
-func TestObsStats_GetAndResetMaxValues_NoNewMeasurements(t *testing.T) {
-	obs := &ObsStats{
-		maxObsCpuUsage:       20.0,
-		maxObsMemoryUsage:    500.0,
-		measurementCount:     5,
-		measurementsSinceGet: 0,
+	if err.Error() != "no new measurements collected since last read" {
+		t.Errorf("Expected specific error message, got: %v", err)
 	}
-
-	data := obs.GetAndResetMaxValues()
-
-	if data.Error == nil {
-		t.Error("Expected error when no new measurements collected")
+	if cpu := valueOf(t, samples, "obs_cpu_percent"); cpu != 0.0 {
+		t.Errorf("Expected obs_cpu_percent to be 0, got %v", cpu)
 	}
-	if data.Error.Error() != "no new measurements collected since last read" {
-		t.Errorf("Expected specific error message, got: %v", data.Error)
-	}
-	if data.ObsCpuUsage != 0 {
-		t.Errorf("Expected ObsCpuUsage to be 0, got %f", data.ObsCpuUsage)
-	}
-	if data.ObsMemoryUsage != 0 {
-		t.Errorf("Expected ObsMemoryUsage to be 0, got %f", data.ObsMemoryUsage)
+	if mem := valueOf(t, samples, "obs_memory_mb"); mem != 0.0 {
+		t.Errorf("Expected obs_memory_mb to be 0, got %v", mem)
 	}
 }
 
@@ -292,10 +253,10 @@ func TestObsStats_UpdateStats(t *testing.T) {
 			obs := &ObsStats{
 				maxObsCpuUsage:    tt.initialMaxCpu,
 				maxObsMemoryUsage: tt.initialMaxMem,
-				measurementCount:  tt.initialMeasureCount,
 			}
+			obs.measurementCount = tt.initialMeasureCount
 
-			obs.updateStats(tt.newCpu, tt.newMem)
+			obs.updateStats(&general.GetStatsResponse{CpuUsage: tt.newCpu, MemoryUsage: tt.newMem})
 
 			if obs.maxObsCpuUsage != tt.expectedMaxCpu {
 				t.Errorf("Expected maxObsCpuUsage %f, got %f", tt.expectedMaxCpu, obs.maxObsCpuUsage)
@@ -322,8 +283,202 @@ func TestObsStats_RecordError(t *testing.T) {
 	}
 	obs.mu.Unlock()
 
-	data := obs.GetAndResetMaxValues()
-	if data.Error != testError {
-		t.Error("Expected error to be returned in GetAndResetMaxValues")
+	_, err := obs.Collect()
+	if err != testError {
+		t.Error("Expected error to be returned from Collect")
+	}
+}
+
+func TestObsStats_SetClient_DetachedReportsNoValues(t *testing.T) {
+	obs := &ObsStats{maxObsCpuUsage: 25.5}
+	obs.measurementCount = 5
+	obs.measurementsSinceGet = 2
+
+	obs.SetClient(nil)
+	samples, err := obs.Collect()
+
+	if err != nil {
+		t.Errorf("Expected no error while detached, got %v", err)
+	}
+	if len(samples) != 0 {
+		t.Errorf("Expected no samples while detached, got %v", samples)
+	}
+	if obs.maxObsCpuUsage != 0 {
+		t.Errorf("Expected maxObsCpuUsage to be reset to 0, got %f", obs.maxObsCpuUsage)
+	}
+}
+
+func TestObsStats_Collect_FullStats(t *testing.T) {
+	obs := &ObsStats{}
+
+	obs.updateStats(&general.GetStatsResponse{
+		ActiveFps:                        60,
+		AverageFrameRenderTime:           2.5,
+		AvailableDiskSpace:               100000,
+		RenderSkippedFrames:              10,
+		RenderTotalFrames:                3600,
+		OutputSkippedFrames:              4,
+		OutputTotalFrames:                3500,
+		WebSocketSessionIncomingMessages: 100,
+		WebSocketSessionOutgoingMessages: 120,
+	})
+
+	// The first interval only takes the baseline of the counters OBS kept before the monitor started
+	samples, err := obs.Collect()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if frames := valueOf(t, samples, "render_frames"); frames != 0.0 {
+		t.Errorf("Expected render_frames to be 0 for the baseline, got %v", frames)
+	}
+	if fps := valueOf(t, samples, "obs_active_fps"); fps != 60.0 {
+		t.Errorf("Expected obs_active_fps to be 60, got %v", fps)
+	}
+
+	obs.updateStats(&general.GetStatsResponse{
+		ActiveFps:                        59.5,
+		AverageFrameRenderTime:           7.25,
+		AvailableDiskSpace:               99000,
+		RenderSkippedFrames:              12,
+		RenderTotalFrames:                3630,
+		OutputSkippedFrames:              4,
+		OutputTotalFrames:                3530,
+		WebSocketSessionIncomingMessages: 102,
+		WebSocketSessionOutgoingMessages: 124,
+	})
+	obs.updateStats(&general.GetStatsResponse{
+		ActiveFps:                        60,
+		AverageFrameRenderTime:           3.0,
+		AvailableDiskSpace:               98000,
+		RenderSkippedFrames:              15,
+		RenderTotalFrames:                3660,
+		OutputSkippedFrames:              5,
+		OutputTotalFrames:                3560,
+		WebSocketSessionIncomingMessages: 104,
+		WebSocketSessionOutgoingMessages: 128,
+	})
+
+	samples, err = obs.Collect()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected := map[string]float64{
+		"obs_active_fps":              59.5,
+		"obs_frame_render_time_ms":    7.25,
+		"render_skipped_frames":       5,
+		"render_frames":               60,
+		"encoding_skipped_frames":     1,
+		"encoding_frames":             60,
+		"obs_disk_space_mb":           98000,
+		"websocket_incoming_messages": 4,
+		"websocket_outgoing_messages": 8,
+	}
+	for name, value := range expected {
+		if got := valueOf(t, samples, name); got != value {
+			t.Errorf("Expected %s to be %v, got %v", name, value, got)
+		}
+	}
+}
+
+func TestObsStats_SetClient_StartsNewBaseline(t *testing.T) {
+	obs := &ObsStats{}
+	obs.updateStats(&general.GetStatsResponse{RenderTotalFrames: 3600})
+	obs.Collect()
+	obs.updateStats(&general.GetStatsResponse{RenderTotalFrames: 3660})
+	obs.Collect()
+
+	// OBS restarted, so its counters start from zero again
+	obs.SetClient(&goobs.Client{})
+	obs.updateStats(&general.GetStatsResponse{RenderTotalFrames: 60})
+	samples, _ := obs.Collect()
+	if frames := valueOf(t, samples, "render_frames"); frames != 0.0 {
+		t.Errorf("Expected render_frames to be 0 for the new baseline, got %v", frames)
+	}
+
+	obs.updateStats(&general.GetStatsResponse{RenderTotalFrames: 120})
+	samples, _ = obs.Collect()
+	if frames := valueOf(t, samples, "render_frames"); frames != 60.0 {
+		t.Errorf("Expected render_frames delta to be 60, got %v", frames)
+	}
+}
+
+func TestObsStats_Collect_CompositionAtPeakRenderTime(t *testing.T) {
+	obs := &ObsStats{}
+	obs.updateStats(&general.GetStatsResponse{AverageFrameRenderTime: 2.1})
+	obs.updateComposition(sceneComposition{scene: "Starting Soon", sources: []string{"Background"}}, 2.1)
+	obs.updateStats(&general.GetStatsResponse{AverageFrameRenderTime: 9.8})
+	obs.updateComposition(sceneComposition{scene: "Gameplay", sources: []string{"Game Capture", "Webcam", "Alerts"}}, 9.8)
+	obs.updateStats(&general.GetStatsResponse{AverageFrameRenderTime: 3.0})
+	obs.updateComposition(sceneComposition{scene: "Just Chatting", sources: []string{"Webcam"}}, 3.0)
+
+	samples, _ := obs.Collect()
+
+	if v := valueOf(t, samples, "obs_frame_render_time_ms"); v != 9.8 {
+		t.Errorf("Expected obs_frame_render_time_ms to be 9.8, got %v", v)
+	}
+	if v := valueOf(t, samples, "program_scene"); v != "Gameplay" {
+		t.Errorf("Expected the scene of the render time peak, got %v", v)
+	}
+	if v := valueOf(t, samples, "visible_sources"); v != "Game Capture, Webcam, Alerts" {
+		t.Errorf("Unexpected visible_sources %v", v)
+	}
+	if v := valueOf(t, samples, "visible_source_count"); v != 3.0 {
+		t.Errorf("Expected visible_source_count to be 3, got %v", v)
+	}
+
+	obs.updateStats(&general.GetStatsResponse{AverageFrameRenderTime: 1.0})
+	samples, _ = obs.Collect()
+	for _, s := range samples {
+		if s.Name == "program_scene" {
+			t.Errorf("Expected no program_scene when the scene couldn't be read, got %v", s.Value)
+		}
+	}
+}
+
+func TestObsStats_CachedComposition(t *testing.T) {
+	obs, _ := NewObsStats(nil, time.Second)
+	reads := 0
+	obs.readComposition = func(client *goobs.Client) (sceneComposition, error) {
+		reads++
+		return sceneComposition{scene: fmt.Sprintf("Scene %d", reads)}, nil
+	}
+
+	for i := 0; i < 3; i++ {
+		if c, _ := obs.cachedComposition(nil); c.scene != "Scene 1" {
+			t.Errorf("Expected the cached composition, got %s", c.scene)
+		}
+	}
+	if reads != 1 {
+		t.Errorf("Expected a single read for unchanged scenes, got %d", reads)
+	}
+
+	obs.RefreshComposition()
+	if c, _ := obs.cachedComposition(nil); c.scene != "Scene 2" {
+		t.Errorf("Expected the composition to be read again after a change, got %s", c.scene)
+	}
+
+	obs.cachedAt = time.Now().Add(-compositionRefreshInterval)
+	if c, _ := obs.cachedComposition(nil); c.scene != "Scene 3" {
+		t.Errorf("Expected an old composition to be read again, got %s", c.scene)
+	}
+}
+
+func TestObsStats_CachedComposition_ChangeWhileReading(t *testing.T) {
+	obs, _ := NewObsStats(nil, time.Second)
+	reads := 0
+	obs.readComposition = func(client *goobs.Client) (sceneComposition, error) {
+		reads++
+		if reads == 1 {
+			obs.RefreshComposition()
+		}
+		return sceneComposition{scene: "Gameplay"}, nil
+	}
+
+	obs.cachedComposition(nil)
+	obs.cachedComposition(nil)
+
+	if reads != 2 {
+		t.Errorf("Expected a change during the read to trigger another read, got %d reads", reads)
 	}
 }
@@ -0,0 +1,238 @@
+package metric
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/andreykaipov/goobs"
+	"github.com/andreykaipov/goobs/api/requests/outputs"
+	"github.com/andreykaipov/goobs/api/requests/record"
+)
+
+var outputMetricsFields = []Field{
+	{Name: "record_active", Type: BoolValue, Kind: Gauge},
+	{Name: "record_paused", Type: BoolValue, Kind: Gauge},
+	{Name: "record_bytes", Type: FloatValue, Kind: Counter},
+	{Name: "record_duration_ms", Type: FloatValue, Kind: Gauge},
+	{Name: "replay_buffer_active", Type: BoolValue, Kind: Gauge},
+	{Name: "virtualcam_active", Type: BoolValue, Kind: Gauge},
+}
+
+// outputState holds the last status of an output from GetOutputList
+type outputState struct {
+	name    string
+	column  string
+	active  bool
+	bytes   cumulativeCounter
+	frames  cumulativeCounter
+	skipped cumulativeCounter
+}
+
+// OutputMetrics watches the recording, the replay buffer, the virtual camera and every output OBS
+// listed at startup, such as the outputs of multi-RTMP plugins. Outputs added later are not picked up
+// as the columns are fixed once the writers are created.
+type OutputMetrics struct {
+	intervalTracker
+	client         *goobs.Client
+	fields         []Field
+	recordActive   bool
+	recordPaused   bool
+	recordBytes    cumulativeCounter
+	recordDuration float64
+	replayBuffer   *bool
+	virtualCam     *bool
+	outputs        []*outputState
+	interval       time.Duration
+}
+
+// NewOutputMetrics lists the outputs of OBS to add a set of columns per output
+func NewOutputMetrics(client *goobs.Client, interval time.Duration) (*OutputMetrics, error) {
+	var names []string
+	if client != nil {
+		list, err := client.Outputs.GetOutputList()
+		if err != nil {
+			return nil, fmt.Errorf("failed to list outputs: %w", err)
+		}
+		for _, o := range list.Outputs {
+			names = append(names, o.Name)
+		}
+	}
+
+	return newOutputMetrics(client, names, interval), nil
+}
+
+func newOutputMetrics(client *goobs.Client, names []string, interval time.Duration) *OutputMetrics {
+	s := &OutputMetrics{
+		client:   client,
+		fields:   append([]Field(nil), outputMetricsFields...),
+		interval: interval,
+	}
+
+	for i, column := range columnNames("output", names) {
+		s.outputs = append(s.outputs, &outputState{name: names[i], column: column})
+		s.fields = append(s.fields,
+			Field{Name: column + "_active", Type: BoolValue, Kind: Gauge},
+			Field{Name: column + "_bytes", Type: FloatValue, Kind: Counter},
+			Field{Name: column + "_frames", Type: FloatValue, Kind: Counter},
+			Field{Name: column + "_skipped_frames", Type: FloatValue, Kind: Counter},
+		)
+	}
+	return s
+}
+
+func (s *OutputMetrics) Name() string {
+	return "outputs"
+}
+
+func (s *OutputMetrics) Fields() []Field {
+	return s.fields
+}
+
+func (s *OutputMetrics) Collect() ([]Sample, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.detached {
+		s.reset()
+		return nil, nil
+	}
+
+	stale := s.stale()
+	delta := func(c *cumulativeCounter) float64 {
+		if stale {
+			return 0
+		}
+		return c.delta()
+	}
+
+	samples := []Sample{
+		{Field: s.fields[0], Value: s.recordActive},
+		{Field: s.fields[1], Value: s.recordPaused},
+		{Field: s.fields[2], Value: delta(&s.recordBytes)},
+		{Field: s.fields[3], Value: s.recordDuration},
+	}
+	// A nil value leaves the column empty when OBS doesn't offer the feature
+	if s.replayBuffer != nil {
+		samples = append(samples, Sample{Field: s.fields[4], Value: *s.replayBuffer})
+	}
+	if s.virtualCam != nil {
+		samples = append(samples, Sample{Field: s.fields[5], Value: *s.virtualCam})
+	}
+	for i, o := range s.outputs {
+		fields := s.fields[len(outputMetricsFields)+i*4:]
+		samples = append(samples,
+			Sample{Field: fields[0], Value: o.active},
+			Sample{Field: fields[1], Value: delta(&o.bytes)},
+			Sample{Field: fields[2], Value: delta(&o.frames)},
+			Sample{Field: fields[3], Value: delta(&o.skipped)},
+		)
+	}
+
+	if stale {
+		return samples, errNoNewMeasurements
+	}
+	return samples, s.reset()
+}
+
+// SetClient binds a new OBS connection. A restarted OBS starts its counters from zero, so they
+// get a fresh baseline.
+func (s *OutputMetrics) SetClient(client *goobs.Client) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.client = client
+	s.recordActive = false
+	s.recordPaused = false
+	s.recordBytes = cumulativeCounter{}
+	s.recordDuration = 0
+	s.replayBuffer = nil
+	s.virtualCam = nil
+	for _, o := range s.outputs {
+		o.active = false
+		o.bytes = cumulativeCounter{}
+		o.frames = cumulativeCounter{}
+		o.skipped = cumulativeCounter{}
+	}
+	s.restart(client == nil)
+}
+
+func (s *OutputMetrics) getClient() *goobs.Client {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.client
+}
+
+// outputStatuses is the result of one poll, a nil entry means OBS didn't answer for that output
+type outputStatuses struct {
+	record       *record.GetRecordStatusResponse
+	replayBuffer *outputs.GetReplayBufferStatusResponse
+	virtualCam   *outputs.GetVirtualCamStatusResponse
+	outputs      map[string]*outputs.GetOutputStatusResponse
+}
+
+func (s *OutputMetrics) updateMetrics(statuses outputStatuses) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if r := statuses.record; r != nil {
+		s.recordActive = r.OutputActive
+		s.recordPaused = r.OutputPaused
+		s.recordBytes.update(r.OutputBytes)
+		s.recordDuration = r.OutputDuration
+	}
+
+	s.replayBuffer = nil
+	if statuses.replayBuffer != nil {
+		s.replayBuffer = &statuses.replayBuffer.OutputActive
+	}
+	s.virtualCam = nil
+	if statuses.virtualCam != nil {
+		s.virtualCam = &statuses.virtualCam.OutputActive
+	}
+
+	for _, o := range s.outputs {
+		status, ok := statuses.outputs[o.name]
+		if !ok {
+			continue
+		}
+		o.active = status.OutputActive
+		o.bytes.update(status.OutputBytes)
+		o.frames.update(status.OutputTotalFrames)
+		o.skipped.update(status.OutputSkippedFrames)
+	}
+	s.measured()
+}
+
+func (s *OutputMetrics) Start(ctx context.Context) error {
+	return runEvery(ctx, s.interval, func() {
+		client := s.getClient()
+		if client == nil {
+			return
+		}
+
+		var statuses outputStatuses
+		var err error
+		statuses.record, err = client.Record.GetRecordStatus()
+		if err != nil {
+			s.recordError(err)
+			return
+		}
+
+		// OBS rejects these requests when the replay buffer is disabled or no virtual camera is installed
+		statuses.replayBuffer, _ = client.Outputs.GetReplayBufferStatus()
+		statuses.virtualCam, _ = client.Outputs.GetVirtualCamStatus()
+
+		statuses.outputs = make(map[string]*outputs.GetOutputStatusResponse, len(s.outputs))
+		for _, o := range s.outputs {
+			status, err := client.Outputs.GetOutputStatus(&outputs.GetOutputStatusParams{OutputName: &o.name})
+			if err != nil {
+				s.recordError(fmt.Errorf("output %s: %w", o.name, err))
+				continue
+			}
+			statuses.outputs[o.name] = status
+		}
+
+		s.updateMetrics(statuses)
+	})
+}
@@ -0,0 +1,111 @@
+package metric
+
+import (
+	"testing"
+
+	"github.com/andreykaipov/goobs"
+	"github.com/andreykaipov/goobs/api/requests/outputs"
+	"github.com/andreykaipov/goobs/api/requests/record"
+)
+
+func TestOutputMetrics_Fields_PerOutput(t *testing.T) {
+	om := newOutputMetrics(nil, []string{"simple_stream", "Multi RTMP", "multi-rtmp"}, 0)
+
+	var names []string
+	for _, f := range om.Fields()[len(outputMetricsFields):] {
+		names = append(names, f.Name)
+	}
+
+	expected := []string{
+		"output_simple_stream_active", "output_simple_stream_bytes", "output_simple_stream_frames", "output_simple_stream_skipped_frames",
+		"output_multi_rtmp_active", "output_multi_rtmp_bytes", "output_multi_rtmp_frames", "output_multi_rtmp_skipped_frames",
+		"output_multi_rtmp_2_active", "output_multi_rtmp_2_bytes", "output_multi_rtmp_2_frames", "output_multi_rtmp_2_skipped_frames",
+	}
+	if len(names) != len(expected) {
+		t.Fatalf("Expected fields %v, got %v", expected, names)
+	}
+	for i := range expected {
+		if names[i] != expected[i] {
+			t.Errorf("Expected field %d to be %s, got %s", i, expected[i], names[i])
+		}
+	}
+}
+
+func TestOutputMetrics_Collect(t *testing.T) {
+	om := newOutputMetrics(nil, []string{"adv_file_output"}, 0)
+	poll := func(recordBytes, fileBytes, frames, skipped float64) {
+		om.updateMetrics(outputStatuses{
+			record:       &record.GetRecordStatusResponse{OutputActive: true, OutputBytes: recordBytes, OutputDuration: 5000},
+			replayBuffer: &outputs.GetReplayBufferStatusResponse{OutputActive: true},
+			outputs: map[string]*outputs.GetOutputStatusResponse{
+				"adv_file_output": {OutputActive: true, OutputBytes: fileBytes, OutputTotalFrames: frames, OutputSkippedFrames: skipped},
+			},
+		})
+	}
+
+	poll(1000, 1000, 60, 0)
+	om.Collect()
+	poll(3000, 3000, 120, 2)
+	samples, err := om.Collect()
+	if err != nil {
+		t.Fatalf("Collect returned error: %v", err)
+	}
+
+	expected := map[string]any{
+		"record_active":                         true,
+		"record_paused":                         false,
+		"record_bytes":                          2000.0,
+		"record_duration_ms":                    5000.0,
+		"replay_buffer_active":                  true,
+		"output_adv_file_output_active":         true,
+		"output_adv_file_output_bytes":          2000.0,
+		"output_adv_file_output_frames":         60.0,
+		"output_adv_file_output_skipped_frames": 2.0,
+	}
+	for name, value := range expected {
+		if v := valueOf(t, samples, name); v != value {
+			t.Errorf("Expected %s to be %v, got %v", name, value, v)
+		}
+	}
+	for _, s := range samples {
+		if s.Name == "virtualcam_active" {
+			t.Errorf("Expected no virtualcam_active value without a virtual camera, got %v", s.Value)
+		}
+	}
+}
+
+func TestOutputMetrics_Collect_NoNewMeasurements(t *testing.T) {
+	om := newOutputMetrics(nil, []string{"adv_file_output"}, 0)
+	om.updateMetrics(outputStatuses{record: &record.GetRecordStatusResponse{OutputActive: true, OutputBytes: 1000}})
+	om.Collect()
+
+	samples, err := om.Collect()
+
+	if err != errNoNewMeasurements {
+		t.Errorf("Expected errNoNewMeasurements, got %v", err)
+	}
+	if v := valueOf(t, samples, "record_bytes"); v != 0.0 {
+		t.Errorf("Expected record_bytes to be 0, got %v", v)
+	}
+	if v := valueOf(t, samples, "record_active"); v != true {
+		t.Errorf("Expected record_active to keep the last state, got %v", v)
+	}
+}
+
+func TestOutputMetrics_SetClient_StartsNewBaseline(t *testing.T) {
+	om := newOutputMetrics(nil, nil, 0)
+	om.updateMetrics(outputStatuses{record: &record.GetRecordStatusResponse{OutputBytes: 5000}})
+	om.Collect()
+
+	om.SetClient(nil)
+	if samples, _ := om.Collect(); len(samples) != 0 {
+		t.Errorf("Expected no samples while detached, got %v", samples)
+	}
+
+	om.SetClient(&goobs.Client{})
+	om.updateMetrics(outputStatuses{record: &record.GetRecordStatusResponse{OutputBytes: 100}})
+	samples, _ := om.Collect()
+	if v := valueOf(t, samples, "record_bytes"); v != 0.0 {
+		t.Errorf("Expected record_bytes to be 0 for the new baseline, got %v", v)
+	}
+}
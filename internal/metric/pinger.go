@@ -1,97 +1,457 @@
 package metric
 
 import (
+	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
+	"math"
+	"net"
 	"runtime"
-	"sync"
+	"slices"
 	"time"
 
 	probing "github.com/prometheus-community/pro-bing"
 )
 
-type Pinger struct {
-	domain               string
-	maxRTT               time.Duration
-	lastError            error
-	measurementCount     int
-	measurementsSinceGet int
-	mu                   sync.Mutex
-	interval             time.Duration
+// Probe selects how a ping target is measured
+type Probe int
+
+const (
+	// ICMPProbe sends an ICMP echo request
+	ICMPProbe Probe = iota
+	// TCPProbe measures the TCP connect time, for servers that block or deprioritise ICMP
+	TCPProbe
+	// RTMPProbe measures the TCP connect time plus the first round trip of the RTMP handshake, over TLS
+	// for an RTMPS target
+	RTMPProbe
+)
+
+func (p Probe) String() string {
+	switch p {
+	case TCPProbe:
+		return "TCP"
+	case RTMPProbe:
+		return "RTMP"
+	default:
+		return "ICMP"
+	}
 }
 
-type PingMetrics struct {
-	Timestamp time.Time
-	RTT       time.Duration
-	Error     error
+const (
+	// probeTimeout is how long a probe waits for an answer before it counts as lost, an ICMP reply
+	// after the timeout counts as late
+	probeTimeout = 1 * time.Second
+	// lostTimeout is how long an ICMP echo request waits for a late reply before it counts as lost
+	lostTimeout = 5 * time.Second
+	// resolveInterval is how often a running ICMP pinger checks whether its host moved to another address
+	resolveInterval = 30 * time.Second
+)
+
+// PingTarget is a host that is probed next to the stream server, reported as <Name>_rtt_ms
+type PingTarget struct {
+	Name  string
+	Host  string
+	Probe Probe
+	Port  int  // port of the TCP and RTMP probes, 0 selects DefaultProbePort or DefaultTLSProbePort
+	TLS   bool // the server speaks RTMPS, the RTMP probe handshakes over TLS
+}
+
+// port returns the configured port or the default port of the protocol
+func (t PingTarget) port() int {
+	switch {
+	case t.Port != 0:
+		return t.Port
+	case t.TLS:
+		return DefaultTLSProbePort
+	default:
+		return DefaultProbePort
+	}
+}
+
+// DefaultPingTargets are pinged when no targets are configured
+var DefaultPingTargets = []PingTarget{{Name: "google", Host: "google.com"}}
+
+// errNoReply is returned for an echo request that wasn't answered within the timeout, it counts as lost
+var errNoReply = errors.New("no response received")
+
+// Pinger sends one probe per metric interval and reports the round-trip times, the packet loss and
+// the jitter per writer interval. The jitter is the smoothed RFC 3550 estimate of the variation between
+// consecutive replies, so it carries over from one interval to the next.
+//
+// The ICMP probe keeps a single pinger running per target that sends on the metric interval and matches
+// the replies by sequence number, so sends don't wait for the previous reply. A probe counts in the
+// interval in which it is answered or times out, a reply that arrives after the timeout is counted as late.
+type Pinger struct {
+	intervalTracker
+	name     string
+	domain   string
+	probe    Probe
+	port     int
+	tls      bool
+	fields   []Field
+	sent     int
+	received int
+	minRTT   time.Duration
+	maxRTT   time.Duration
+	sumRTT   time.Duration
+	lastRTT  time.Duration
+	jitter   float64 // in nanoseconds, kept as a float to not lose the 1/16 steps
+	late     int
+	pending  map[int]time.Time // ICMP sequence numbers awaiting a reply, with the time they were sent
+	pinged   net.IP            // address the ICMP pinger pings, nil while it isn't running
+	stopRun  context.CancelFunc
+	interval time.Duration
 }
 
-func NewPinger(domain string, interval time.Duration) (*Pinger, error) {
+// NewPinger creates a pinger for the target whose results are reported as <name>_rtt_ms and friends
+func NewPinger(target PingTarget, interval time.Duration) (*Pinger, error) {
+	name := target.Name
 	return &Pinger{
-		domain:   domain,
+		name:   name,
+		domain: target.Host,
+		probe:  target.Probe,
+		port:   target.port(),
+		tls:    target.TLS,
+		fields: []Field{
+			{Name: name + "_rtt_ms", Type: DurationValue, Kind: Gauge, Precision: 2},
+			{Name: name + "_rtt_min_ms", Type: DurationValue, Kind: Gauge, Precision: 2},
+			{Name: name + "_rtt_avg_ms", Type: DurationValue, Kind: Gauge, Precision: 2},
+			{Name: name + "_jitter_ms", Type: DurationValue, Kind: Gauge, Precision: 2},
+			{Name: name + "_pings_sent", Type: FloatValue, Kind: Counter},
+			{Name: name + "_pings_received", Type: FloatValue, Kind: Counter},
+			{Name: name + "_pings_late", Type: FloatValue, Kind: Counter},
+			{Name: name + "_ping_loss_percent", Type: FloatValue, Kind: Gauge, Precision: 1},
+		},
+		pending:  make(map[int]time.Time),
 		interval: interval,
 	}, nil
 }
 
-func (p *Pinger) GetAndResetMaxRTT() (time.Duration, error) {
+func (p *Pinger) Name() string {
+	return p.name + "_ping"
+}
+
+func (p *Pinger) Fields() []Field {
+	return p.fields
+}
+
+// SetServer changes the probed host, port and protocol, used when the stream server changes after a
+// reconnect or a profile switch. The jitter of the old server says nothing about the new one, so it
+// starts over, as does a running ICMP pinger.
+func (p *Pinger) SetServer(host string, port int, useTLS bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	port = PingTarget{Port: port, TLS: useTLS}.port()
+	if host != p.domain || port != p.port || useTLS != p.tls {
+		p.lastRTT = 0
+		p.jitter = 0
+		if p.stopRun != nil {
+			p.stopRun()
+		}
+	}
+	p.domain = host
+	p.port = port
+	p.tls = useTLS
+}
+
+func (p *Pinger) getDomain() string {
 	p.mu.Lock()
 	defer p.mu.Unlock()
+	return p.domain
+}
 
-	if p.measurementsSinceGet == 0 && p.measurementCount > 0 {
-		return 0, fmt.Errorf("no new measurements collected since last read")
+// getServer returns the host, port and protocol of the TCP and RTMP probes
+func (p *Pinger) getServer() (string, int, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.domain, p.port, p.tls
+}
+
+// Collect returns the highest, lowest and average RTT of the replies in the interval, the jitter and the
+// number of sent, answered and late probes. The RTTs are empty when nothing was answered.
+func (p *Pinger) Collect() ([]Sample, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.expire(time.Now())
+
+	samples := make([]Sample, len(p.fields))
+	for i, f := range p.fields {
+		samples[i] = Sample{Field: f}
+	}
+
+	if p.stale() {
+		return samples, errNoNewMeasurements
 	}
 
-	maxRTT := p.maxRTT
 	err := p.lastError
+	if err == nil && p.received > 0 {
+		samples[0].Value = p.maxRTT
+		samples[1].Value = p.minRTT
+		samples[2].Value = p.sumRTT / time.Duration(p.received)
+	}
+	if err == nil && p.lastRTT > 0 {
+		samples[3].Value = time.Duration(p.jitter)
+	}
+	if p.sent > 0 {
+		samples[4].Value = float64(p.sent)
+		samples[5].Value = float64(p.received)
+		samples[7].Value = float64(p.sent-p.received) * 100 / float64(p.sent)
+	}
+	if p.sent > 0 || p.late > 0 {
+		samples[6].Value = float64(p.late)
+	}
 
+	p.sent = 0
+	p.received = 0
+	p.late = 0
+	p.minRTT = 0
 	p.maxRTT = 0
-	p.lastError = nil
-	p.measurementsSinceGet = 0
+	p.sumRTT = 0
+	return samples, p.reset()
+}
+
+// record adds the result of one echo request, an unanswered request counts as lost rather than an error
+func (p *Pinger) record(rtt time.Duration, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
 
-	return maxRTT, err
+	switch {
+	case errors.Is(err, errNoReply):
+		p.lost()
+	case err != nil:
+		p.lastError = err
+		p.measured()
+	default:
+		p.answered(rtt)
+	}
 }
 
-func (p *Pinger) Start() error {
-	fmt.Printf("Pinging %s every %v\n", p.domain, p.interval)
+// answered counts a probe that was answered in time, the caller must hold mu
+func (p *Pinger) answered(rtt time.Duration) {
+	p.sent++
+	p.received++
+	if p.received == 1 || rtt < p.minRTT {
+		p.minRTT = rtt
+	}
+	p.maxRTT = max(p.maxRTT, rtt)
+	p.sumRTT += rtt
 
-	ticker := time.NewTicker(p.interval)
-	defer ticker.Stop()
+	// RFC 3550 section 6.4.1: J += (|D| - J) / 16, with D the change between consecutive replies
+	if p.lastRTT > 0 {
+		d := math.Abs(float64(rtt - p.lastRTT))
+		p.jitter += (d - p.jitter) / 16
+	}
+	p.lastRTT = rtt
+	p.measured()
+}
+
+// lost counts a probe that wasn't answered, the caller must hold mu
+func (p *Pinger) lost() {
+	p.sent++
+	p.measured()
+}
 
-	for range ticker.C {
-		rtt, err := p.ping(p.domain)
+// sentEcho tracks an ICMP echo request until its reply arrives or it times out
+func (p *Pinger) sentEcho(seq int, at time.Time) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
 
-		p.mu.Lock()
-		if err != nil {
-			p.lastError = err
-		} else if rtt > p.maxRTT {
-			p.maxRTT = rtt
+	p.expire(at)
+	p.pending[seq] = at
+}
+
+// receivedEcho matches an ICMP echo reply with its request. A reply after probeTimeout still counts as
+// received with its RTT, and is counted as late as well. A reply to a request that already counted as
+// lost is ignored.
+func (p *Pinger) receivedEcho(seq int, rtt time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if _, ok := p.pending[seq]; !ok {
+		return
+	}
+	delete(p.pending, seq)
+	if rtt > probeTimeout {
+		p.late++
+	}
+	p.answered(rtt)
+}
+
+// expire counts the requests that weren't answered within lostTimeout as lost, the caller must hold mu
+func (p *Pinger) expire(now time.Time) {
+	for seq, at := range p.pending {
+		if now.Sub(at) > lostTimeout {
+			delete(p.pending, seq)
+			p.lost()
 		}
-		p.measurementCount++
-		p.measurementsSinceGet++
-		p.mu.Unlock()
 	}
+}
 
-	return nil
+// stopped ends an ICMP run. The requests still awaiting a reply won't get one anymore, so they count
+// as lost unless the monitor is shutting down.
+func (p *Pinger) stopped(ctx context.Context) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if ctx.Err() == nil {
+		for range p.pending {
+			p.lost()
+		}
+	}
+	p.pending = make(map[int]time.Time)
+	p.pinged = nil
 }
 
-func (p *Pinger) ping(domain string) (time.Duration, error) {
-	pinger, err := probing.NewPinger(domain)
+// resolveIPAddr picks the address to ping like pro-bing does, preferring IPv4, but unlike pro-bing it
+// gives up when ctx is cancelled so a slow DNS server doesn't hold up shutting down
+func resolveIPAddr(ctx context.Context, domain string) (*net.IPAddr, error) {
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, domain)
 	if err != nil {
-		return 0, err
+		return nil, err
+	}
+	if len(addrs) == 0 {
+		return nil, fmt.Errorf("no addresses found for %s", domain)
+	}
+	for _, addr := range addrs {
+		if addr.IP.To4() != nil {
+			return &addr, nil
+		}
 	}
+	return &addrs[0], nil
+}
 
-	pinger.Count = 1
-	pinger.Timeout = 1 * time.Second
-	pinger.SetPrivileged(runtime.GOOS == "windows")
+// watchAddress resolves the domain every interval and calls restart once the pinged address is no
+// longer among its addresses. A host that rotates through a set of addresses keeps its pinger.
+func watchAddress(ctx context.Context, restart func(), domain string, pinged net.IP, interval time.Duration,
+	lookup func(ctx context.Context, host string) ([]net.IPAddr, error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		lookupCtx, cancel := context.WithTimeout(ctx, probeTimeout)
+		addrs, err := lookup(lookupCtx, domain)
+		cancel()
+		if err != nil || len(addrs) == 0 {
+			continue
+		}
+		if !slices.ContainsFunc(addrs, func(a net.IPAddr) bool { return a.IP.Equal(pinged) }) {
+			restart()
+			return
+		}
+	}
+}
+
+func (p *Pinger) Start(ctx context.Context) error {
+	if p.probe != ICMPProbe {
+		host, port, _ := p.getServer()
+		fmt.Printf("Probing %s port %d over %v every %v\n", host, port, p.probe, p.interval)
+		return runEvery(ctx, p.interval, func() {
+			host, port, useTLS := p.getServer()
+			if p.probe == RTMPProbe {
+				var tlsConfig *tls.Config
+				if useTLS {
+					tlsConfig = &tls.Config{ServerName: host}
+				}
+				p.record(rtmpHandshake(host, port, tlsConfig))
+			} else {
+				p.record(tcpConnect(host, port))
+			}
+		})
+	}
+
+	fmt.Printf("Pinging %s every %v\n", p.getDomain(), p.interval)
+	for {
+		// The pinger stops on shutdown, when the host changes or moves to another address, or when it
+		// failed, e.g. to resolve the domain
+		if err := p.runICMP(ctx); err != nil {
+			p.record(0, err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(p.interval):
+		}
+	}
+}
+
+// Follow makes a running ICMP pinger resolve its host again when the address it pings isn't among
+// addresses, the rule watchAddress uses. It is used when the DNS probe saw the host move.
+func (p *Pinger) Follow(addresses []string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.pinged == nil || p.stopRun == nil {
+		return
+	}
+	if !slices.ContainsFunc(addresses, func(a string) bool { return p.pinged.Equal(net.ParseIP(a)) }) {
+		p.stopRun()
+	}
+}
+
+// Address returns the address the ICMP pinger pings, empty while it isn't running or for other probes
+func (p *Pinger) Address() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.pinged == nil {
+		return ""
+	}
+	return p.pinged.String()
+}
 
-	err = pinger.Run()
+// runICMP pings the current domain until the context is cancelled, the domain changes or it resolves
+// to other addresses
+func (p *Pinger) runICMP(ctx context.Context) error {
+	runCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	p.mu.Lock()
+	domain := p.domain
+	p.stopRun = cancel
+	p.mu.Unlock()
+
+	addr, err := resolveIPAddr(runCtx, domain)
 	if err != nil {
-		return 0, err
+		return err
+	}
+	pinger := probing.New(domain)
+	pinger.SetIPAddr(addr)
+
+	p.mu.Lock()
+	p.pinged = addr.IP
+	p.mu.Unlock()
+	defer p.stopped(ctx)
+
+	pinger.Interval = p.interval
+	// The round-trip times are kept per interval here, pro-bing would keep all of them for the whole run
+	pinger.RecordRtts = false
+	pinger.RecordTTLs = false
+	pinger.SetPrivileged(runtime.GOOS == "windows")
+	pinger.OnSend = func(pkt *probing.Packet) {
+		p.sentEcho(pkt.Seq, time.Now())
+	}
+	pinger.OnRecv = func(pkt *probing.Packet) {
+		p.receivedEcho(pkt.Seq, pkt.Rtt)
 	}
+	// A failed send ends up in the errors column instead of the pro-bing log
+	pinger.OnSendError = func(pkt *probing.Packet, err error) {
+		p.recordError(err)
+	}
+	pinger.SetLogger(probing.NoopLogger{})
 
-	stats := pinger.Statistics()
-	if stats.PacketsRecv == 0 {
-		return 0, fmt.Errorf("no response received")
+	if net.ParseIP(domain) == nil {
+		go watchAddress(runCtx, cancel, domain, pinger.IPAddr().IP, resolveInterval, net.DefaultResolver.LookupIPAddr)
 	}
 
-	return stats.AvgRtt, nil
+	if err := pinger.RunWithContext(runCtx); err != nil && runCtx.Err() == nil {
+		return err
+	}
+	return nil
 }
@@ -1,37 +1,43 @@
 package metric
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"net"
 	"sync"
 	"testing"
 	"time"
 )
 
-func TestPinger_GetAndResetMaxRTT_ReturnsCorrectMaxValue(t *testing.T) {
-	p := &Pinger{
-		maxRTT:               150 * time.Millisecond,
-		measurementCount:     3,
-		measurementsSinceGet: 1,
+func newTestPinger(maxRTT time.Duration, count, sinceGet int) *Pinger {
+	p, _ := NewPinger(PingTarget{Name: "obs", Host: "example.com"}, time.Second)
+	if maxRTT > 0 {
+		p.sent, p.received = 1, 1
+		p.minRTT, p.maxRTT, p.sumRTT = maxRTT, maxRTT, maxRTT
 	}
+	p.measurementCount = count
+	p.measurementsSinceGet = sinceGet
+	return p
+}
+
+func TestPinger_Collect_ReturnsCorrectMaxValue(t *testing.T) {
+	p := newTestPinger(150*time.Millisecond, 3, 1)
 
-	rtt, err := p.GetAndResetMaxRTT()
+	samples, err := p.Collect()
 
 	if err != nil {
 		t.Errorf("Expected no error, got %v", err)
 	}
-	if rtt != 150*time.Millisecond {
+	if rtt := valueOf(t, samples, "obs_rtt_ms"); rtt != 150*time.Millisecond {
 		t.Errorf("Expected RTT to be 150ms, got %v", rtt)
 	}
 }
 
-func TestPinger_GetAndResetMaxRTT_ResetsValue(t *testing.T) {
-	p := &Pinger{
-		maxRTT:               150 * time.Millisecond,
-		measurementCount:     2,
-		measurementsSinceGet: 1,
-	}
+func TestPinger_Collect_ResetsValue(t *testing.T) {
+	p := newTestPinger(150*time.Millisecond, 2, 1)
 
-	_, _ = p.GetAndResetMaxRTT()
+	_, _ = p.Collect()
 
 	if p.maxRTT != 0 {
 		t.Errorf("Expected maxRTT to be reset to 0, got %v", p.maxRTT)
@@ -41,38 +47,26 @@ func TestPinger_GetAndResetMaxRTT_ResetsValue(t *testing.T) {
 	}
 }
 
-func TestPinger_GetAndResetMaxRTT_ErrorHandling(t *testing.T) {
+func TestPinger_Collect_ErrorHandling(t *testing.T) {
 	testError := fmt.Errorf("ping error")
-	p := &Pinger{
-		maxRTT:               100 * time.Millisecond,
-		lastError:            testError,
-		measurementCount:     4,
-		measurementsSinceGet: 2,
-	}
+	p := newTestPinger(100*time.Millisecond, 4, 2)
+	p.lastError = testError
 
-	rtt, err := p.GetAndResetMaxRTT()
+	samples, err := p.Collect()
 
-	if err == nil {
-		t.Error("Expected error to be returned")
-	}
 	if err != testError {
 		t.Error("Expected error pointer to match")
 	}
-	if rtt != 100*time.Millisecond {
-		t.Errorf("Expected RTT to be returned even with error, got %v", rtt)
+	if rtt := valueOf(t, samples, "obs_rtt_ms"); rtt != nil {
+		t.Errorf("Expected no RTT value when the interval had an error, got %v", rtt)
 	}
-
 	if p.lastError != nil {
-		t.Error("Expected lastError to be reset to nil after GetAndResetMaxRTT")
+		t.Error("Expected lastError to be reset to nil after Collect")
 	}
 }
 
-func TestPinger_GetAndResetMaxRTT_ConcurrentAccess(t *testing.T) {
-	p := &Pinger{
-		maxRTT:               200 * time.Millisecond,
-		measurementCount:     1,
-		measurementsSinceGet: 1,
-	}
+func TestPinger_Collect_ConcurrentAccess(t *testing.T) {
+	p := newTestPinger(200*time.Millisecond, 1, 1)
 
 	var wg sync.WaitGroup
 	iterations := 100
@@ -81,57 +75,46 @@ func TestPinger_GetAndResetMaxRTT_ConcurrentAccess(t *testing.T) {
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
-			_, _ = p.GetAndResetMaxRTT()
+			_, _ = p.Collect()
 		}()
 	}
 
 	wg.Wait()
 }
 
-func TestPinger_GetAndResetMaxRTT_ZeroValue(t *testing.T) {
-	p := &Pinger{
-		maxRTT: 0,
-	}
+func TestPinger_Collect_ZeroValue(t *testing.T) {
+	p := newTestPinger(0, 0, 0)
 
-	rtt, err := p.GetAndResetMaxRTT()
+	samples, err := p.Collect()
 
 	if err != nil {
 		t.Errorf("Expected no error, got %v", err)
 	}
-	if rtt != 0 {
-		t.Errorf("Expected RTT to be 0, got %v", rtt)
+	if rtt := valueOf(t, samples, "obs_rtt_ms"); rtt != nil {
+		t.Errorf("Expected no RTT value, got %v", rtt)
 	}
 }
 
-func TestPinger_GetAndResetMaxRTT_TracksMaximum(t *testing.T) {
-	p := &Pinger{
-		maxRTT:               50 * time.Millisecond,
-		measurementCount:     1,
-		measurementsSinceGet: 1,
-	}
+func TestPinger_Collect_TracksMaximum(t *testing.T) {
+	p := newTestPinger(50*time.Millisecond, 1, 1)
 
-	rtt1, _ := p.GetAndResetMaxRTT()
-	if rtt1 != 50*time.Millisecond {
-		t.Errorf("Expected first call to return 50ms, got %v", rtt1)
+	samples, _ := p.Collect()
+	if rtt := valueOf(t, samples, "obs_rtt_ms"); rtt != 50*time.Millisecond {
+		t.Errorf("Expected first call to return 50ms, got %v", rtt)
 	}
 
-	p.maxRTT = 200 * time.Millisecond
-	p.measurementsSinceGet = 1
+	p.record(200*time.Millisecond, nil)
 
-	rtt2, _ := p.GetAndResetMaxRTT()
-	if rtt2 != 200*time.Millisecond {
-		t.Errorf("Expected second call to return 200ms (new max), got %v", rtt2)
+	samples, _ = p.Collect()
+	if rtt := valueOf(t, samples, "obs_rtt_ms"); rtt != 200*time.Millisecond {
+		t.Errorf("Expected second call to return 200ms (new max), got %v", rtt)
 	}
 }
 
-func TestPinger_GetAndResetMaxRTT_NoNewMeasurements(t *testing.T) {
-	p := &Pinger{
-		maxRTT:               100 * time.Millisecond,
-		measurementCount:     5,
-		measurementsSinceGet: 0,
-	}
+func TestPinger_Collect_NoNewMeasurements(t *testing.T) {
+	p := newTestPinger(100*time.Millisecond, 5, 0)
 
-	rtt, err := p.GetAndResetMaxRTT()
+	samples, err := p.Collect()
 
 	if err == nil {
 		t.Error("Expected error when no new measurements collected")
@@ -139,8 +122,8 @@ func TestPinger_GetAndResetMaxRTT_NoNewMeasurements(t *testing.T) {
 	if err != nil && err.Error() != "no new measurements collected since last read" {
 		t.Errorf("Expected specific error message, got: %v", err)
 	}
-	if rtt != 0 {
-		t.Errorf("Expected RTT to be 0, got %v", rtt)
+	if rtt := valueOf(t, samples, "obs_rtt_ms"); rtt != nil {
+		t.Errorf("Expected no RTT value, got %v", rtt)
 	}
 }
 
@@ -148,7 +131,7 @@ func TestPinger_NewPinger(t *testing.T) {
 	domain := "example.com"
 	interval := 1 * time.Second
 
-	p, err := NewPinger(domain, interval)
+	p, err := NewPinger(PingTarget{Name: "cdn", Host: domain}, interval)
 
 	if err != nil {
 		t.Fatalf("NewPinger returned error: %v", err)
@@ -162,39 +145,344 @@ func TestPinger_NewPinger(t *testing.T) {
 	if p.interval != interval {
 		t.Errorf("Expected interval %v, got %v", interval, p.interval)
 	}
+	if p.probe != ICMPProbe || p.port != DefaultProbePort {
+		t.Errorf("Expected an ICMP probe with the default port, got %v port %d", p.probe, p.port)
+	}
+	if p.Name() != "cdn_ping" {
+		t.Errorf("Expected name cdn_ping, got %s", p.Name())
+	}
+	var names []string
+	for _, f := range p.Fields() {
+		names = append(names, f.Name)
+	}
+	expected := []string{"cdn_rtt_ms", "cdn_rtt_min_ms", "cdn_rtt_avg_ms", "cdn_jitter_ms", "cdn_pings_sent", "cdn_pings_received", "cdn_pings_late", "cdn_ping_loss_percent"}
+	if fmt.Sprint(names) != fmt.Sprint(expected) {
+		t.Errorf("Expected fields %v, got %v", expected, names)
+	}
 }
 
-func TestPinger_GetAndResetMaxRTT_HighRTT(t *testing.T) {
-	p := &Pinger{
-		maxRTT:               1500 * time.Millisecond,
-		measurementCount:     1,
-		measurementsSinceGet: 1,
-	}
+func TestPinger_Collect_HighRTT(t *testing.T) {
+	p := newTestPinger(1500*time.Millisecond, 1, 1)
 
-	rtt, err := p.GetAndResetMaxRTT()
+	samples, err := p.Collect()
 
 	if err != nil {
 		t.Errorf("Expected no error, got %v", err)
 	}
-	if rtt != 1500*time.Millisecond {
+	if rtt := valueOf(t, samples, "obs_rtt_ms"); rtt != 1500*time.Millisecond {
 		t.Errorf("Expected RTT to be 1500ms, got %v", rtt)
 	}
 }
 
-func TestPinger_GetAndResetMaxRTT_MultipleResets(t *testing.T) {
-	p := &Pinger{
-		maxRTT:               100 * time.Millisecond,
-		measurementCount:     1,
-		measurementsSinceGet: 1,
+func TestPinger_Collect_MultipleResets(t *testing.T) {
+	p := newTestPinger(100*time.Millisecond, 1, 1)
+
+	samples, _ := p.Collect()
+	if rtt := valueOf(t, samples, "obs_rtt_ms"); rtt != 100*time.Millisecond {
+		t.Errorf("Expected first call to return 100ms, got %v", rtt)
+	}
+
+	samples, _ = p.Collect()
+	if rtt := valueOf(t, samples, "obs_rtt_ms"); rtt != nil {
+		t.Errorf("Expected second call to return no value after reset, got %v", rtt)
+	}
+}
+
+func TestPinger_Collect_LossAndRTTStatistics(t *testing.T) {
+	p, _ := NewPinger(PingTarget{Name: "obs", Host: "example.com"}, time.Second)
+	p.record(20*time.Millisecond, nil)
+	p.record(0, errNoReply)
+	p.record(40*time.Millisecond, nil)
+	p.record(30*time.Millisecond, nil)
+
+	samples, err := p.Collect()
+
+	if err != nil {
+		t.Errorf("Expected a lost reply not to be an error, got %v", err)
+	}
+	expected := map[string]any{
+		"obs_rtt_ms":            40 * time.Millisecond,
+		"obs_rtt_min_ms":        20 * time.Millisecond,
+		"obs_rtt_avg_ms":        30 * time.Millisecond,
+		"obs_pings_sent":        4.0,
+		"obs_pings_received":    3.0,
+		"obs_ping_loss_percent": 25.0,
+	}
+	for name, value := range expected {
+		if v := valueOf(t, samples, name); v != value {
+			t.Errorf("Expected %s to be %v, got %v", name, value, v)
+		}
+	}
+}
+
+func TestPinger_Collect_AllLost(t *testing.T) {
+	p, _ := NewPinger(PingTarget{Name: "obs", Host: "example.com"}, time.Second)
+	p.record(0, errNoReply)
+	p.record(0, errNoReply)
+
+	samples, err := p.Collect()
+
+	if err != nil {
+		t.Errorf("Expected no error, got %v", err)
+	}
+	if rtt := valueOf(t, samples, "obs_rtt_ms"); rtt != nil {
+		t.Errorf("Expected no RTT value without replies, got %v", rtt)
+	}
+	if loss := valueOf(t, samples, "obs_ping_loss_percent"); loss != 100.0 {
+		t.Errorf("Expected a loss of 100%%, got %v", loss)
+	}
+}
+
+func TestPinger_Collect_Jitter(t *testing.T) {
+	tests := []struct {
+		name     string
+		rtts     []time.Duration
+		expected any
+	}{
+		{
+			name:     "single reply",
+			rtts:     []time.Duration{20 * time.Millisecond},
+			expected: time.Duration(0),
+		},
+		{
+			name:     "steady replies",
+			rtts:     []time.Duration{20 * time.Millisecond, 20 * time.Millisecond, 20 * time.Millisecond},
+			expected: time.Duration(0),
+		},
+		{
+			// |D| is 16ms twice: 16/16 = 1ms, then 1 + (16-1)/16 = 1.9375ms
+			name:     "varying replies",
+			rtts:     []time.Duration{20 * time.Millisecond, 36 * time.Millisecond, 20 * time.Millisecond},
+			expected: 1937500 * time.Nanosecond,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, _ := NewPinger(PingTarget{Name: "obs", Host: "example.com"}, time.Second)
+			for _, rtt := range tt.rtts {
+				p.record(rtt, nil)
+			}
+
+			samples, _ := p.Collect()
+			if jitter := valueOf(t, samples, "obs_jitter_ms"); jitter != tt.expected {
+				t.Errorf("Expected jitter %v, got %v", tt.expected, jitter)
+			}
+		})
+	}
+}
+
+func TestPinger_SetServer_ResetsJitter(t *testing.T) {
+	p, _ := NewPinger(PingTarget{Name: "obs", Host: "example.com"}, time.Second)
+	p.record(20*time.Millisecond, nil)
+	p.record(36*time.Millisecond, nil)
+	p.Collect()
+
+	p.SetServer("other.example.com", 0, false)
+	p.record(50*time.Millisecond, nil)
+
+	samples, _ := p.Collect()
+	if jitter := valueOf(t, samples, "obs_jitter_ms"); jitter != time.Duration(0) {
+		t.Errorf("Expected the jitter to start over for a new domain, got %v", jitter)
+	}
+}
+
+func TestPinger_Echo_MatchesRepliesBySequence(t *testing.T) {
+	p, _ := NewPinger(PingTarget{Name: "obs", Host: "example.com"}, 100*time.Millisecond)
+	now := time.Now()
+	p.sentEcho(1, now)
+	p.sentEcho(2, now.Add(100*time.Millisecond))
+	p.receivedEcho(2, 30*time.Millisecond)
+	p.receivedEcho(1, 150*time.Millisecond)
+
+	samples, err := p.Collect()
+
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	expected := map[string]any{
+		"obs_rtt_ms":            150 * time.Millisecond,
+		"obs_rtt_min_ms":        30 * time.Millisecond,
+		"obs_pings_sent":        2.0,
+		"obs_pings_received":    2.0,
+		"obs_pings_late":        0.0,
+		"obs_ping_loss_percent": 0.0,
+	}
+	for name, value := range expected {
+		if v := valueOf(t, samples, name); v != value {
+			t.Errorf("Expected %s to be %v, got %v", name, value, v)
+		}
+	}
+}
+
+func TestPinger_Echo_InFlightCountsInNextInterval(t *testing.T) {
+	p, _ := NewPinger(PingTarget{Name: "obs", Host: "example.com"}, 100*time.Millisecond)
+	p.sentEcho(1, time.Now())
+	p.receivedEcho(1, 20*time.Millisecond)
+	p.sentEcho(2, time.Now())
+
+	samples, _ := p.Collect()
+	if v := valueOf(t, samples, "obs_pings_sent"); v != 1.0 {
+		t.Errorf("Expected only the answered request in the first interval, got %v", v)
+	}
+
+	p.receivedEcho(2, 40*time.Millisecond)
+	samples, _ = p.Collect()
+	if v := valueOf(t, samples, "obs_rtt_ms"); v != 40*time.Millisecond {
+		t.Errorf("Expected the reply in the next interval, got %v", v)
+	}
+}
+
+func TestPinger_Echo_LateReply(t *testing.T) {
+	p, _ := NewPinger(PingTarget{Name: "obs", Host: "example.com"}, 100*time.Millisecond)
+	p.sentEcho(1, time.Now().Add(-2*probeTimeout))
+
+	samples, err := p.Collect()
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if v := valueOf(t, samples, "obs_pings_sent"); v != nil {
+		t.Errorf("Expected a request past the timeout to still wait for a late reply, got sent %v", v)
+	}
+
+	p.receivedEcho(1, 2*probeTimeout)
+	samples, err = p.Collect()
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	expected := map[string]any{
+		"obs_rtt_ms":            2 * probeTimeout,
+		"obs_pings_sent":        1.0,
+		"obs_pings_received":    1.0,
+		"obs_pings_late":        1.0,
+		"obs_ping_loss_percent": 0.0,
+	}
+	for name, value := range expected {
+		if v := valueOf(t, samples, name); v != value {
+			t.Errorf("Expected %s to be %v, got %v", name, value, v)
+		}
+	}
+}
+
+func TestPinger_Echo_Lost(t *testing.T) {
+	p, _ := NewPinger(PingTarget{Name: "obs", Host: "example.com"}, 100*time.Millisecond)
+	p.sentEcho(1, time.Now().Add(-lostTimeout-time.Millisecond))
+
+	samples, _ := p.Collect()
+	if v := valueOf(t, samples, "obs_ping_loss_percent"); v != 100.0 {
+		t.Errorf("Expected a request without a reply within the lost timeout to be lost, got %v", v)
+	}
+
+	p.receivedEcho(1, lostTimeout+time.Second)
+	p.sentEcho(2, time.Now())
+	p.receivedEcho(2, 10*time.Millisecond)
+	samples, _ = p.Collect()
+	if v := valueOf(t, samples, "obs_pings_received"); v != 1.0 {
+		t.Errorf("Expected the reply to the lost request to be ignored, got received %v", v)
+	}
+	if v := valueOf(t, samples, "obs_pings_late"); v != 0.0 {
+		t.Errorf("Expected no late replies, got %v", v)
+	}
+}
+
+func TestPinger_Follow(t *testing.T) {
+	tests := []struct {
+		name        string
+		addresses   []string
+		wantStopped bool
+	}{
+		{name: "pinged address kept", addresses: []string{"192.0.2.2", "192.0.2.1"}},
+		{name: "pinged address gone", addresses: []string{"198.51.100.7"}, wantStopped: true},
 	}
 
-	rtt1, _ := p.GetAndResetMaxRTT()
-	if rtt1 != 100*time.Millisecond {
-		t.Errorf("Expected first call to return 100ms, got %v", rtt1)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, _ := NewPinger(PingTarget{Name: "obs", Host: "example.com"}, time.Second)
+			stopped := false
+			p.stopRun = func() { stopped = true }
+			p.pinged = net.ParseIP("192.0.2.1")
+
+			p.Follow(tt.addresses)
+
+			if stopped != tt.wantStopped {
+				t.Errorf("Expected the running pinger to be stopped %v, got %v", tt.wantStopped, stopped)
+			}
+		})
 	}
+}
+
+func TestPinger_Stopped_CountsPendingAsLost(t *testing.T) {
+	p, _ := NewPinger(PingTarget{Name: "obs", Host: "example.com"}, time.Second)
+	p.sentEcho(1, time.Now())
+	p.sentEcho(2, time.Now())
+	p.receivedEcho(1, 10*time.Millisecond)
+
+	p.stopped(context.Background())
+	p.receivedEcho(2, 20*time.Millisecond)
+
+	samples, _ := p.Collect()
+	if v := valueOf(t, samples, "obs_pings_sent"); v != 2.0 {
+		t.Errorf("Expected the pending request to count as sent, got %v", v)
+	}
+	if v := valueOf(t, samples, "obs_pings_received"); v != 1.0 {
+		t.Errorf("Expected the pending request to count as lost, got received %v", v)
+	}
+}
 
-	rtt2, _ := p.GetAndResetMaxRTT()
-	if rtt2 != 0 {
-		t.Errorf("Expected second call to return 0 after reset, got %v", rtt2)
+func TestWatchAddress(t *testing.T) {
+	pinged := net.ParseIP("192.0.2.1")
+	tests := []struct {
+		name        string
+		answers     [][]string
+		wantRestart bool
+	}{
+		{
+			name:    "address kept",
+			answers: [][]string{{"192.0.2.1"}, {"192.0.2.2", "192.0.2.1"}},
+		},
+		{
+			name:        "address moved",
+			answers:     [][]string{{"192.0.2.1"}, {"198.51.100.7"}},
+			wantRestart: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			lookups := make(chan struct{}, len(tt.answers))
+			restarted := make(chan struct{})
+			answers := tt.answers
+			lookup := func(ctx context.Context, host string) ([]net.IPAddr, error) {
+				defer func() { lookups <- struct{}{} }()
+				if len(answers) == 0 {
+					return nil, errors.New("no more answers")
+				}
+				var ips []net.IPAddr
+				for _, a := range answers[0] {
+					ips = append(ips, net.IPAddr{IP: net.ParseIP(a)})
+				}
+				answers = answers[1:]
+				return ips, nil
+			}
+
+			go watchAddress(ctx, func() { close(restarted) }, "ingest.example.com", pinged, 5*time.Millisecond, lookup)
+
+			for range tt.answers {
+				<-lookups
+			}
+			select {
+			case <-restarted:
+				if !tt.wantRestart {
+					t.Error("Expected no restart while the address is still resolved")
+				}
+			case <-time.After(50 * time.Millisecond):
+				if tt.wantRestart {
+					t.Error("Expected a restart once the address moved")
+				}
+			}
+		})
 	}
 }
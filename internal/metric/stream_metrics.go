@@ -1,14 +1,41 @@
 package metric
 
 import (
+	"context"
 	"fmt"
-	"sync"
 	"time"
 
 	"github.com/andreykaipov/goobs"
+	"github.com/andreykaipov/goobs/api/requests/stream"
+)
+
+var streamMetricsFields = []Field{
+	{Name: "stream_active", Type: BoolValue, Kind: Gauge},
+	{Name: "output_bytes", Type: FloatValue, Kind: Counter},
+	{Name: "output_skipped_frames", Type: FloatValue, Kind: Counter},
+	{Name: "output_frames", Type: FloatValue, Kind: Counter},
+	{Name: "output_congestion_max", Type: FloatValue, Kind: Gauge, Precision: 2},
+	{Name: "output_congestion_avg", Type: FloatValue, Kind: Gauge, Precision: 2},
+	{Name: "output_reconnecting", Type: BoolValue, Kind: Gauge},
+	{Name: "output_duration_ms", Type: FloatValue, Kind: Gauge},
+	{Name: "output_timecode", Type: StringValue, Kind: Gauge},
+	{Name: "output_kbps", Type: FloatValue, Kind: Gauge},
+	{Name: "output_fps", Type: FloatValue, Kind: Gauge, Precision: 2},
+	{Name: "output_skipped_percent", Type: FloatValue, Kind: Gauge, Precision: 2},
+	{Name: "output_bitrate_ratio", Type: FloatValue, Kind: Gauge, Precision: 2},
+	{Name: "output_bitrate_low", Type: BoolValue, Kind: Gauge},
+	{Name: "output_window_ms", Type: FloatValue, Kind: Gauge},
+}
+
+const (
+	// DefaultLowBitrateFraction is the share of the configured bitrate below which the stream counts as low
+	DefaultLowBitrateFraction = 0.8
+	// DefaultLowBitrateDuration is how long the bitrate has to stay low to be flagged
+	DefaultLowBitrateDuration = 5 * time.Second
 )
 
 type StreamMetrics struct {
+	intervalTracker
 	client               *goobs.Client
 	maxOutputBytes       float64
 	prevOutputBytes      float64
@@ -17,128 +44,249 @@ type StreamMetrics struct {
 	maxTotalFrames       float64
 	prevTotalFrames      float64
 	lastActive           bool
-	lastError            error
-	measurementCount     int
-	measurementsSinceGet int
-	mu                   sync.Mutex
+	maxCongestion        float64
+	sumCongestion        float64
+	reconnecting         bool
+	lastDuration         float64
+	lastTimecode         string
+	countersDuration     float64 // stream time in ms at which OBS reported the max counters
+	prevCountersDuration float64
+	targetBitrate        float64
+	lowBitrateFor        float64 // stream time in ms the bitrate has been low
+	lowBitrate           bool
+	lowFraction          float64
+	lowDuration          time.Duration
 	interval             time.Duration
+	onEvent              func(Event)
 }
 
-type StreamMetricsData struct {
-	Timestamp           time.Time
-	Active              bool
-	OutputBytes         float64
-	OutputSkippedFrames float64
-	OutputFrames        float64
-	Error               error
-}
+// NewStreamMetrics creates the stream collector, zero values for the low bitrate fraction and duration
+// select the defaults. When the bitrate starts being low onEvent receives a LowBitrate event, it may be nil.
+func NewStreamMetrics(client *goobs.Client, interval time.Duration, lowBitrateFraction float64, lowBitrateDuration time.Duration,
+	onEvent func(Event)) (*StreamMetrics, error) {
+	if lowBitrateFraction == 0 {
+		lowBitrateFraction = DefaultLowBitrateFraction
+	}
+	if lowBitrateDuration == 0 {
+		lowBitrateDuration = DefaultLowBitrateDuration
+	}
 
-func NewStreamMetrics(client *goobs.Client, interval time.Duration) (*StreamMetrics, error) {
 	return &StreamMetrics{
-		client:   client,
-		interval: interval,
+		client:      client,
+		interval:    interval,
+		lowFraction: lowBitrateFraction,
+		lowDuration: lowBitrateDuration,
+		onEvent:     onEvent,
 	}, nil
 }
 
-func (s *StreamMetrics) GetAndResetMaxValues() StreamMetricsData {
+// SetTargetBitrate sets the video bitrate in kbps the stream is configured with, 0 when it isn't known
+func (s *StreamMetrics) SetTargetBitrate(kbps float64) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	maxBytes := s.maxOutputBytes
-	maxSkipped := s.maxSkippedFrames
-	active := s.lastActive
-	err := s.lastError
+	s.targetBitrate = kbps
+	s.lowBitrateFor = 0
+	s.lowBitrate = false
+}
+
+func (s *StreamMetrics) Name() string {
+	return "stream"
+}
+
+func (s *StreamMetrics) Fields() []Field {
+	return streamMetricsFields
+}
+
+func (s *StreamMetrics) Collect() ([]Sample, error) {
+	samples, event, err := s.collect()
+	if event != nil && s.onEvent != nil {
+		s.onEvent(*event)
+	}
+	return samples, err
+}
+
+// collect builds the row of the interval, together with the event to report outside the lock
+func (s *StreamMetrics) collect() ([]Sample, *Event, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.detached {
+		s.reset()
+		return nil, nil, nil
+	}
 
 	if s.measurementCount < 2 {
-		maxTotalFrames := s.maxTotalFrames
-		s.prevOutputBytes = maxBytes
-		s.prevSkippedFrames = maxSkipped
-		s.prevTotalFrames = maxTotalFrames
+		s.prevOutputBytes = s.maxOutputBytes
+		s.prevSkippedFrames = s.maxSkippedFrames
+		s.prevTotalFrames = s.maxTotalFrames
+		s.prevCountersDuration = s.countersDuration
 		s.maxOutputBytes = 0
 		s.maxSkippedFrames = 0
 		s.maxTotalFrames = 0
-		s.lastError = nil
-		s.measurementsSinceGet = 0
-		return StreamMetricsData{
-			Timestamp:           time.Now(),
-			Active:              active,
-			OutputBytes:         0,
-			OutputSkippedFrames: 0,
-			OutputFrames:        0,
-			Error:               err,
-		}
+		samples := s.samples(0, 0, 0)
+		s.resetCongestion()
+		return samples, nil, s.reset()
 	}
 
 	if s.measurementsSinceGet == 0 {
-		return StreamMetricsData{
-			Timestamp:           time.Now(),
-			Active:              active,
-			OutputBytes:         0,
-			OutputSkippedFrames: 0,
-			OutputFrames:        0,
-			Error:               fmt.Errorf("no new measurements collected since last read"),
-		}
+		return s.samples(0, 0, 0), nil, errNoNewMeasurements
 	}
 
-	maxTotalFrames := s.maxTotalFrames
-	bytesDelta := maxBytes - s.prevOutputBytes
-	skippedDelta := maxSkipped - s.prevSkippedFrames
-	framesDelta := maxTotalFrames - s.prevTotalFrames
-	s.prevOutputBytes = maxBytes
-	s.prevSkippedFrames = maxSkipped
-	s.prevTotalFrames = maxTotalFrames
-	s.lastError = nil
-	s.measurementsSinceGet = 0
-
-	return StreamMetricsData{
-		Timestamp:           time.Now(),
-		Active:              active,
-		OutputBytes:         bytesDelta,
-		OutputSkippedFrames: skippedDelta,
-		OutputFrames:        framesDelta,
-		Error:               err,
+	bytesDelta := s.maxOutputBytes - s.prevOutputBytes
+	skippedDelta := s.maxSkippedFrames - s.prevSkippedFrames
+	framesDelta := s.maxTotalFrames - s.prevTotalFrames
+	s.prevOutputBytes = s.maxOutputBytes
+	s.prevSkippedFrames = s.maxSkippedFrames
+	s.prevTotalFrames = s.maxTotalFrames
+	durationDelta := s.countersDuration - s.prevCountersDuration
+	s.prevCountersDuration = s.countersDuration
+
+	rates, event := s.rates(bytesDelta, skippedDelta, framesDelta, durationDelta)
+	samples := append(s.samples(bytesDelta, skippedDelta, framesDelta), rates...)
+	s.resetCongestion()
+	return samples, event, s.reset()
+}
+
+// samples builds the row of an interval, the caller must hold mu
+func (s *StreamMetrics) samples(outputBytes, skippedFrames, totalFrames float64) []Sample {
+	var avgCongestion float64
+	if s.measurementsSinceGet > 0 {
+		avgCongestion = s.sumCongestion / float64(s.measurementsSinceGet)
+	}
+	return []Sample{
+		{Field: streamMetricsFields[0], Value: s.lastActive},
+		{Field: streamMetricsFields[1], Value: outputBytes},
+		{Field: streamMetricsFields[2], Value: skippedFrames},
+		{Field: streamMetricsFields[3], Value: totalFrames},
+		{Field: streamMetricsFields[4], Value: s.maxCongestion},
+		{Field: streamMetricsFields[5], Value: avgCongestion},
+		{Field: streamMetricsFields[6], Value: s.reconnecting},
+		{Field: streamMetricsFields[7], Value: s.lastDuration},
+		{Field: streamMetricsFields[8], Value: s.lastTimecode},
 	}
 }
 
-func (s *StreamMetrics) updateMetrics(outputActive bool, outputBytes, skippedFrames, totalFrames float64) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+// rates turns the deltas of an interval into kbps, fps and the skipped frame percentage. They are
+// based on the stream time OBS reports with the counters, so they don't depend on the writer
+// interval and a late poll doesn't skew them. The stream time they cover is returned as well.
+// With a configured bitrate the ratio to it is added, together with whether the ratio stayed
+// below the low fraction for the low duration, and a LowBitrate event when it just started to.
+// The caller must hold mu.
+func (s *StreamMetrics) rates(bytes, skippedFrames, totalFrames, durationMs float64) ([]Sample, *Event) {
+	if !s.lastActive || durationMs <= 0 {
+		s.lowBitrateFor = 0
+		s.lowBitrate = false
+		return nil, nil
+	}
 
-	s.lastActive = outputActive
-	if outputBytes > s.maxOutputBytes {
-		s.maxOutputBytes = outputBytes
+	// Bytes per millisecond times 8 is kilobits per second
+	kbps := bytes * 8 / durationMs
+	samples := []Sample{
+		{Field: streamMetricsFields[9], Value: kbps},
+		{Field: streamMetricsFields[10], Value: totalFrames * 1000 / durationMs},
+		{Field: streamMetricsFields[14], Value: durationMs},
 	}
-	if skippedFrames > s.maxSkippedFrames {
-		s.maxSkippedFrames = skippedFrames
+	if totalFrames > 0 {
+		samples = append(samples, Sample{Field: streamMetricsFields[11], Value: skippedFrames / totalFrames * 100})
 	}
-	if totalFrames > s.maxTotalFrames {
-		s.maxTotalFrames = totalFrames
+	if s.targetBitrate <= 0 {
+		return samples, nil
 	}
-	s.measurementCount++
-	s.measurementsSinceGet++
+
+	ratio := kbps / s.targetBitrate
+	if ratio < s.lowFraction {
+		s.lowBitrateFor += durationMs
+	} else {
+		s.lowBitrateFor = 0
+	}
+
+	var event *Event
+	low := s.lowBitrateFor >= float64(s.lowDuration.Milliseconds())
+	if low && !s.lowBitrate {
+		event = &Event{
+			Time:   time.Now(),
+			Type:   "LowBitrate",
+			Detail: fmt.Sprintf("%.0f kbps below %.0f%% of %.0f kbps for %v", kbps, s.lowFraction*100, s.targetBitrate, s.lowDuration),
+		}
+	}
+	s.lowBitrate = low
+
+	return append(samples,
+		Sample{Field: streamMetricsFields[12], Value: ratio},
+		Sample{Field: streamMetricsFields[13], Value: low},
+	), event
 }
 
-func (s *StreamMetrics) recordError(err error) {
+// resetCongestion starts the congestion and reconnect aggregation of a new interval, the caller must hold mu
+func (s *StreamMetrics) resetCongestion() {
+	s.maxCongestion = 0
+	s.sumCongestion = 0
+	s.reconnecting = false
+}
+
+// SetClient binds a new OBS connection. OBS may have restarted in the meantime and reset its
+// counters, so the deltas start again from a fresh baseline.
+func (s *StreamMetrics) SetClient(client *goobs.Client) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	s.lastError = err
+
+	s.client = client
+	s.maxOutputBytes = 0
+	s.maxSkippedFrames = 0
+	s.maxTotalFrames = 0
+	s.lastActive = false
+	s.lastDuration = 0
+	s.lastTimecode = ""
+	s.countersDuration = 0
+	s.prevCountersDuration = 0
+	s.lowBitrateFor = 0
+	s.lowBitrate = false
+	s.resetCongestion()
+	s.restart(client == nil)
 }
 
-func (s *StreamMetrics) Start() error {
-	ticker := time.NewTicker(s.interval)
-	defer ticker.Stop()
+func (s *StreamMetrics) getClient() *goobs.Client {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.client
+}
+
+// updateMetrics records a GetStreamStatus response. Congestion keeps the highest and the summed value
+// for the average, a reconnect at any point of the interval marks the whole interval as reconnecting.
+func (s *StreamMetrics) updateMetrics(status *stream.GetStreamStatusResponse) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 
-	for range ticker.C {
-		status, err := s.client.Stream.GetStreamStatus()
+	s.lastActive = status.OutputActive
+	if status.OutputBytes >= s.maxOutputBytes {
+		s.countersDuration = status.OutputDuration
+	}
+	s.maxOutputBytes = max(s.maxOutputBytes, status.OutputBytes)
+	s.maxSkippedFrames = max(s.maxSkippedFrames, status.OutputSkippedFrames)
+	s.maxTotalFrames = max(s.maxTotalFrames, status.OutputTotalFrames)
+	s.maxCongestion = max(s.maxCongestion, status.OutputCongestion)
+	s.sumCongestion += status.OutputCongestion
+	s.reconnecting = s.reconnecting || status.OutputReconnecting
+	s.lastDuration = status.OutputDuration
+	s.lastTimecode = status.OutputTimecode
+	s.measured()
+}
+
+func (s *StreamMetrics) Start(ctx context.Context) error {
+	return runEvery(ctx, s.interval, func() {
+		client := s.getClient()
+		if client == nil {
+			return
+		}
 
+		status, err := client.Stream.GetStreamStatus()
 		if err != nil {
 			s.recordError(err)
 			fmt.Printf("Error getting stream status: %v\n", err)
-			continue
+			return
 		}
 
-		s.updateMetrics(status.OutputActive, status.OutputBytes, status.OutputSkippedFrames, status.OutputTotalFrames)
-	}
-
-	return nil
+		s.updateMetrics(status)
+	})
 }
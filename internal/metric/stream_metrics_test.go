@@ -5,44 +5,45 @@ import (
 	"sync"
 	"testing"
 	"time"
+
+	"github.com/andreykaipov/goobs"
+	"github.com/andreykaipov/goobs/api/requests/stream"
 )
 
-func TestStreamMetrics_GetAndResetMaxValues_NoMeasurements(t *testing.T) {
-	sm := &StreamMetrics{
-		measurementCount: 0,
-	}
+func TestStreamMetrics_Collect_NoMeasurements(t *testing.T) {
+	sm := &StreamMetrics{}
 
-	data := sm.GetAndResetMaxValues()
+	samples, _ := sm.Collect()
 
-	if data.OutputBytes != 0 {
-		t.Errorf("Expected OutputBytes to be 0, got %f", data.OutputBytes)
+	if v := valueOf(t, samples, "output_bytes"); v != 0.0 {
+		t.Errorf("Expected output_bytes to be 0, got %v", v)
 	}
-	if data.OutputSkippedFrames != 0 {
-		t.Errorf("Expected OutputSkippedFrames to be 0, got %f", data.OutputSkippedFrames)
+	if v := valueOf(t, samples, "output_skipped_frames"); v != 0.0 {
+		t.Errorf("Expected output_skipped_frames to be 0, got %v", v)
 	}
-	if data.OutputFrames != 0 {
-		t.Errorf("Expected OutputFrames to be 0, got %f", data.OutputFrames)
+	if v := valueOf(t, samples, "output_frames"); v != 0.0 {
+		t.Errorf("Expected output_frames to be 0, got %v", v)
 	}
 }
 
-func TestStreamMetrics_GetAndResetMaxValues_OneMeasurement(t *testing.T) {
+func TestStreamMetrics_Collect_OneMeasurement(t *testing.T) {
 	sm := &StreamMetrics{
 		maxOutputBytes:   1000.0,
 		maxSkippedFrames: 10.0,
 		maxTotalFrames:   100.0,
-		measurementCount: 1,
 	}
+	sm.measurementCount = 1
 
-	data := sm.GetAndResetMaxValues()
+	samples, _ := sm.Collect()
 
-	if data.OutputBytes != 0 {
-		t.Errorf("Expected OutputBytes to be 0 (not enough measurements for delta), got %f", data.OutputBytes)
+	if v := valueOf(t, samples, "output_bytes"); v != 0.0 {
+		t.Errorf("Expected output_bytes to be 0 (not enough measurements for delta), got %v", v)
 	}
-	if data.OutputSkippedFrames != 0 {
-		t.Errorf("Expected OutputSkippedFrames to be 0, got %f", data.OutputSkippedFrames)
+	if v := valueOf(t, samples, "output_skipped_frames"); v != 0.0 {
+		t.Errorf("Expected output_skipped_frames to be 0, got %v", v)
 	}
-	if data.OutputFrames != 0 {
-		t.Errorf("Expected OutputFrames to be 0, got %f", data.OutputFrames)
+	if v := valueOf(t, samples, "output_frames"); v != 0.0 {
+		t.Errorf("Expected output_frames to be 0, got %v", v)
 	}
 
 	if sm.prevOutputBytes != 1000.0 {
@@ -50,33 +51,33 @@ func TestStreamMetrics_GetAndResetMaxValues_OneMeasurement(t *testing.T) {
 	}
 }
 
-func TestStreamMetrics_GetAndResetMaxValues_MultipleMeasurements(t *testing.T) {
+func TestStreamMetrics_Collect_MultipleMeasurements(t *testing.T) {
 	sm := &StreamMetrics{
-		prevOutputBytes:      1000.0,
-		prevSkippedFrames:    10.0,
-		prevTotalFrames:      100.0,
-		maxOutputBytes:       2500.0,
-		maxSkippedFrames:     25.0,
-		maxTotalFrames:       250.0,
-		measurementCount:     5,
-		measurementsSinceGet: 3,
+		prevOutputBytes:   1000.0,
+		prevSkippedFrames: 10.0,
+		prevTotalFrames:   100.0,
+		maxOutputBytes:    2500.0,
+		maxSkippedFrames:  25.0,
+		maxTotalFrames:    250.0,
 	}
+	sm.measurementCount = 5
+	sm.measurementsSinceGet = 3
 
-	data := sm.GetAndResetMaxValues()
+	samples, _ := sm.Collect()
 
 	expectedBytes := 2500.0 - 1000.0
-	if data.OutputBytes != expectedBytes {
-		t.Errorf("Expected OutputBytes to be %f, got %f", expectedBytes, data.OutputBytes)
+	if v := valueOf(t, samples, "output_bytes"); v != expectedBytes {
+		t.Errorf("Expected output_bytes to be %f, got %v", expectedBytes, v)
 	}
 
 	expectedSkipped := 25.0 - 10.0
-	if data.OutputSkippedFrames != expectedSkipped {
-		t.Errorf("Expected OutputSkippedFrames to be %f, got %f", expectedSkipped, data.OutputSkippedFrames)
+	if v := valueOf(t, samples, "output_skipped_frames"); v != expectedSkipped {
+		t.Errorf("Expected output_skipped_frames to be %f, got %v", expectedSkipped, v)
 	}
 
 	expectedFrames := 250.0 - 100.0
-	if data.OutputFrames != expectedFrames {
-		t.Errorf("Expected OutputFrames to be %f, got %f", expectedFrames, data.OutputFrames)
+	if v := valueOf(t, samples, "output_frames"); v != expectedFrames {
+		t.Errorf("Expected output_frames to be %f, got %v", expectedFrames, v)
 	}
 
 	if sm.prevOutputBytes != 2500.0 {
@@ -90,38 +91,38 @@ func TestStreamMetrics_GetAndResetMaxValues_MultipleMeasurements(t *testing.T) {
 	}
 }
 
-func TestStreamMetrics_GetAndResetMaxValues_MaxValueTracking(t *testing.T) {
+func TestStreamMetrics_Collect_MaxValueTracking(t *testing.T) {
 	sm := &StreamMetrics{
-		prevOutputBytes:      1000.0,
-		maxOutputBytes:       3000.0,
-		measurementCount:     3,
-		measurementsSinceGet: 2,
+		prevOutputBytes: 1000.0,
+		maxOutputBytes:  3000.0,
 	}
+	sm.measurementCount = 3
+	sm.measurementsSinceGet = 2
 
-	data1 := sm.GetAndResetMaxValues()
+	samples, _ := sm.Collect()
 	expectedDelta1 := 3000.0 - 1000.0
-	if data1.OutputBytes != expectedDelta1 {
-		t.Errorf("Expected first call to return delta %f, got %f", expectedDelta1, data1.OutputBytes)
+	if v := valueOf(t, samples, "output_bytes"); v != expectedDelta1 {
+		t.Errorf("Expected first call to return delta %f, got %v", expectedDelta1, v)
 	}
 
 	sm.maxOutputBytes = 3500.0
 	sm.measurementCount = 3
 	sm.measurementsSinceGet = 1
 
-	data2 := sm.GetAndResetMaxValues()
+	samples, _ = sm.Collect()
 	expectedDelta2 := 3500.0 - 3000.0
-	if data2.OutputBytes != expectedDelta2 {
-		t.Errorf("Expected second call to return delta %f, got %f", expectedDelta2, data2.OutputBytes)
+	if v := valueOf(t, samples, "output_bytes"); v != expectedDelta2 {
+		t.Errorf("Expected second call to return delta %f, got %v", expectedDelta2, v)
 	}
 }
 
-func TestStreamMetrics_GetAndResetMaxValues_ConcurrentAccess(t *testing.T) {
+func TestStreamMetrics_Collect_ConcurrentAccess(t *testing.T) {
 	sm := &StreamMetrics{
-		prevOutputBytes:      1000.0,
-		maxOutputBytes:       2000.0,
-		measurementCount:     2,
-		measurementsSinceGet: 1,
+		prevOutputBytes: 1000.0,
+		maxOutputBytes:  2000.0,
 	}
+	sm.measurementCount = 2
+	sm.measurementsSinceGet = 1
 
 	var wg sync.WaitGroup
 	iterations := 100
@@ -130,7 +131,7 @@ func TestStreamMetrics_GetAndResetMaxValues_ConcurrentAccess(t *testing.T) {
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
-			_ = sm.GetAndResetMaxValues()
+			_, _ = sm.Collect()
 		}()
 	}
 
@@ -140,7 +141,7 @@ func TestStreamMetrics_GetAndResetMaxValues_ConcurrentAccess(t *testing.T) {
 func TestStreamMetrics_NewStreamMetrics(t *testing.T) {
 	interval := 100 * time.Millisecond
 
-	sm, err := NewStreamMetrics(nil, interval)
+	sm, err := NewStreamMetrics(nil, interval, 0, 0, nil)
 
 	if err != nil {
 		t.Fatalf("NewStreamMetrics returned error: %v", err)
@@ -151,61 +152,79 @@ func TestStreamMetrics_NewStreamMetrics(t *testing.T) {
 	if sm.interval != interval {
 		t.Errorf("Expected interval %v, got %v", interval, sm.interval)
 	}
+	if sm.Name() != "stream" {
+		t.Errorf("Expected name stream, got %s", sm.Name())
+	}
 }
 
-func TestStreamMetrics_ErrorHandlingDuringCollection(t *testing.T) {
-	sm := &StreamMetrics{
-		maxOutputBytes:       1000.0,
-		measurementCount:     5,
-		measurementsSinceGet: 3,
-	}
+func TestStreamMetrics_Fields_KindsAndTypes(t *testing.T) {
+	sm := &StreamMetrics{}
 
-	testError := fmt.Errorf("stream status error")
+	for _, f := range sm.Fields() {
+		switch f.Name {
+		case "stream_active", "output_reconnecting", "output_bitrate_low":
+			if f.Type != BoolValue || f.Kind != Gauge {
+				t.Errorf("Expected %s to be a boolean gauge, got %+v", f.Name, f)
+			}
+		case "output_congestion_max", "output_congestion_avg", "output_duration_ms", "output_kbps", "output_fps",
+			"output_skipped_percent", "output_bitrate_ratio", "output_window_ms":
+			if f.Type != FloatValue || f.Kind != Gauge {
+				t.Errorf("Expected %s to be a float gauge, got %+v", f.Name, f)
+			}
+		case "output_timecode":
+			if f.Type != StringValue || f.Kind != Gauge {
+				t.Errorf("Expected %s to be a string gauge, got %+v", f.Name, f)
+			}
+		default:
+			if f.Type != FloatValue || f.Kind != Counter {
+				t.Errorf("Expected %s to be a float counter, got %+v", f.Name, f)
+			}
+		}
+	}
+}
 
-	sm.mu.Lock()
-	sm.lastError = testError
-	sm.mu.Unlock()
+func TestStreamMetrics_ErrorHandlingDuringCollection(t *testing.T) {
+	sm := &StreamMetrics{maxOutputBytes: 1000.0}
+	sm.measurementCount = 5
+	sm.measurementsSinceGet = 3
 
-	sm.mu.Lock()
-	if sm.lastError != testError {
-		t.Error("Expected lastError to be set")
-	}
-	sm.mu.Unlock()
+	testError := fmt.Errorf("stream status error")
+	sm.recordError(testError)
 
-	data := sm.GetAndResetMaxValues()
-	if data.Error != testError {
-		t.Error("Expected error to be returned in data")
+	_, err := sm.Collect()
+	if err != testError {
+		t.Error("Expected error to be returned from Collect")
 	}
 }
 
-func TestStreamMetrics_GetAndResetMaxValues_NoNewMeasurements(t *testing.T) {
+func TestStreamMetrics_Collect_NoNewMeasurements(t *testing.T) {
 	sm := &StreamMetrics{
-		prevOutputBytes:      1000.0,
-		prevSkippedFrames:    10.0,
-		prevTotalFrames:      100.0,
-		maxOutputBytes:       1000.0,
-		maxSkippedFrames:     10.0,
-		maxTotalFrames:       100.0,
-		measurementCount:     5,
-		measurementsSinceGet: 0,
+		prevOutputBytes:   1000.0,
+		prevSkippedFrames: 10.0,
+		prevTotalFrames:   100.0,
+		maxOutputBytes:    1000.0,
+		maxSkippedFrames:  10.0,
+		maxTotalFrames:    100.0,
 	}
+	sm.measurementCount = 5
+	sm.measurementsSinceGet = 0
 
-	data := sm.GetAndResetMaxValues()
+	samples, err := sm.Collect()
 
-	if data.Error == nil {
-		t.Error("Expected error when no new measurements collected")
+	if err == nil {
+		t.Fatal("Expected error when no new measurements collected")
 	}
-	if data.Error.Error() != "no new measurements collected since last read" {
-		t.Errorf("Expected specific error message, got: %v", data.Error)
+	if err.Error() != "no new measurements collected since last read" {
+		t.Errorf("Expected specific error message, got: %v", err)
 	}
-	if data.OutputBytes != 0 {
-		t.Errorf("Expected OutputBytes to be 0, got %f", data.OutputBytes)
+	if v := valueOf(t, samples, "output_bytes"); v != 0.0 {
+		t.Errorf("Expected output_bytes to be 0, got %v", v)
 	}
-	if data.OutputSkippedFrames != 0 {
-		t.Errorf("Expected OutputSkippedFrames to be 0, got %f", data.OutputSkippedFrames)
+	if v := valueOf(t, samples, "output_skipped_frames"); v != 0.0 {
+		t.Errorf("Expected output_skipped_frames to be 0, got %v", v)
 	}
-	if data.OutputFrames != 0 {
-		t.Errorf("Expected OutputFrames to be 0, got %f", data.OutputFrames)
+	if v := valueOf(t, samples, "output_frames"); v != 0.0 {
+		t.Errorf("Expected output_frames to be 0, got %v", v)
 	}
 }
 
@@ -252,9 +271,9 @@ func TestStreamMetrics_ActiveStateTracking(t *testing.T) {
 			sm.lastActive = tt.newActive
 			sm.mu.Unlock()
 
-			data := sm.GetAndResetMaxValues()
-			if data.Active != tt.expectedActive {
-				t.Errorf("Expected Active to be %v, got %v", tt.expectedActive, data.Active)
+			samples, _ := sm.Collect()
+			if v := valueOf(t, samples, "stream_active"); v != tt.expectedActive {
+				t.Errorf("Expected stream_active to be %v, got %v", tt.expectedActive, v)
 			}
 		})
 	}
@@ -349,10 +368,15 @@ func TestStreamMetrics_UpdateMetrics(t *testing.T) {
 				maxOutputBytes:   tt.initialMaxBytes,
 				maxSkippedFrames: tt.initialMaxSkip,
 				maxTotalFrames:   tt.initialMaxFrames,
-				measurementCount: tt.initialMeasureCount,
 			}
+			sm.measurementCount = tt.initialMeasureCount
 
-			sm.updateMetrics(tt.outputActive, tt.newBytes, tt.newSkip, tt.newFrames)
+			sm.updateMetrics(&stream.GetStreamStatusResponse{
+				OutputActive:        tt.outputActive,
+				OutputBytes:         tt.newBytes,
+				OutputSkippedFrames: tt.newSkip,
+				OutputTotalFrames:   tt.newFrames,
+			})
 
 			if sm.maxOutputBytes != tt.expectedMaxBytes {
 				t.Errorf("Expected maxOutputBytes %f, got %f", tt.expectedMaxBytes, sm.maxOutputBytes)
@@ -385,8 +409,190 @@ func TestStreamMetrics_RecordError(t *testing.T) {
 	}
 	sm.mu.Unlock()
 
-	data := sm.GetAndResetMaxValues()
-	if data.Error != testError {
-		t.Error("Expected error to be returned in GetAndResetMaxValues")
+	_, err := sm.Collect()
+	if err != testError {
+		t.Error("Expected error to be returned from Collect")
+	}
+}
+
+func TestStreamMetrics_SetClient_StartsNewBaseline(t *testing.T) {
+	sm := &StreamMetrics{}
+	sm.updateMetrics(&stream.GetStreamStatusResponse{OutputActive: true, OutputBytes: 5000, OutputSkippedFrames: 10, OutputTotalFrames: 600})
+	sm.Collect()
+	sm.updateMetrics(&stream.GetStreamStatusResponse{OutputActive: true, OutputBytes: 8000, OutputSkippedFrames: 12, OutputTotalFrames: 900})
+	sm.Collect()
+
+	sm.SetClient(nil)
+	samples, _ := sm.Collect()
+	if len(samples) != 0 {
+		t.Errorf("Expected no samples while detached, got %v", samples)
+	}
+
+	// OBS restarted, so its counters start from zero again
+	sm.SetClient(&goobs.Client{})
+	sm.updateMetrics(&stream.GetStreamStatusResponse{OutputActive: true, OutputBytes: 100, OutputSkippedFrames: 0, OutputTotalFrames: 60})
+	samples, _ = sm.Collect()
+	if bytes := valueOf(t, samples, "output_bytes"); bytes != 0.0 {
+		t.Errorf("Expected output_bytes to be 0 for the new baseline, got %v", bytes)
+	}
+
+	sm.updateMetrics(&stream.GetStreamStatusResponse{OutputActive: true, OutputBytes: 400, OutputSkippedFrames: 1, OutputTotalFrames: 120})
+	samples, _ = sm.Collect()
+	if bytes := valueOf(t, samples, "output_bytes"); bytes != 300.0 {
+		t.Errorf("Expected output_bytes delta to be 300, got %v", bytes)
+	}
+}
+
+func TestStreamMetrics_Collect_CongestionAndReconnecting(t *testing.T) {
+	sm := &StreamMetrics{}
+	statuses := []*stream.GetStreamStatusResponse{
+		{OutputActive: true, OutputCongestion: 0.1, OutputDuration: 61000, OutputTimecode: "00:01:01.000"},
+		{OutputActive: true, OutputCongestion: 0.5, OutputReconnecting: true, OutputDuration: 62000, OutputTimecode: "00:01:02.000"},
+		{OutputActive: true, OutputCongestion: 0.3, OutputDuration: 63000, OutputTimecode: "00:01:03.000"},
+	}
+	for _, status := range statuses {
+		sm.updateMetrics(status)
+	}
+
+	samples, _ := sm.Collect()
+
+	if v := valueOf(t, samples, "output_congestion_max"); v != 0.5 {
+		t.Errorf("Expected output_congestion_max to be 0.5, got %v", v)
+	}
+	if v := valueOf(t, samples, "output_congestion_avg").(float64); v < 0.2999 || v > 0.3001 {
+		t.Errorf("Expected output_congestion_avg to be 0.3, got %v", v)
+	}
+	if v := valueOf(t, samples, "output_reconnecting"); v != true {
+		t.Errorf("Expected a reconnect within the interval to be reported, got %v", v)
+	}
+	if v := valueOf(t, samples, "output_duration_ms"); v != 63000.0 {
+		t.Errorf("Expected output_duration_ms to be the latest value, got %v", v)
+	}
+	if v := valueOf(t, samples, "output_timecode"); v != "00:01:03.000" {
+		t.Errorf("Expected output_timecode to be the latest value, got %v", v)
+	}
+
+	sm.updateMetrics(&stream.GetStreamStatusResponse{OutputActive: true, OutputCongestion: 0.05, OutputDuration: 64000, OutputTimecode: "00:01:04.000"})
+	samples, _ = sm.Collect()
+
+	if v := valueOf(t, samples, "output_congestion_max"); v != 0.05 {
+		t.Errorf("Expected the congestion to start over in the next interval, got %v", v)
+	}
+	if v := valueOf(t, samples, "output_reconnecting"); v != false {
+		t.Errorf("Expected output_reconnecting to be reset in the next interval, got %v", v)
+	}
+}
+
+func TestStreamMetrics_Collect_Bitrate(t *testing.T) {
+	var events []Event
+	sm, _ := NewStreamMetrics(nil, 0, 0.8, 2*time.Second, func(e Event) {
+		events = append(events, e)
+	})
+	sm.SetTargetBitrate(6000)
+
+	// Every interval covers one second of stream time, the bytes sent set the bitrate
+	var bytes, duration float64
+	poll := func(kbps float64) []Sample {
+		bytes += kbps * 1000 / 8
+		duration += 1000
+		sm.updateMetrics(&stream.GetStreamStatusResponse{OutputActive: true, OutputBytes: bytes, OutputDuration: duration})
+		samples, _ := sm.Collect()
+		return samples
+	}
+	poll(0)
+
+	tests := []struct {
+		kbps           float64
+		expectedRatio  float64
+		expectedLow    bool
+		expectedEvents int
+	}{
+		{kbps: 6000, expectedRatio: 1, expectedLow: false},
+		{kbps: 3000, expectedRatio: 0.5, expectedLow: false},
+		{kbps: 4500, expectedRatio: 0.75, expectedLow: true, expectedEvents: 1},
+		{kbps: 3000, expectedRatio: 0.5, expectedLow: true},
+		{kbps: 5400, expectedRatio: 0.9, expectedLow: false},
+	}
+	for i, tt := range tests {
+		events = nil
+		samples := poll(tt.kbps)
+
+		if v := valueOf(t, samples, "output_kbps"); v != tt.kbps {
+			t.Errorf("Interval %d: expected output_kbps to be %v, got %v", i, tt.kbps, v)
+		}
+		if v := valueOf(t, samples, "output_bitrate_ratio"); v != tt.expectedRatio {
+			t.Errorf("Interval %d: expected output_bitrate_ratio to be %v, got %v", i, tt.expectedRatio, v)
+		}
+		if v := valueOf(t, samples, "output_bitrate_low"); v != tt.expectedLow {
+			t.Errorf("Interval %d: expected output_bitrate_low to be %v, got %v", i, tt.expectedLow, v)
+		}
+		if len(events) != tt.expectedEvents {
+			t.Errorf("Interval %d: expected %d LowBitrate events, got %+v", i, tt.expectedEvents, events)
+		}
+		for _, e := range events {
+			if e.Type != "LowBitrate" {
+				t.Errorf("Interval %d: expected a LowBitrate event, got %+v", i, e)
+			}
+		}
+	}
+}
+
+func TestStreamMetrics_Collect_RatesFollowStreamTime(t *testing.T) {
+	sm, _ := NewStreamMetrics(nil, 0, 0, 0, nil)
+	sm.updateMetrics(&stream.GetStreamStatusResponse{OutputActive: true, OutputBytes: 1000, OutputTotalFrames: 60, OutputDuration: 1000})
+	sm.Collect()
+
+	// A writer interval that took 2 seconds of stream time, e.g. -writer-interval 2000
+	sm.updateMetrics(&stream.GetStreamStatusResponse{
+		OutputActive: true, OutputBytes: 1501000, OutputSkippedFrames: 3, OutputTotalFrames: 180, OutputDuration: 3000,
+	})
+	samples, _ := sm.Collect()
+
+	expected := map[string]float64{
+		"output_bytes":           1500000,
+		"output_frames":          120,
+		"output_kbps":            6000,
+		"output_fps":             60,
+		"output_skipped_percent": 2.5,
+		"output_window_ms":       2000,
+	}
+	for name, value := range expected {
+		if v := valueOf(t, samples, name); v != value {
+			t.Errorf("Expected %s to be %v, got %v", name, value, v)
+		}
+	}
+}
+
+func TestStreamMetrics_Collect_NoRatesWhileInactive(t *testing.T) {
+	sm, _ := NewStreamMetrics(nil, 0, 0, 0, nil)
+	sm.updateMetrics(&stream.GetStreamStatusResponse{})
+	sm.Collect()
+	sm.updateMetrics(&stream.GetStreamStatusResponse{})
+
+	samples, _ := sm.Collect()
+
+	for _, s := range samples {
+		switch s.Name {
+		case "output_kbps", "output_fps", "output_skipped_percent", "output_window_ms":
+			t.Errorf("Expected no %s while the stream is inactive, got %v", s.Name, s.Value)
+		}
+	}
+}
+
+func TestStreamMetrics_Collect_BitrateWithoutTarget(t *testing.T) {
+	sm, _ := NewStreamMetrics(nil, 0, 0, 0, nil)
+	sm.updateMetrics(&stream.GetStreamStatusResponse{OutputActive: true, OutputBytes: 1000, OutputDuration: 1000})
+	sm.Collect()
+	sm.updateMetrics(&stream.GetStreamStatusResponse{OutputActive: true, OutputBytes: 251000, OutputDuration: 1500})
+
+	samples, _ := sm.Collect()
+
+	if v := valueOf(t, samples, "output_kbps"); v != 4000.0 {
+		t.Errorf("Expected output_kbps to follow the stream time, got %v", v)
+	}
+	for _, s := range samples {
+		if s.Name == "output_bitrate_ratio" || s.Name == "output_bitrate_low" {
+			t.Errorf("Expected no %s without a configured bitrate, got %v", s.Name, s.Value)
+		}
 	}
 }
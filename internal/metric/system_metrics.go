@@ -1,29 +1,23 @@
 package metric
 
 import (
-	"fmt"
-	"sync"
+	"context"
 	"time"
 
 	"github.com/shirou/gopsutil/v4/cpu"
 	"github.com/shirou/gopsutil/v4/mem"
 )
 
-type SystemMetrics struct {
-	maxCpuUsage          float64
-	maxMemoryUsage       float64
-	lastError            error
-	measurementCount     int
-	measurementsSinceGet int
-	mu                   sync.Mutex
-	interval             time.Duration
+var systemMetricsFields = []Field{
+	{Name: "system_cpu_percent", Type: FloatValue, Kind: Gauge, Precision: 2},
+	{Name: "system_memory_percent", Type: FloatValue, Kind: Gauge, Precision: 2},
 }
 
-type SystemMetricsData struct {
-	Timestamp   time.Time
-	CpuUsage    float64
-	MemoryUsage float64
-	Error       error
+type SystemMetrics struct {
+	intervalTracker
+	maxCpuUsage    float64
+	maxMemoryUsage float64
+	interval       time.Duration
 }
 
 func NewSystemMetrics(interval time.Duration) (*SystemMetrics, error) {
@@ -32,77 +26,60 @@ func NewSystemMetrics(interval time.Duration) (*SystemMetrics, error) {
 	}, nil
 }
 
-func (s *SystemMetrics) GetAndResetMaxValues() SystemMetricsData {
+func (s *SystemMetrics) Name() string {
+	return "system"
+}
+
+func (s *SystemMetrics) Fields() []Field {
+	return systemMetricsFields
+}
+
+func (s *SystemMetrics) Collect() ([]Sample, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	if s.measurementsSinceGet == 0 && s.measurementCount > 0 {
-		return SystemMetricsData{
-			Timestamp:   time.Now(),
-			CpuUsage:    0,
-			MemoryUsage: 0,
-			Error:       fmt.Errorf("no new measurements collected since last read"),
-		}
+	if s.stale() {
+		return []Sample{
+			{Field: systemMetricsFields[0], Value: 0.0},
+			{Field: systemMetricsFields[1], Value: 0.0},
+		}, errNoNewMeasurements
 	}
 
-	maxCpu := s.maxCpuUsage
-	maxMemory := s.maxMemoryUsage
-	err := s.lastError
-
+	samples := []Sample{
+		{Field: systemMetricsFields[0], Value: s.maxCpuUsage},
+		{Field: systemMetricsFields[1], Value: s.maxMemoryUsage},
+	}
 	s.maxCpuUsage = 0
 	s.maxMemoryUsage = 0
-	s.lastError = nil
-	s.measurementsSinceGet = 0
-
-	return SystemMetricsData{
-		Timestamp:   time.Now(),
-		CpuUsage:    maxCpu,
-		MemoryUsage: maxMemory,
-		Error:       err,
-	}
+
+	return samples, s.reset()
 }
 
 func (s *SystemMetrics) updateMetrics(cpuUsage, memUsage float64) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	if cpuUsage > s.maxCpuUsage {
-		s.maxCpuUsage = cpuUsage
-	}
-	if memUsage > s.maxMemoryUsage {
-		s.maxMemoryUsage = memUsage
-	}
-	s.measurementCount++
-	s.measurementsSinceGet++
-}
-
-func (s *SystemMetrics) recordError(err error) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-	s.lastError = err
+	s.maxCpuUsage = max(s.maxCpuUsage, cpuUsage)
+	s.maxMemoryUsage = max(s.maxMemoryUsage, memUsage)
+	s.measured()
 }
 
-func (s *SystemMetrics) Start() error {
-	ticker := time.NewTicker(s.interval)
-	defer ticker.Stop()
-
-	for range ticker.C {
+func (s *SystemMetrics) Start(ctx context.Context) error {
+	return runEvery(ctx, s.interval, func() {
 		cpuUsage, err := s.getCpuUsage()
 		if err != nil {
 			s.recordError(err)
-			continue
+			return
 		}
 
 		memUsage, err := s.getMemoryUsage()
 		if err != nil {
 			s.recordError(err)
-			continue
+			return
 		}
 
 		s.updateMetrics(cpuUsage, memUsage)
-	}
-
-	return nil
+	})
 }
 
 func (s *SystemMetrics) getCpuUsage() (float64, error) {
@@ -7,33 +7,33 @@ import (
 	"time"
 )
 
-func TestSystemMetrics_GetAndResetMaxValues_ReturnsCorrectMaxValues(t *testing.T) {
+func TestSystemMetrics_Collect_ReturnsCorrectMaxValues(t *testing.T) {
 	sm := &SystemMetrics{
-		maxCpuUsage:          75.5,
-		maxMemoryUsage:       85.2,
-		measurementCount:     3,
-		measurementsSinceGet: 2,
+		maxCpuUsage:    75.5,
+		maxMemoryUsage: 85.2,
 	}
+	sm.measurementCount = 3
+	sm.measurementsSinceGet = 2
 
-	data := sm.GetAndResetMaxValues()
+	samples, _ := sm.Collect()
 
-	if data.CpuUsage != 75.5 {
-		t.Errorf("Expected CpuUsage to be 75.5, got %f", data.CpuUsage)
+	if cpu := valueOf(t, samples, "system_cpu_percent"); cpu != 75.5 {
+		t.Errorf("Expected system_cpu_percent to be 75.5, got %v", cpu)
 	}
-	if data.MemoryUsage != 85.2 {
-		t.Errorf("Expected MemoryUsage to be 85.2, got %f", data.MemoryUsage)
+	if mem := valueOf(t, samples, "system_memory_percent"); mem != 85.2 {
+		t.Errorf("Expected system_memory_percent to be 85.2, got %v", mem)
 	}
 }
 
-func TestSystemMetrics_GetAndResetMaxValues_ResetsValues(t *testing.T) {
+func TestSystemMetrics_Collect_ResetsValues(t *testing.T) {
 	sm := &SystemMetrics{
-		maxCpuUsage:          75.5,
-		maxMemoryUsage:       85.2,
-		measurementCount:     4,
-		measurementsSinceGet: 2,
+		maxCpuUsage:    75.5,
+		maxMemoryUsage: 85.2,
 	}
+	sm.measurementCount = 4
+	sm.measurementsSinceGet = 2
 
-	_ = sm.GetAndResetMaxValues()
+	_, _ = sm.Collect()
 
 	if sm.maxCpuUsage != 0 {
 		t.Errorf("Expected maxCpuUsage to be reset to 0, got %f", sm.maxCpuUsage)
@@ -46,36 +46,34 @@ func TestSystemMetrics_GetAndResetMaxValues_ResetsValues(t *testing.T) {
 	}
 }
 
-func TestSystemMetrics_GetAndResetMaxValues_ErrorHandling(t *testing.T) {
+func TestSystemMetrics_Collect_ErrorHandling(t *testing.T) {
 	testError := fmt.Errorf("system error")
-	sm := &SystemMetrics{
-		maxCpuUsage:          50.0,
-		lastError:            testError,
-		measurementCount:     2,
-		measurementsSinceGet: 1,
-	}
+	sm := &SystemMetrics{maxCpuUsage: 50.0}
+	sm.lastError = testError
+	sm.measurementCount = 2
+	sm.measurementsSinceGet = 1
 
-	data := sm.GetAndResetMaxValues()
+	_, err := sm.Collect()
 
-	if data.Error == nil {
+	if err == nil {
 		t.Error("Expected error to be returned")
 	}
-	if data.Error != testError {
+	if err != testError {
 		t.Error("Expected error pointer to match")
 	}
 
 	if sm.lastError != nil {
-		t.Error("Expected lastError to be reset to nil after GetAndResetMaxValues")
+		t.Error("Expected lastError to be reset to nil after Collect")
 	}
 }
 
-func TestSystemMetrics_GetAndResetMaxValues_ConcurrentAccess(t *testing.T) {
+func TestSystemMetrics_Collect_ConcurrentAccess(t *testing.T) {
 	sm := &SystemMetrics{
-		maxCpuUsage:          60.0,
-		maxMemoryUsage:       70.0,
-		measurementCount:     3,
-		measurementsSinceGet: 1,
+		maxCpuUsage:    60.0,
+		maxMemoryUsage: 70.0,
 	}
+	sm.measurementCount = 3
+	sm.measurementsSinceGet = 1
 
 	var wg sync.WaitGroup
 	iterations := 100
@@ -84,74 +82,69 @@ func TestSystemMetrics_GetAndResetMaxValues_ConcurrentAccess(t *testing.T) {
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
-			_ = sm.GetAndResetMaxValues()
+			_, _ = sm.Collect()
 		}()
 	}
 
 	wg.Wait()
 }
 
-func TestSystemMetrics_GetAndResetMaxValues_ZeroValues(t *testing.T) {
-	sm := &SystemMetrics{
-		maxCpuUsage:    0,
-		maxMemoryUsage: 0,
-	}
+func TestSystemMetrics_Collect_ZeroValues(t *testing.T) {
+	sm := &SystemMetrics{}
 
-	data := sm.GetAndResetMaxValues()
+	samples, err := sm.Collect()
 
-	if data.CpuUsage != 0 {
-		t.Errorf("Expected CpuUsage to be 0, got %f", data.CpuUsage)
+	if cpu := valueOf(t, samples, "system_cpu_percent"); cpu != 0.0 {
+		t.Errorf("Expected system_cpu_percent to be 0, got %v", cpu)
 	}
-	if data.MemoryUsage != 0 {
-		t.Errorf("Expected MemoryUsage to be 0, got %f", data.MemoryUsage)
+	if mem := valueOf(t, samples, "system_memory_percent"); mem != 0.0 {
+		t.Errorf("Expected system_memory_percent to be 0, got %v", mem)
 	}
-	if data.Error != nil {
+	if err != nil {
 		t.Error("Expected no error with zero values")
 	}
 }
 
-func TestSystemMetrics_GetAndResetMaxValues_TracksMaximum(t *testing.T) {
-	sm := &SystemMetrics{
-		maxCpuUsage:          40.0,
-		measurementCount:     2,
-		measurementsSinceGet: 1,
-	}
+func TestSystemMetrics_Collect_TracksMaximum(t *testing.T) {
+	sm := &SystemMetrics{maxCpuUsage: 40.0}
+	sm.measurementCount = 2
+	sm.measurementsSinceGet = 1
 
-	data1 := sm.GetAndResetMaxValues()
-	if data1.CpuUsage != 40.0 {
-		t.Errorf("Expected first call to return 40.0, got %f", data1.CpuUsage)
+	samples, _ := sm.Collect()
+	if cpu := valueOf(t, samples, "system_cpu_percent"); cpu != 40.0 {
+		t.Errorf("Expected first call to return 40.0, got %v", cpu)
 	}
 
 	sm.maxCpuUsage = 80.0
 	sm.measurementsSinceGet = 1
 
-	data2 := sm.GetAndResetMaxValues()
-	if data2.CpuUsage != 80.0 {
-		t.Errorf("Expected second call to return 80.0 (new max), got %f", data2.CpuUsage)
+	samples, _ = sm.Collect()
+	if cpu := valueOf(t, samples, "system_cpu_percent"); cpu != 80.0 {
+		t.Errorf("Expected second call to return 80.0 (new max), got %v", cpu)
 	}
 }
 
-func TestSystemMetrics_GetAndResetMaxValues_NoNewMeasurements(t *testing.T) {
+func TestSystemMetrics_Collect_NoNewMeasurements(t *testing.T) {
 	sm := &SystemMetrics{
-		maxCpuUsage:          50.0,
-		maxMemoryUsage:       60.0,
-		measurementCount:     5,
-		measurementsSinceGet: 0,
+		maxCpuUsage:    50.0,
+		maxMemoryUsage: 60.0,
 	}
+	sm.measurementCount = 5
+	sm.measurementsSinceGet = 0
 
-	data := sm.GetAndResetMaxValues()
+	samples, err := sm.Collect()
 
-	if data.Error == nil {
+	if err == nil {
 		t.Error("Expected error when no new measurements collected")
 	}
-	if data.Error != nil && data.Error.Error() != "no new measurements collected since last read" {
-		t.Errorf("Expected specific error message, got: %v", data.Error)
+	if err != nil && err.Error() != "no new measurements collected since last read" {
+		t.Errorf("Expected specific error message, got: %v", err)
 	}
-	if data.CpuUsage != 0 {
-		t.Errorf("Expected CpuUsage to be 0, got %f", data.CpuUsage)
+	if cpu := valueOf(t, samples, "system_cpu_percent"); cpu != 0.0 {
+		t.Errorf("Expected system_cpu_percent to be 0, got %v", cpu)
 	}
-	if data.MemoryUsage != 0 {
-		t.Errorf("Expected MemoryUsage to be 0, got %f", data.MemoryUsage)
+	if mem := valueOf(t, samples, "system_memory_percent"); mem != 0.0 {
+		t.Errorf("Expected system_memory_percent to be 0, got %v", mem)
 	}
 }
 
@@ -169,70 +162,44 @@ func TestSystemMetrics_NewSystemMetrics(t *testing.T) {
 	if sm.interval != interval {
 		t.Errorf("Expected interval %v, got %v", interval, sm.interval)
 	}
-}
-
-func TestSystemMetrics_GetAndResetMaxValues_TimestampSet(t *testing.T) {
-	sm := &SystemMetrics{
-		maxCpuUsage: 50.0,
-	}
-
-	before := time.Now()
-	data := sm.GetAndResetMaxValues()
-	after := time.Now()
-
-	if data.Timestamp.Before(before) || data.Timestamp.After(after) {
-		t.Error("Expected timestamp to be set to current time")
+	if sm.Name() != "system" {
+		t.Errorf("Expected name system, got %s", sm.Name())
 	}
 }
 
-func TestSystemMetrics_GetAndResetMaxValues_HighMemoryUsage(t *testing.T) {
-	sm := &SystemMetrics{
-		maxMemoryUsage: 99.9,
-	}
+func TestSystemMetrics_Collect_HighMemoryUsage(t *testing.T) {
+	sm := &SystemMetrics{maxMemoryUsage: 99.9}
 
-	data := sm.GetAndResetMaxValues()
+	samples, _ := sm.Collect()
 
-	if data.MemoryUsage != 99.9 {
-		t.Errorf("Expected MemoryUsage to be 99.9, got %f", data.MemoryUsage)
+	if mem := valueOf(t, samples, "system_memory_percent"); mem != 99.9 {
+		t.Errorf("Expected system_memory_percent to be 99.9, got %v", mem)
 	}
 }
 
 func TestSystemMetrics_ErrorHandlingDuringCollection(t *testing.T) {
-	sm := &SystemMetrics{
-		maxCpuUsage: 50.0,
-	}
+	sm := &SystemMetrics{maxCpuUsage: 50.0}
 
 	testError := fmt.Errorf("system metrics collection error")
+	sm.recordError(testError)
 
 	sm.mu.Lock()
-	sm.lastError = testError
-	sm.mu.Unlock()
-
-	sm.mu.Lock()
-	if sm.lastError != testError {
-		t.Error("Expected lastError to be set")
-	}
 	if sm.maxCpuUsage != 50.0 {
 		t.Error("Expected maxCpuUsage to remain unchanged after error")
 	}
 	sm.mu.Unlock()
 
-	data := sm.GetAndResetMaxValues()
-	if data.Error != testError {
-		t.Error("Expected error to be returned in data")
+	_, err := sm.Collect()
+	if err != testError {
+		t.Error("Expected error to be returned from Collect")
 	}
 }
 
 func TestSystemMetrics_ErrorHandlingContinuesCollection(t *testing.T) {
-	sm := &SystemMetrics{
-		maxCpuUsage: 30.0,
-	}
+	sm := &SystemMetrics{maxCpuUsage: 30.0}
 
 	cpuError := fmt.Errorf("cpu collection error")
-
-	sm.mu.Lock()
-	sm.lastError = cpuError
-	sm.mu.Unlock()
+	sm.recordError(cpuError)
 
 	sm.mu.Lock()
 	currentError := sm.lastError
@@ -243,12 +210,10 @@ func TestSystemMetrics_ErrorHandlingContinuesCollection(t *testing.T) {
 	}
 
 	memError := fmt.Errorf("memory collection error")
-	sm.mu.Lock()
-	sm.lastError = memError
-	sm.mu.Unlock()
+	sm.recordError(memError)
 
-	data := sm.GetAndResetMaxValues()
-	if data.Error != memError {
+	_, err := sm.Collect()
+	if err != memError {
 		t.Error("Expected error to be the last encountered error")
 	}
 }
@@ -332,8 +297,8 @@ func TestSystemMetrics_RecordError(t *testing.T) {
 	}
 	sm.mu.Unlock()
 
-	data := sm.GetAndResetMaxValues()
-	if data.Error != testError {
-		t.Error("Expected error to be returned in GetAndResetMaxValues")
+	_, err := sm.Collect()
+	if err != testError {
+		t.Error("Expected error to be returned from Collect")
 	}
 }
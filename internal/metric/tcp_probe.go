@@ -0,0 +1,105 @@
+package metric
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"time"
+)
+
+const (
+	// DefaultProbePort is the RTMP port the TCP and RTMP probes connect to when no port is configured
+	DefaultProbePort = 1935
+	// DefaultTLSProbePort is the RTMPS port the probes connect to when no port is configured
+	DefaultTLSProbePort = 443
+	// rtmpVersion is the only version in C0 and S0 of a plain RTMP handshake
+	rtmpVersion = 3
+	// rtmpHandshakeSize is the size of the C1 and S1 handshake chunks
+	rtmpHandshakeSize = 1536
+)
+
+// dialProbe resolves the host before starting the clock, so the DNS lookup doesn't count as latency. A
+// timeout counts as an unanswered probe.
+func dialProbe(host string, port int) (net.Conn, time.Time, error) {
+	addr, err := net.ResolveTCPAddr("tcp", net.JoinHostPort(host, strconv.Itoa(port)))
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+
+	start := time.Now()
+	conn, err := net.DialTimeout("tcp", addr.String(), probeTimeout)
+	if err != nil {
+		return nil, start, probeError(err)
+	}
+	return conn, start, nil
+}
+
+// tcpConnect measures how long the TCP handshake with host takes
+func tcpConnect(host string, port int) (time.Duration, error) {
+	conn, start, err := dialProbe(host, port)
+	if err != nil {
+		return 0, err
+	}
+	rtt := time.Since(start)
+	conn.Close()
+	return rtt, nil
+}
+
+// rtmpHandshake measures the TCP connect plus the first round trip of the RTMP handshake: the time until
+// the server answered C0 and C1 with S0 and S1. With a TLS config the RTMPS handshake runs over TLS, and
+// the TLS handshake is part of the time. The connection is closed without sending C2.
+func rtmpHandshake(host string, port int, tlsConfig *tls.Config) (time.Duration, error) {
+	conn, start, err := dialProbe(host, port)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(start.Add(probeTimeout))
+
+	if tlsConfig != nil {
+		tlsConn := tls.Client(conn, tlsConfig)
+		if err := tlsConn.Handshake(); err != nil {
+			return 0, probeError(err)
+		}
+		conn = tlsConn
+	}
+
+	// C1 holds a zero timestamp, four zero bytes and random data the server echoes in S2
+	c0c1 := make([]byte, 1+rtmpHandshakeSize)
+	c0c1[0] = rtmpVersion
+	if _, err := rand.Read(c0c1[9:]); err != nil {
+		return 0, err
+	}
+	if _, err := conn.Write(c0c1); err != nil {
+		return 0, probeError(err)
+	}
+
+	s0s1 := make([]byte, 1+rtmpHandshakeSize)
+	if _, err := io.ReadFull(conn, s0s1); err != nil {
+		return 0, probeError(err)
+	}
+	rtt := time.Since(start)
+
+	if s0s1[0] != rtmpVersion {
+		return 0, fmt.Errorf("unexpected RTMP version %d", s0s1[0])
+	}
+	if bytes.Equal(s0s1[9:], c0c1[9:]) {
+		// An echo server isn't an RTMP server, S1 carries the server's own random data
+		return 0, errors.New("server echoed C1 instead of sending S1")
+	}
+	return rtt, nil
+}
+
+// probeError turns a timeout into errNoReply, other errors such as a refused connection stay errors
+func probeError(err error) error {
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return errNoReply
+	}
+	return err
+}
@@ -0,0 +1,199 @@
+package metric
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io"
+	"net"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// listen starts a local TCP stand-in for an ingest server that hands every connection to handle
+func listen(t *testing.T, handle func(conn net.Conn)) (string, int) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				handle(conn)
+			}()
+		}
+	}()
+
+	addr := ln.Addr().(*net.TCPAddr)
+	return addr.IP.String(), addr.Port
+}
+
+// rtmpServer answers C0 and C1 with S0 and S1 carrying its own random data
+func rtmpServer(version byte) func(conn net.Conn) {
+	return func(conn net.Conn) {
+		c0c1 := make([]byte, 1+rtmpHandshakeSize)
+		if _, err := io.ReadFull(conn, c0c1); err != nil {
+			return
+		}
+		s0s1 := make([]byte, 1+rtmpHandshakeSize)
+		s0s1[0] = version
+		rand.Read(s0s1[9:])
+		conn.Write(s0s1)
+		io.Copy(io.Discard, conn)
+	}
+}
+
+func TestTCPConnect(t *testing.T) {
+	host, port := listen(t, func(conn net.Conn) {})
+
+	rtt, err := tcpConnect(host, port)
+
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if rtt <= 0 || rtt > probeTimeout {
+		t.Errorf("Expected a connect time within the timeout, got %v", rtt)
+	}
+}
+
+func TestTCPConnect_Refused(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	port := ln.Addr().(*net.TCPAddr).Port
+	ln.Close()
+
+	_, err = tcpConnect("127.0.0.1", port)
+
+	if err == nil || errors.Is(err, errNoReply) {
+		t.Errorf("Expected a refused connection to be an error, got %v", err)
+	}
+}
+
+func TestRTMPHandshake(t *testing.T) {
+	tests := []struct {
+		name    string
+		handle  func(conn net.Conn)
+		wantErr error
+	}{
+		{
+			name:   "RTMP server",
+			handle: rtmpServer(rtmpVersion),
+		},
+		{
+			name:    "unexpected version",
+			handle:  rtmpServer(6),
+			wantErr: errors.New("unexpected RTMP version 6"),
+		},
+		{
+			name:    "echo server",
+			handle:  func(conn net.Conn) { io.Copy(conn, conn) },
+			wantErr: errors.New("server echoed C1 instead of sending S1"),
+		},
+		{
+			name:    "silent server",
+			handle:  func(conn net.Conn) { io.Copy(io.Discard, conn) },
+			wantErr: errNoReply,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			host, port := listen(t, tt.handle)
+
+			rtt, err := rtmpHandshake(host, port, nil)
+
+			if tt.wantErr == nil {
+				if err != nil {
+					t.Fatalf("Expected no error, got %v", err)
+				}
+				if rtt <= 0 {
+					t.Errorf("Expected a handshake time, got %v", rtt)
+				}
+				return
+			}
+			if err == nil || err.Error() != tt.wantErr.Error() {
+				t.Errorf("Expected error %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestRTMPHandshake_TLS(t *testing.T) {
+	// httptest provides a certificate for 127.0.0.1
+	srv := httptest.NewUnstartedServer(nil)
+	srv.StartTLS()
+	serverConfig := srv.TLS
+	roots := x509.NewCertPool()
+	roots.AddCert(srv.Certificate())
+	srv.Close()
+
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", serverConfig)
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				rtmpServer(rtmpVersion)(conn)
+			}()
+		}
+	}()
+	port := ln.Addr().(*net.TCPAddr).Port
+
+	rtt, err := rtmpHandshake("127.0.0.1", port, &tls.Config{ServerName: "127.0.0.1", RootCAs: roots})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if rtt <= 0 {
+		t.Errorf("Expected a handshake time, got %v", rtt)
+	}
+
+	if _, err := rtmpHandshake("127.0.0.1", port, nil); err == nil {
+		t.Error("Expected a plain RTMP handshake with an RTMPS server to fail")
+	}
+}
+
+func TestPinger_Start_RTMPProbe(t *testing.T) {
+	host, port := listen(t, rtmpServer(rtmpVersion))
+	p, _ := NewPinger(PingTarget{Name: "ingest", Host: host, Probe: RTMPProbe, Port: port}, 20*time.Millisecond)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		p.Start(ctx)
+		close(done)
+	}()
+	time.Sleep(100 * time.Millisecond)
+	cancel()
+	<-done
+
+	samples, err := p.Collect()
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if rtt, ok := valueOf(t, samples, "ingest_rtt_ms").(time.Duration); !ok || rtt <= 0 {
+		t.Errorf("Expected an RTT for the handshake, got %v", rtt)
+	}
+	if loss := valueOf(t, samples, "ingest_ping_loss_percent"); loss != 0.0 {
+		t.Errorf("Expected no loss, got %v", loss)
+	}
+}
@@ -0,0 +1,58 @@
+package metric
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// windowTimeFormat keeps the milliseconds that the RFC 3339 timestamp column leaves out
+const windowTimeFormat = "2006-01-02T15:04:05.000Z07:00"
+
+var windowFields = []Field{
+	{Name: "window_start", Type: StringValue, Kind: Gauge},
+	{Name: "window_end", Type: StringValue, Kind: Gauge},
+	{Name: "window_ms", Type: FloatValue, Kind: Gauge, Precision: 1},
+}
+
+// Window reports the measurement window a row covers, from the previous read to this one. The length
+// is measured on the monotonic clock, so ticker drift and wall clock adjustments show up as they are.
+type Window struct {
+	start time.Time
+	now   func() time.Time
+	mu    sync.Mutex
+}
+
+// NewWindow starts the first window at the given time, usually when the collectors start
+func NewWindow(start time.Time) *Window {
+	return &Window{start: start, now: time.Now}
+}
+
+func (w *Window) Name() string {
+	return "window"
+}
+
+func (w *Window) Fields() []Field {
+	return windowFields
+}
+
+// Start has nothing to measure, the window follows the reads
+func (w *Window) Start(ctx context.Context) error {
+	<-ctx.Done()
+	return nil
+}
+
+// Collect ends the current window and starts the next one
+func (w *Window) Collect() ([]Sample, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	end := w.now()
+	samples := []Sample{
+		{Field: windowFields[0], Value: w.start.Format(windowTimeFormat)},
+		{Field: windowFields[1], Value: end.Format(windowTimeFormat)},
+		{Field: windowFields[2], Value: float64(end.Sub(w.start).Microseconds()) / 1000},
+	}
+	w.start = end
+	return samples, nil
+}
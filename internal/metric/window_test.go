@@ -0,0 +1,46 @@
+package metric
+
+import (
+	"testing"
+	"time"
+)
+
+func TestWindow_Collect(t *testing.T) {
+	start := time.Date(2025, 12, 23, 10, 0, 0, 0, time.UTC)
+	reads := []time.Time{
+		start.Add(1000 * time.Millisecond),
+		start.Add(2250500 * time.Microsecond),
+	}
+
+	w := NewWindow(start)
+	w.now = func() time.Time {
+		now := reads[0]
+		reads = reads[1:]
+		return now
+	}
+
+	tests := []struct {
+		expectedStart string
+		expectedEnd   string
+		expectedMs    float64
+	}{
+		{expectedStart: "2025-12-23T10:00:00.000Z", expectedEnd: "2025-12-23T10:00:01.000Z", expectedMs: 1000},
+		{expectedStart: "2025-12-23T10:00:01.000Z", expectedEnd: "2025-12-23T10:00:02.250Z", expectedMs: 1250.5},
+	}
+	for i, tt := range tests {
+		samples, err := w.Collect()
+		if err != nil {
+			t.Fatalf("Collect returned error: %v", err)
+		}
+
+		if v := valueOf(t, samples, "window_start"); v != tt.expectedStart {
+			t.Errorf("Read %d: expected window_start %s, got %v", i, tt.expectedStart, v)
+		}
+		if v := valueOf(t, samples, "window_end"); v != tt.expectedEnd {
+			t.Errorf("Read %d: expected window_end %s, got %v", i, tt.expectedEnd, v)
+		}
+		if v := valueOf(t, samples, "window_ms"); v != tt.expectedMs {
+			t.Errorf("Read %d: expected window_ms %v, got %v", i, tt.expectedMs, v)
+		}
+	}
+}
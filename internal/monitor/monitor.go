@@ -2,35 +2,76 @@ package monitor
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"math"
+	"net"
 	"net/url"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/andreykaipov/goobs"
+	"github.com/andreykaipov/goobs/api/closecodes"
 	"github.com/andreykaipov/goobs/api/events"
+	"github.com/andreykaipov/goobs/api/events/subscriptions"
+	"github.com/andreykaipov/goobs/api/requests/config"
+	"github.com/gorilla/websocket"
 	"github.com/joepadmiraal/metrics-for-obs/internal/metric"
 	"github.com/joepadmiraal/metrics-for-obs/internal/writer"
 )
 
 type ObsConnectionInfo struct {
-	Password       string
-	Host           string
-	CSVFile        string
-	MetricInterval int
-	WriterInterval int
+	Password           string
+	Host               string
+	CSVFile            string
+	JSONLFile          string
+	SQLiteFile         string
+	EventsFile         string // JSON Lines log of the OBS events, empty disables it
+	PrometheusAddr     string // listen address of the /metrics endpoint, empty disables it
+	Influx             writer.InfluxConfig
+	OTLP               writer.OTLPConfig
+	StatsD             writer.StatsDConfig
+	PingTargets        []metric.PingTarget // pinged next to the stream server, nil selects metric.DefaultPingTargets
+	ObsProbe           metric.Probe        // how the stream server is probed, on the port of the stream server URL
+	MetricInterval     int
+	WriterInterval     int
+	SilenceThreshold   float64 // dBFS below which an audio input counts as silent, 0 selects the default
+	SilenceDuration    int     // seconds an audio input has to stay below the threshold, 0 selects the default
+	LowBitrateFraction float64 // share of the configured bitrate below which the stream is flagged, 0 selects the default
+	LowBitrateDuration int     // seconds the bitrate has to stay low, 0 selects the default
+	Wait               bool    // keep retrying the initial connection until OBS accepts it
+	WaitTimeout        int     // limits Wait to the given number of seconds, 0 waits forever
 }
 
+const (
+	reconnectMinDelay = 1 * time.Second
+	reconnectMaxDelay = 30 * time.Second
+	// Requests in flight when the connection drops fail after this timeout
+	responseTimeout  = 2 * time.Second
+	waitPollInterval = 2 * time.Second
+)
+
 type Monitor struct {
 	client         *goobs.Client
+	connLost       <-chan struct{} // closed as soon as reading from the connection of client fails
+	clientMu       sync.Mutex
 	connectionInfo ObsConnectionInfo
+	session        writer.Session
+	server         streamServer
+	sessionMu      sync.Mutex
+	collectors     *metric.Registry
 	obsPinger      *metric.Pinger
-	googlePinger   *metric.Pinger
-	streamMetrics  *metric.StreamMetrics
+	obsDNS         *metric.DNSProbe
+	stream         *metric.StreamMetrics
 	obsStats       *metric.ObsStats
-	systemMetrics  *metric.SystemMetrics
-	csvWriter      *writer.CSVWriter
-	consoleWriter  *writer.ConsoleWriter
+	connection     *metric.ConnectionStatus
+	events         *metric.EventRecorder
+	audio          *metric.AudioLevels
+	eventLog       *writer.EventLog
+	listeners      sync.WaitGroup // event listeners of the current and earlier connections
+	writers        *writer.Registry
 	metricInterval time.Duration
 	writerInterval time.Duration
 	ctx            context.Context
@@ -44,6 +85,8 @@ func NewMonitor(connectionInfo ObsConnectionInfo) (*Monitor, error) {
 
 	return &Monitor{
 		connectionInfo: connectionInfo,
+		collectors:     metric.NewRegistry(),
+		writers:        writer.NewRegistry(),
 		metricInterval: time.Duration(connectionInfo.MetricInterval) * time.Millisecond,
 		writerInterval: time.Duration(connectionInfo.WriterInterval) * time.Millisecond,
 		ctx:            ctx,
@@ -52,101 +95,376 @@ func NewMonitor(connectionInfo ObsConnectionInfo) (*Monitor, error) {
 	}, nil
 }
 
+// AddWriter registers an additional output that receives every metrics row.
+// It must be called before Start.
+func (m *Monitor) AddWriter(name string, w writer.Writer) error {
+	return m.writers.Register(name, w)
+}
+
+// AddCollector registers an additional collector whose fields are added to every writer.
+// It must be called before Start.
+func (m *Monitor) AddCollector(c metric.Collector) error {
+	return m.collectors.Register(c)
+}
+
 // connect establishes a connection to OBS (internal use only)
 func (m *Monitor) connect() error {
-	var err error
-	m.client, err = goobs.New(m.connectionInfo.Host, goobs.WithPassword(m.connectionInfo.Password))
+	watcher := &connWatcher{lost: make(chan struct{})}
+	dialer := *websocket.DefaultDialer
+	dialer.NetDialContext = watcher.dial
+
+	client, err := goobs.New(
+		m.connectionInfo.Host,
+		goobs.WithPassword(m.connectionInfo.Password),
+		goobs.WithDialer(&dialer),
+		// goobs takes the timeout in milliseconds
+		goobs.WithResponseTimeout(responseTimeout/time.Millisecond),
+		// The audio levels arrive as a high-volume event that has to be requested explicitly
+		goobs.WithEventSubscriptions(subscriptions.All|subscriptions.InputVolumeMeters),
+	)
 	if err != nil {
 		return err
 	}
+	m.setClient(client, watcher.lost)
 	return nil
 }
 
-// Start connects to OBS and starts all monitoring components
-func (m *Monitor) Start() error {
-	// Connect to OBS
-	if err := m.connect(); err != nil {
-		return fmt.Errorf("failed to connect to OBS: %w", err)
+// connWatcher closes lost as soon as reading from the OBS connection fails. goobs only ends Listen after
+// the requests in flight timed out one by one, which would keep writing rows for a dead connection.
+type connWatcher struct {
+	lost chan struct{}
+	once sync.Once
+}
+
+func (w *connWatcher) dial(ctx context.Context, network, addr string) (net.Conn, error) {
+	conn, err := (&net.Dialer{}).DialContext(ctx, network, addr)
+	if err != nil {
+		return nil, err
+	}
+	return &watchedConn{Conn: conn, watcher: w}, nil
+}
+
+func (w *connWatcher) markLost() {
+	w.once.Do(func() { close(w.lost) })
+}
+
+// watchedConn reports a failed read to its watcher, goobs never sets a read deadline so every error
+// means the connection is gone
+type watchedConn struct {
+	net.Conn
+	watcher *connWatcher
+}
+
+func (c *watchedConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	if err != nil {
+		c.watcher.markLost()
+	}
+	return n, err
+}
+
+// waitForObs polls until OBS accepts the connection, the timeout expires or the monitor shuts down
+func (m *Monitor) waitForObs() error {
+	timeout := time.Duration(m.connectionInfo.WaitTimeout) * time.Second
+	var deadline time.Time
+	if timeout > 0 {
+		deadline = time.Now().Add(timeout)
+		fmt.Printf("Waiting up to %v for OBS at %s\n", timeout, m.connectionInfo.Host)
+	} else {
+		fmt.Printf("Waiting for OBS at %s\n", m.connectionInfo.Host)
 	}
 
-	// Get OBS version
-	version, err := m.client.General.GetVersion()
+	for attempt := 1; ; attempt++ {
+		err := m.connect()
+		if err == nil {
+			return nil
+		}
+		if isAuthenticationError(err) {
+			return fmt.Errorf("failed to connect to OBS: %w", err)
+		}
+
+		delay := waitPollInterval
+		if !deadline.IsZero() {
+			remaining := time.Until(deadline)
+			if remaining <= 0 {
+				return fmt.Errorf("OBS not available after %v: %w", timeout, err)
+			}
+			delay = min(delay, remaining)
+		}
+		fmt.Printf("OBS not available yet (attempt %d): %v\n", attempt, err)
+
+		select {
+		case <-m.ctx.Done():
+			return fmt.Errorf("stopped waiting for OBS: %w", m.ctx.Err())
+		case <-time.After(delay):
+		}
+	}
+}
+
+// isAuthenticationError reports whether OBS rejected the password, retrying won't help then
+func isAuthenticationError(err error) bool {
+	var closeErr *websocket.CloseError
+	return errors.As(err, &closeErr) && closeErr.Code == closecodes.AuthenticationFailed
+}
+
+func (m *Monitor) getClient() *goobs.Client {
+	m.clientMu.Lock()
+	defer m.clientMu.Unlock()
+	return m.client
+}
+
+func (m *Monitor) getConnection() (*goobs.Client, <-chan struct{}) {
+	m.clientMu.Lock()
+	defer m.clientMu.Unlock()
+	return m.client, m.connLost
+}
+
+func (m *Monitor) setClient(client *goobs.Client, connLost <-chan struct{}) {
+	m.clientMu.Lock()
+	defer m.clientMu.Unlock()
+	m.client = client
+	m.connLost = connLost
+}
+
+// readSession returns the OBS version, the setup the stream is sent with and the stream server. Only
+// the version and the stream server are required, other settings are left empty when OBS doesn't
+// report them.
+func (m *Monitor) readSession() (writer.Session, streamServer, error) {
+	client := m.getClient()
+
+	version, err := client.General.GetVersion()
 	if err != nil {
-		return fmt.Errorf("failed to get OBS version: %w", err)
+		return writer.Session{}, streamServer{}, fmt.Errorf("failed to get OBS version: %w", err)
 	}
 
-	// Get OBS stream server domain
-	streamSettings, err := m.client.Config.GetStreamServiceSettings()
+	streamSettings, err := client.Config.GetStreamServiceSettings()
 	if err != nil {
-		return fmt.Errorf("failed to get stream settings: %w", err)
+		return writer.Session{}, streamServer{}, fmt.Errorf("failed to get stream settings: %w", err)
 	}
 
 	serverURL := streamSettings.StreamServiceSettings.Server
 	if serverURL == "" {
-		return fmt.Errorf("stream server URL not found in settings")
+		return writer.Session{}, streamServer{}, fmt.Errorf("stream server URL not found in settings")
 	}
 
-	streamDomain, err := extractDomain(serverURL)
+	server, err := parseStreamServer(serverURL)
 	if err != nil {
-		return fmt.Errorf("failed to extract domain from URL: %w", err)
+		return writer.Session{}, streamServer{}, fmt.Errorf("failed to extract domain from URL: %w", err)
 	}
 
-	if err := m.initializePingers(streamDomain); err != nil {
-		return err
+	session := writer.Session{
+		ObsVersion:   version.ObsVersion,
+		StreamDomain: server.host,
+		ServiceType:  streamSettings.StreamServiceType,
+	}
+
+	if video, err := client.Config.GetVideoSettings(); err == nil {
+		session.BaseResolution = fmt.Sprintf("%.0fx%.0f", video.BaseWidth, video.BaseHeight)
+		session.OutputResolution = fmt.Sprintf("%.0fx%.0f", video.OutputWidth, video.OutputHeight)
+		if video.FpsDenominator > 0 {
+			fps := math.Round(video.FpsNumerator/video.FpsDenominator*100) / 100
+			session.FPS = strconv.FormatFloat(fps, 'f', -1, 64)
+		}
 	}
 
-	// Initialize stream metrics
-	m.streamMetrics, err = metric.NewStreamMetrics(m.client, m.metricInterval)
+	// The advanced output mode keeps the bitrate in the encoder settings, which OBS doesn't expose. The
+	// keyframe interval lives there in both modes, so it isn't part of the session.
+	session.OutputMode = profileParameter(client, "Output", "Mode")
+	if session.OutputMode == "Advanced" {
+		session.Encoder = profileParameter(client, "AdvOut", "Encoder")
+	} else {
+		session.Encoder = profileParameter(client, "SimpleOutput", "StreamEncoder")
+		session.Bitrate = profileParameter(client, "SimpleOutput", "VBitrate")
+	}
+
+	return session, server, nil
+}
+
+// profileParameter returns a setting of the current profile or its default, empty when OBS doesn't know it
+func profileParameter(client *goobs.Client, category, name string) string {
+	param, err := client.Config.GetProfileParameter(&config.GetProfileParameterParams{
+		ParameterCategory: &category,
+		ParameterName:     &name,
+	})
 	if err != nil {
-		return fmt.Errorf("failed to initialize stream metrics: %w", err)
+		return ""
+	}
+	if param.ParameterValue != "" {
+		return param.ParameterValue
 	}
+	return param.DefaultParameterValue
+}
 
-	// Initialize OBS stats
-	m.obsStats, err = metric.NewObsStats(m.client, m.metricInterval)
+// updateSession hands a changed OBS setup to the writers, the setup is read again on a profile change
+// and after reconnecting
+func (m *Monitor) updateSession(session writer.Session, server streamServer) {
+	m.sessionMu.Lock()
+	changed := session != m.session
+	serverChanged := server != m.server
+	m.session = session
+	m.server = server
+	m.sessionMu.Unlock()
+
+	if serverChanged {
+		m.obsPinger.SetServer(server.host, server.port, server.tls)
+		m.obsDNS.SetDomain(server.host)
+	}
+	if !changed {
+		return
+	}
+	m.stream.SetTargetBitrate(targetBitrate(session))
+	if err := m.writers.WriteSession(session); err != nil {
+		fmt.Printf("Error writing OBS settings: %v\n", err)
+	}
+}
+
+// targetBitrate returns the configured video bitrate in kbps, 0 when OBS doesn't report it
+func targetBitrate(session writer.Session) float64 {
+	kbps, err := strconv.ParseFloat(session.Bitrate, 64)
 	if err != nil {
-		return fmt.Errorf("failed to initialize OBS stats: %w", err)
+		return 0
 	}
+	return kbps
+}
 
-	// Initialize system metrics
-	m.systemMetrics, err = metric.NewSystemMetrics(m.metricInterval)
+// refreshSession reads the OBS setup again after the profile changed
+func (m *Monitor) refreshSession() {
+	session, server, err := m.readSession()
 	if err != nil {
-		return fmt.Errorf("failed to initialize system metrics: %w", err)
+		fmt.Printf("Failed to read the OBS settings: %v\n", err)
+		return
+	}
+	m.updateSession(session, server)
+}
+
+// Start connects to OBS and starts all monitoring components
+func (m *Monitor) Start() error {
+	// Connect to OBS
+	if m.connectionInfo.Wait {
+		if err := m.waitForObs(); err != nil {
+			return err
+		}
+	} else if err := m.connect(); err != nil {
+		return fmt.Errorf("failed to connect to OBS: %w", err)
+	}
+
+	session, server, err := m.readSession()
+	if err != nil {
+		return err
+	}
+	m.session = session
+	m.server = server
+
+	if err := m.initializeCollectors(server); err != nil {
+		return err
+	}
+	m.stream.SetTargetBitrate(targetBitrate(session))
+	if targetBitrate(session) == 0 {
+		fmt.Println("OBS doesn't report the stream bitrate, e.g. in the Advanced output mode, so a low bitrate isn't detected")
 	}
 
 	// Initialize CSV writer if filename is provided
 	if m.connectionInfo.CSVFile != "" {
-		m.csvWriter, err = writer.NewCSVWriter(m.connectionInfo.CSVFile, version.ObsVersion, streamDomain)
+		csvWriter, err := writer.NewCSVWriter(m.connectionInfo.CSVFile, session, m.collectors.Fields())
 		if err != nil {
 			return fmt.Errorf("failed to initialize CSV writer: %w", err)
 		}
+		if err := m.writers.Register("csv", csvWriter); err != nil {
+			csvWriter.Close()
+			return err
+		}
 		fmt.Printf("Writing metrics to CSV file: %s\n", m.connectionInfo.CSVFile)
 	}
 
-	// Initialize console writer
-	m.consoleWriter = writer.NewConsoleWriter()
+	if m.connectionInfo.JSONLFile != "" {
+		jsonlWriter, err := writer.NewJSONLWriter(m.connectionInfo.JSONLFile, session, m.collectors.Fields())
+		if err != nil {
+			return fmt.Errorf("failed to initialize JSONL writer: %w", err)
+		}
+		if err := m.writers.Register("jsonl", jsonlWriter); err != nil {
+			jsonlWriter.Close()
+			return err
+		}
+		fmt.Printf("Writing metrics to JSONL file: %s\n", m.connectionInfo.JSONLFile)
+	}
 
-	m.PrintInfo()
+	if m.connectionInfo.SQLiteFile != "" {
+		sqliteWriter, err := writer.NewSQLiteWriter(m.connectionInfo.SQLiteFile, session, m.collectors.Fields())
+		if err != nil {
+			return fmt.Errorf("failed to initialize SQLite writer: %w", err)
+		}
+		if err := m.writers.Register("sqlite", sqliteWriter); err != nil {
+			sqliteWriter.Close()
+			return err
+		}
+		fmt.Printf("Writing metrics to SQLite database: %s\n", m.connectionInfo.SQLiteFile)
+	}
 
-	// Start stream metrics monitoring in a goroutine
-	go func() {
-		if err := m.streamMetrics.Start(); err != nil {
-			fmt.Printf("Stream metrics error: %v\n", err)
+	if m.connectionInfo.PrometheusAddr != "" {
+		promWriter, err := writer.NewPrometheusWriter(m.connectionInfo.PrometheusAddr, session, m.collectors.Fields())
+		if err != nil {
+			return fmt.Errorf("failed to initialize Prometheus writer: %w", err)
 		}
-	}()
+		if err := m.writers.Register("prometheus", promWriter); err != nil {
+			promWriter.Close()
+			return err
+		}
+		fmt.Printf("Serving Prometheus metrics on http://%s/metrics\n", promWriter.Addr())
+	}
 
-	// Start OBS stats monitoring in a goroutine
-	go func() {
-		if err := m.obsStats.Start(); err != nil {
-			fmt.Printf("OBS stats error: %v\n", err)
+	if m.connectionInfo.Influx.URL != "" {
+		influxWriter, err := writer.NewInfluxWriter(m.connectionInfo.Influx, session, m.collectors.Fields())
+		if err != nil {
+			return fmt.Errorf("failed to initialize InfluxDB writer: %w", err)
 		}
-	}()
+		if err := m.writers.Register("influx", influxWriter); err != nil {
+			influxWriter.Close()
+			return err
+		}
+		fmt.Printf("Writing metrics to InfluxDB: %s\n", m.connectionInfo.Influx.URL)
+	}
 
-	// Start system metrics monitoring in a goroutine
-	go func() {
-		if err := m.systemMetrics.Start(); err != nil {
-			fmt.Printf("System metrics error: %v\n", err)
+	if m.connectionInfo.OTLP.Endpoint != "" {
+		otlpWriter, err := writer.NewOTLPWriter(m.connectionInfo.OTLP, session, m.collectors.Fields())
+		if err != nil {
+			return fmt.Errorf("failed to initialize OTLP writer: %w", err)
 		}
-	}()
+		if err := m.writers.Register("otlp", otlpWriter); err != nil {
+			otlpWriter.Close()
+			return err
+		}
+		fmt.Printf("Exporting metrics to OpenTelemetry collector: %s\n", m.connectionInfo.OTLP.Endpoint)
+	}
+
+	if m.connectionInfo.StatsD.Addr != "" {
+		statsdWriter, err := writer.NewStatsDWriter(m.connectionInfo.StatsD, session, m.collectors.Fields())
+		if err != nil {
+			return fmt.Errorf("failed to initialize StatsD writer: %w", err)
+		}
+		if err := m.writers.Register("statsd", statsdWriter); err != nil {
+			statsdWriter.Close()
+			return err
+		}
+		fmt.Printf("Sending metrics to StatsD: %s\n", m.connectionInfo.StatsD.Addr)
+	}
+
+	console := writer.NewConsoleWriter()
+	if err := m.writers.Register("console", console); err != nil {
+		return err
+	}
+
+	if m.connectionInfo.EventsFile != "" {
+		m.eventLog, err = writer.NewEventLog(m.connectionInfo.EventsFile)
+		if err != nil {
+			return fmt.Errorf("failed to initialize events log: %w", err)
+		}
+		fmt.Printf("Writing OBS events to: %s\n", m.connectionInfo.EventsFile)
+	}
+
+	m.PrintInfo()
+	console.WriteSession(session)
+
+	m.collectors.Start(m.ctx)
 
 	// Start metrics collector
 	go m.collectAndWriteMetrics()
@@ -157,36 +475,80 @@ func (m *Monitor) Start() error {
 	return nil
 }
 
-func (m *Monitor) initializePingers(obsDomain string) error {
+func (m *Monitor) initializeCollectors(server streamServer) error {
 	var err error
-
-	m.obsPinger, err = metric.NewPinger(obsDomain, m.metricInterval)
+	m.obsPinger, err = metric.NewPinger(metric.PingTarget{
+		Name:  "obs",
+		Host:  server.host,
+		Probe: m.connectionInfo.ObsProbe,
+		Port:  server.port,
+		TLS:   server.tls,
+	}, m.metricInterval)
 	if err != nil {
 		return fmt.Errorf("failed to initialize OBS pinger: %w", err)
 	}
 
-	m.googlePinger, err = metric.NewPinger("google.com", m.metricInterval)
-	if err != nil {
-		return fmt.Errorf("failed to initialize Google pinger: %w", err)
+	targets := m.connectionInfo.PingTargets
+	if targets == nil {
+		targets = metric.DefaultPingTargets
 	}
+	m.obsDNS = metric.NewDNSProbe("obs", server.host, m.metricInterval, m.ingestAddressChanged)
+	m.obsDNS.SetWatched(m.obsPinger.Address)
 
-	go func() {
-		if err := m.obsPinger.Start(); err != nil {
-			fmt.Printf("OBS pinger error: %v\n", err)
+	builtin := []metric.Collector{m.obsPinger, m.obsDNS}
+	for _, target := range targets {
+		pinger, err := metric.NewPinger(target, m.metricInterval)
+		if err != nil {
+			return fmt.Errorf("failed to initialize %s pinger: %w", target.Name, err)
 		}
-	}()
+		builtin = append(builtin, pinger)
+	}
 
-	go func() {
-		if err := m.googlePinger.Start(); err != nil {
-			fmt.Printf("Google pinger error: %v\n", err)
+	m.stream, err = metric.NewStreamMetrics(m.getClient(), m.metricInterval, m.connectionInfo.LowBitrateFraction,
+		time.Duration(m.connectionInfo.LowBitrateDuration)*time.Second, m.logEvent)
+	if err != nil {
+		return fmt.Errorf("failed to initialize stream metrics: %w", err)
+	}
+
+	m.obsStats, err = metric.NewObsStats(m.getClient(), m.metricInterval)
+	if err != nil {
+		return fmt.Errorf("failed to initialize OBS stats: %w", err)
+	}
+
+	outputMetrics, err := metric.NewOutputMetrics(m.getClient(), m.metricInterval)
+	if err != nil {
+		return fmt.Errorf("failed to initialize output metrics: %w", err)
+	}
+
+	m.audio, err = metric.NewAudioLevels(m.getClient(), m.connectionInfo.SilenceThreshold,
+		time.Duration(m.connectionInfo.SilenceDuration)*time.Second)
+	if err != nil {
+		return fmt.Errorf("failed to initialize audio levels: %w", err)
+	}
+
+	systemMetrics, err := metric.NewSystemMetrics(m.metricInterval)
+	if err != nil {
+		return fmt.Errorf("failed to initialize system metrics: %w", err)
+	}
+
+	m.connection = metric.NewConnectionStatus(true)
+	m.events = metric.NewEventRecorder()
+
+	// Built-in collectors go first so their columns keep a stable position
+	builtin = append(builtin, m.stream, m.obsStats, outputMetrics, m.audio, systemMetrics, m.connection, m.events, metric.NewWindow(time.Now()))
+	custom := m.collectors.Collectors()
+	m.collectors = metric.NewRegistry()
+	for _, c := range append(builtin, custom...) {
+		if err := m.collectors.Register(c); err != nil {
+			return fmt.Errorf("failed to register collector: %w", err)
 		}
-	}()
+	}
 
 	return nil
 }
 
 func (m *Monitor) PrintInfo() {
-	version, err := m.client.General.GetVersion()
+	version, err := m.getClient().General.GetVersion()
 	if err != nil {
 		panic(err)
 	}
@@ -197,14 +559,24 @@ func (m *Monitor) PrintInfo() {
 	fmt.Printf("Client library version: %s\n\n", goobs.LibraryVersion)
 }
 
+// Close stops the collectors and closes the writers and the events log. The collectors and event
+// listeners are waited for first, as a late DNS change could otherwise be logged to a closed events log.
+// A collector waiting for OBS to answer returns once the request timed out.
 func (m *Monitor) Close() {
-	if m.csvWriter != nil {
-		if err := m.csvWriter.Close(); err != nil {
-			fmt.Printf("Error closing CSV writer: %v\n", err)
-		}
+	m.cancel()
+	m.collectors.Wait()
+	if client := m.getClient(); client != nil {
+		client.Disconnect()
 	}
-	if m.client != nil {
-		m.client.Disconnect()
+	m.listeners.Wait()
+
+	if err := m.writers.Close(); err != nil {
+		fmt.Printf("Error closing writers: %v\n", err)
+	}
+	if m.eventLog != nil {
+		if err := m.eventLog.Close(); err != nil {
+			fmt.Printf("Error closing events log: %v\n", err)
+		}
 	}
 }
 
@@ -216,7 +588,7 @@ func (m *Monitor) Done() <-chan struct{} {
 	return m.shutdownDone
 }
 
-// collectAndWriteMetrics collects metrics from pingers, stream metrics, and system metrics and writes to CSV
+// collectAndWriteMetrics reads all collectors every writer interval and writes the combined row
 func (m *Monitor) collectAndWriteMetrics() {
 	ticker := time.NewTicker(m.writerInterval)
 	defer ticker.Stop()
@@ -226,88 +598,175 @@ func (m *Monitor) collectAndWriteMetrics() {
 		case <-m.ctx.Done():
 			return
 		case <-ticker.C:
-			obsRTT, obsErr := m.obsPinger.GetAndResetMaxRTT()
-			googleRTT, googleErr := m.googlePinger.GetAndResetMaxRTT()
-			streamData := m.streamMetrics.GetAndResetMaxValues()
-			obsStatsData := m.obsStats.GetAndResetMaxValues()
-			systemMetricsData := m.systemMetrics.GetAndResetMaxValues()
-
-			m.writeMetrics(obsRTT, obsErr, googleRTT, googleErr, streamData, obsStatsData, systemMetricsData)
+			samples, errs := m.collectors.Collect()
+			m.writeMetrics(writer.MetricsData{
+				Timestamp: time.Now(),
+				Samples:   samples,
+				Errors:    errs,
+			})
 		}
 	}
 }
 
-// writeMetrics writes a combined metrics row to CSV and console
-func (m *Monitor) writeMetrics(obsRTT time.Duration, obsErr error, googleRTT time.Duration, googleErr error, streamData metric.StreamMetricsData, obsStatsData metric.ObsStatsData, systemMetricsData metric.SystemMetricsData) {
-	data := writer.MetricsData{
-		Timestamp:           streamData.Timestamp,
-		ObsRTT:              obsRTT,
-		ObsPingError:        obsErr,
-		GoogleRTT:           googleRTT,
-		GooglePingError:     googleErr,
-		StreamActive:        streamData.Active,
-		OutputBytes:         streamData.OutputBytes,
-		OutputSkippedFrames: streamData.OutputSkippedFrames,
-		OutputFrames:        streamData.OutputFrames,
-		StreamError:         streamData.Error,
-		ObsCpuUsage:         obsStatsData.ObsCpuUsage,
-		ObsMemoryUsage:      obsStatsData.ObsMemoryUsage,
-		ObsStatsError:       obsStatsData.Error,
-		SystemCpuUsage:      systemMetricsData.CpuUsage,
-		SystemMemoryUsage:   systemMetricsData.MemoryUsage,
-		SystemMetricsError:  systemMetricsData.Error,
+// writeMetrics writes a combined metrics row to all registered writers
+func (m *Monitor) writeMetrics(data writer.MetricsData) {
+	if err := m.writers.WriteMetrics(data); err != nil {
+		fmt.Printf("Error writing metrics: %v\n", err)
 	}
+}
+
+// monitorConnection keeps the OBS connection alive until shutdown, reconnecting whenever OBS exits or the connection drops
+func (m *Monitor) monitorConnection() {
+	defer close(m.shutdownDone)
 
-	// Write to CSV if enabled
-	if m.csvWriter != nil {
-		if err := m.csvWriter.WriteMetrics(data); err != nil {
-			fmt.Printf("Error writing to CSV: %v\n", err)
+	for {
+		m.waitForDisconnect()
+		if m.ctx.Err() != nil {
+			return
 		}
-	}
 
-	// Write to console
-	if err := m.consoleWriter.WriteMetrics(data); err != nil {
-		fmt.Printf("Error writing to console: %v\n", err)
+		fmt.Println("\nOBS connection lost, reconnecting...")
+		m.bindClient(nil)
+
+		if !m.reconnect() {
+			return
+		}
+		fmt.Println("Reconnected to OBS")
 	}
 }
 
-func (m *Monitor) monitorConnection() {
-	defer close(m.shutdownDone)
+// waitForDisconnect blocks until the current connection is lost or the monitor shuts down
+func (m *Monitor) waitForDisconnect() {
+	client, connLost := m.getConnection()
 
 	listenDone := make(chan struct{})
+	m.listeners.Add(1)
 	go func() {
+		defer m.listeners.Done()
 		defer close(listenDone)
-		m.client.Listen(func(event any) {
-			switch event.(type) {
+		client.Listen(func(event any) {
+			m.recordEvent(event)
+			switch e := event.(type) {
+			case *events.InputVolumeMeters:
+				m.audio.Update(e, time.Now())
+			case *events.CurrentProgramSceneChanged, *events.SceneItemEnableStateChanged, *events.SceneItemListReindexed,
+				*events.SceneItemCreated, *events.SceneItemRemoved:
+				m.obsStats.RefreshComposition()
+			case *events.CurrentProfileChanged:
+				// Requests block until answered, the callback has to keep handling events meanwhile
+				go m.refreshSession()
 			case *events.ExitStarted:
-				fmt.Println("\nOBS connection lost, closing metrics-for-obs...")
-				m.cancel()
+				go client.Disconnect()
 			}
 		})
 	}()
 
 	select {
 	case <-m.ctx.Done():
-		m.client.Disconnect()
+		client.Disconnect()
 		<-listenDone
 	case <-listenDone:
+	case <-connLost:
+		// The requests in flight still wait for their timeout, the old client winds down meanwhile
+		go client.Disconnect()
 	}
 }
 
-func extractDomain(rawURL string) (string, error) {
+// recordEvent adds an OBS event to the current row and the events log
+func (m *Monitor) recordEvent(event any) {
+	e, ok := metric.NewEvent(time.Now(), event)
+	if !ok {
+		return
+	}
+	m.logEvent(e)
+}
+
+// ingestAddressChanged logs that the stream server moved to other addresses, its pinger follows when
+// the address it pings is gone
+func (m *Monitor) ingestAddressChanged(e metric.Event) {
+	m.logEvent(e)
+	m.obsPinger.Follow(m.obsDNS.Resolved())
+}
+
+// logEvent adds an event to the current row and the events log
+func (m *Monitor) logEvent(e metric.Event) {
+	m.events.Record(e)
+	if m.eventLog != nil {
+		if err := m.eventLog.WriteEvent(e); err != nil {
+			fmt.Printf("Error writing event: %v\n", err)
+		}
+	}
+}
+
+// reconnect retries with exponential backoff until OBS is reachable again, it returns false on shutdown
+func (m *Monitor) reconnect() bool {
+	delay := reconnectMinDelay
+
+	for {
+		select {
+		case <-m.ctx.Done():
+			return false
+		case <-time.After(delay):
+		}
+
+		err := m.connect()
+		if err == nil {
+			var session writer.Session
+			var server streamServer
+			session, server, err = m.readSession()
+			if err == nil {
+				m.updateSession(session, server)
+				m.bindClient(m.getClient())
+				return true
+			}
+			m.getClient().Disconnect()
+		}
+
+		delay = min(delay*2, reconnectMaxDelay)
+		fmt.Printf("Reconnect failed: %v, retrying in %v\n", err, delay)
+	}
+}
+
+// bindClient hands the client to every collector that queries OBS, nil marks OBS as unreachable
+func (m *Monitor) bindClient(client *goobs.Client) {
+	for _, c := range m.collectors.Collectors() {
+		if oc, ok := c.(metric.ObsCollector); ok {
+			oc.SetClient(client)
+		}
+	}
+	m.connection.SetConnected(client != nil)
+}
+
+// streamServer is where OBS sends the stream to, the port is 0 when the URL doesn't name one
+type streamServer struct {
+	host string
+	port int
+	tls  bool
+}
+
+// parseStreamServer splits a stream server URL, a URL without a scheme is taken as RTMP
+func parseStreamServer(rawURL string) (streamServer, error) {
 	if !strings.Contains(rawURL, "://") {
 		rawURL = "rtmp://" + rawURL
 	}
 
 	parsedURL, err := url.Parse(rawURL)
 	if err != nil {
-		return "", err
+		return streamServer{}, err
 	}
 
-	host := parsedURL.Hostname()
-	if host == "" {
-		return "", fmt.Errorf("no hostname found in URL")
+	server := streamServer{
+		host: parsedURL.Hostname(),
+		tls:  strings.EqualFold(parsedURL.Scheme, "rtmps"),
+	}
+	if server.host == "" {
+		return streamServer{}, fmt.Errorf("no hostname found in URL")
+	}
+	if p := parsedURL.Port(); p != "" {
+		if server.port, err = strconv.Atoi(p); err != nil {
+			return streamServer{}, fmt.Errorf("invalid port in URL: %w", err)
+		}
 	}
 
-	return host, nil
+	return server, nil
 }
@@ -1,8 +1,18 @@
 package monitor
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
 	"testing"
 	"time"
+
+	"github.com/andreykaipov/goobs/api/closecodes"
+	"github.com/gorilla/websocket"
+	"github.com/joepadmiraal/metrics-for-obs/internal/metric"
+	"github.com/joepadmiraal/metrics-for-obs/internal/writer"
 )
 
 func TestExtractDomain_FullRTMPURL(t *testing.T) {
@@ -35,12 +45,12 @@ func TestExtractDomain_FullRTMPURL(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			domain, err := extractDomain(tt.url)
+			server, err := parseStreamServer(tt.url)
 			if err != nil {
-				t.Fatalf("extractDomain failed: %v", err)
+				t.Fatalf("parseStreamServer failed: %v", err)
 			}
-			if domain != tt.expected {
-				t.Errorf("Expected domain %s, got %s", tt.expected, domain)
+			if server.host != tt.expected {
+				t.Errorf("Expected domain %s, got %s", tt.expected, server.host)
 			}
 		})
 	}
@@ -71,12 +81,12 @@ func TestExtractDomain_URLWithoutProtocol(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			domain, err := extractDomain(tt.url)
+			server, err := parseStreamServer(tt.url)
 			if err != nil {
-				t.Fatalf("extractDomain failed: %v", err)
+				t.Fatalf("parseStreamServer failed: %v", err)
 			}
-			if domain != tt.expected {
-				t.Errorf("Expected domain %s, got %s", tt.expected, domain)
+			if server.host != tt.expected {
+				t.Errorf("Expected domain %s, got %s", tt.expected, server.host)
 			}
 		})
 	}
@@ -99,7 +109,7 @@ func TestExtractDomain_InvalidURLs(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			_, err := extractDomain(tt.url)
+			_, err := parseStreamServer(tt.url)
 			if err == nil {
 				t.Error("Expected error for invalid URL")
 			}
@@ -107,6 +117,31 @@ func TestExtractDomain_InvalidURLs(t *testing.T) {
 	}
 }
 
+func TestParseStreamServer_PortAndTLS(t *testing.T) {
+	tests := []struct {
+		url      string
+		expected streamServer
+	}{
+		{url: "rtmp://live.twitch.tv/app", expected: streamServer{host: "live.twitch.tv"}},
+		{url: "rtmps://live.twitch.tv/app", expected: streamServer{host: "live.twitch.tv", tls: true}},
+		{url: "rtmps://a.rtmps.youtube.com:443/live2", expected: streamServer{host: "a.rtmps.youtube.com", port: 443, tls: true}},
+		{url: "RTMPS://ingest.example.com:8443/app", expected: streamServer{host: "ingest.example.com", port: 8443, tls: true}},
+		{url: "live.twitch.tv:1936/app", expected: streamServer{host: "live.twitch.tv", port: 1936}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			server, err := parseStreamServer(tt.url)
+			if err != nil {
+				t.Fatalf("parseStreamServer failed: %v", err)
+			}
+			if server != tt.expected {
+				t.Errorf("Expected %+v, got %+v", tt.expected, server)
+			}
+		})
+	}
+}
+
 func TestNewMonitor_Initialization(t *testing.T) {
 	connInfo := ObsConnectionInfo{
 		Password:       "test-password",
@@ -156,3 +191,189 @@ func TestMonitor_Shutdown(t *testing.T) {
 		t.Error("Context not cancelled after Shutdown")
 	}
 }
+
+type nopWriter struct{}
+
+func (nopWriter) WriteMetrics(data writer.MetricsData) error { return nil }
+func (nopWriter) Close() error                               { return nil }
+
+func TestMonitor_AddWriter(t *testing.T) {
+	monitor, err := NewMonitor(ObsConnectionInfo{Host: "localhost:4455", MetricInterval: 1000, WriterInterval: 1000})
+	if err != nil {
+		t.Fatalf("NewMonitor failed: %v", err)
+	}
+
+	if err := monitor.AddWriter("custom", nopWriter{}); err != nil {
+		t.Fatalf("AddWriter failed: %v", err)
+	}
+	if err := monitor.AddWriter("custom", nopWriter{}); err == nil {
+		t.Error("Expected error when adding a writer with a duplicate name")
+	}
+
+	names := monitor.writers.Names()
+	if len(names) != 1 || names[0] != "custom" {
+		t.Errorf("Expected registered writers [custom], got %v", names)
+	}
+}
+
+type nopCollector struct{}
+
+func (nopCollector) Name() string                    { return "custom" }
+func (nopCollector) Fields() []metric.Field          { return []metric.Field{{Name: "custom_value"}} }
+func (nopCollector) Start(ctx context.Context) error { return nil }
+func (nopCollector) Collect() ([]metric.Sample, error) {
+	return nil, nil
+}
+
+func TestMonitor_AddCollector(t *testing.T) {
+	monitor, err := NewMonitor(ObsConnectionInfo{Host: "localhost:4455", MetricInterval: 1000, WriterInterval: 1000})
+	if err != nil {
+		t.Fatalf("NewMonitor failed: %v", err)
+	}
+
+	if err := monitor.AddCollector(nopCollector{}); err != nil {
+		t.Fatalf("AddCollector failed: %v", err)
+	}
+	if err := monitor.AddCollector(nopCollector{}); err == nil {
+		t.Error("Expected error when adding a collector with a duplicate name")
+	}
+
+	if err := monitor.initializeCollectors(streamServer{host: "example.com"}); err != nil {
+		t.Fatalf("initializeCollectors failed: %v", err)
+	}
+
+	fields := monitor.collectors.Fields()
+	if fields[0].Name != "obs_rtt_ms" {
+		t.Errorf("Expected built-in fields first, got %s", fields[0].Name)
+	}
+	if fields[len(fields)-1].Name != "custom_value" {
+		t.Errorf("Expected custom field last, got %s", fields[len(fields)-1].Name)
+	}
+}
+
+func TestMonitor_InitializeCollectors_PingTargets(t *testing.T) {
+	tests := []struct {
+		name     string
+		targets  []metric.PingTarget
+		expected []string
+	}{
+		{
+			name:     "default targets",
+			targets:  nil,
+			expected: []string{"obs_rtt_ms", "google_rtt_ms"},
+		},
+		{
+			name:     "configured targets",
+			targets:  []metric.PingTarget{{Name: "cdn", Host: "edge.example.com"}, {Name: "gateway", Host: "192.168.1.1"}},
+			expected: []string{"obs_rtt_ms", "cdn_rtt_ms", "gateway_rtt_ms"},
+		},
+		{
+			name:     "no targets",
+			targets:  []metric.PingTarget{},
+			expected: []string{"obs_rtt_ms"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			monitor, err := NewMonitor(ObsConnectionInfo{Host: "localhost:4455", MetricInterval: 1000, WriterInterval: 1000, PingTargets: tt.targets})
+			if err != nil {
+				t.Fatalf("NewMonitor failed: %v", err)
+			}
+			if err := monitor.initializeCollectors(streamServer{host: "example.com"}); err != nil {
+				t.Fatalf("initializeCollectors failed: %v", err)
+			}
+
+			var rtts []string
+			for _, f := range monitor.collectors.Fields() {
+				if strings.HasSuffix(f.Name, "_rtt_ms") {
+					rtts = append(rtts, f.Name)
+				}
+			}
+			if strings.Join(rtts, ",") != strings.Join(tt.expected, ",") {
+				t.Errorf("Expected RTT columns %v, got %v", tt.expected, rtts)
+			}
+		})
+	}
+}
+
+func TestIsAuthenticationError(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		expected bool
+	}{
+		{
+			name:     "authentication failed",
+			err:      &websocket.CloseError{Code: closecodes.AuthenticationFailed},
+			expected: true,
+		},
+		{
+			name:     "wrapped authentication failed",
+			err:      fmt.Errorf("connect: %w", &websocket.CloseError{Code: closecodes.AuthenticationFailed}),
+			expected: true,
+		},
+		{
+			name:     "abnormal closure",
+			err:      &websocket.CloseError{Code: websocket.CloseAbnormalClosure},
+			expected: false,
+		},
+		{
+			name:     "connection refused",
+			err:      errors.New("dial tcp 127.0.0.1:4455: connect: connection refused"),
+			expected: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isAuthenticationError(tt.err); got != tt.expected {
+				t.Errorf("isAuthenticationError(%v) = %v, expected %v", tt.err, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestTargetBitrate(t *testing.T) {
+	tests := []struct {
+		bitrate  string
+		expected float64
+	}{
+		{bitrate: "6000", expected: 6000},
+		{bitrate: "2500.5", expected: 2500.5},
+		{bitrate: "", expected: 0},
+		{bitrate: "fast", expected: 0},
+	}
+
+	for _, tt := range tests {
+		if got := targetBitrate(writer.Session{Bitrate: tt.bitrate}); got != tt.expected {
+			t.Errorf("targetBitrate(%q) = %v, expected %v", tt.bitrate, got, tt.expected)
+		}
+	}
+}
+
+func TestWatchedConn_Read_MarksLost(t *testing.T) {
+	client, server := net.Pipe()
+	watcher := &connWatcher{lost: make(chan struct{})}
+	conn := &watchedConn{Conn: client, watcher: watcher}
+
+	go server.Write([]byte("hello"))
+	if _, err := conn.Read(make([]byte, 5)); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	select {
+	case <-watcher.lost:
+		t.Fatal("Expected a successful read not to mark the connection lost")
+	default:
+	}
+
+	server.Close()
+	if _, err := conn.Read(make([]byte, 5)); err == nil {
+		t.Fatal("Expected a read error after the peer closed")
+	}
+	select {
+	case <-watcher.lost:
+	default:
+		t.Error("Expected a failed read to mark the connection lost")
+	}
+}
@@ -2,6 +2,7 @@ package writer
 
 import (
 	"fmt"
+	"strings"
 	"time"
 )
 
@@ -19,66 +20,46 @@ func NewConsoleWriter() *ConsoleWriter {
 
 // WriteMetrics writes a single metrics data row to the console
 func (cw *ConsoleWriter) WriteMetrics(data MetricsData) error {
-	// Print header on first call
+	// Print header on first call, each column is as wide as its name
 	if !cw.headerPrinted {
-		fmt.Println("timestamp                 | obs_rtt_ms | google_rtt_ms | stream_active | output_bytes | output_skipped_frames | output_frames | obs_cpu_% | obs_mem_mb | sys_cpu_% | sys_mem_% | errors")
-		fmt.Println("--------------------------|------------|---------------|---------------|--------------|-----------------------|---------------|-----------|------------|-----------|-----------|--------")
+		header := []string{fmt.Sprintf("%-25s", "timestamp")}
+		separator := []string{strings.Repeat("-", 26)}
+		for _, s := range data.Samples {
+			header = append(header, s.Name)
+			separator = append(separator, strings.Repeat("-", len(s.Name)+2))
+		}
+		fmt.Println(strings.Join(header, " | ") + " | errors")
+		fmt.Println(strings.Join(separator, "|") + "|--------")
 		cw.headerPrinted = true
 	}
 
-	obsRttMs := "         -"
-	if data.ObsPingError == nil && data.ObsRTT > 0 {
-		obsRttMs = fmt.Sprintf("%10.2f", float64(data.ObsRTT.Microseconds())/1000.0)
+	columns := []string{fmt.Sprintf("%25s", data.Timestamp.Format(time.RFC3339))}
+	for _, s := range data.Samples {
+		value := formatValue(s)
+		if value == "" {
+			value = "-"
+		}
+		columns = append(columns, fmt.Sprintf("%*s", len(s.Name), value))
 	}
 
-	googleRttMs := "            -"
-	if data.GooglePingError == nil && data.GoogleRTT > 0 {
-		googleRttMs = fmt.Sprintf("%13.2f", float64(data.GoogleRTT.Microseconds())/1000.0)
-	}
+	fmt.Printf("%s | %s\n", strings.Join(columns, " | "), data.ErrorString())
 
-	errors := ""
-	if data.ObsPingError != nil {
-		errors = fmt.Sprintf("obs_ping: %v", data.ObsPingError)
-	}
-	if data.GooglePingError != nil {
-		if errors != "" {
-			errors += "; "
-		}
-		errors += fmt.Sprintf("google_ping: %v", data.GooglePingError)
-	}
-	if data.StreamError != nil {
-		if errors != "" {
-			errors += "; "
-		}
-		errors += fmt.Sprintf("stream: %v", data.StreamError)
-	}
-	if data.ObsStatsError != nil {
-		if errors != "" {
-			errors += "; "
-		}
-		errors += fmt.Sprintf("obs_stats: %v", data.ObsStatsError)
-	}
-	if data.SystemMetricsError != nil {
-		if errors != "" {
-			errors += "; "
+	return nil
+}
+
+// WriteSession prints the OBS settings on a single line, settings OBS didn't report are left out
+func (cw *ConsoleWriter) WriteSession(session Session) error {
+	var settings []string
+	for _, a := range session.attributes() {
+		if a.value != "" && a.key != "os" {
+			settings = append(settings, fmt.Sprintf("%s: %s", a.label, a.value))
 		}
-		errors += fmt.Sprintf("system: %v", data.SystemMetricsError)
 	}
+	fmt.Printf("OBS settings: %s\n", strings.Join(settings, ", "))
+	return nil
+}
 
-	fmt.Printf("%25s | %10s | %13s | %13t | %12.0f | %21.0f | %13.0f | %9.1f | %10.0f | %9.1f | %9.1f | %s\n",
-		data.Timestamp.Format(time.RFC3339),
-		obsRttMs,
-		googleRttMs,
-		data.StreamActive,
-		data.OutputBytes,
-		data.OutputSkippedFrames,
-		data.OutputFrames,
-		data.ObsCpuUsage,
-		data.ObsMemoryUsage,
-		data.SystemCpuUsage,
-		data.SystemMemoryUsage,
-		errors,
-	)
-
+// Close is a no-op, the console does not need to be released
+func (cw *ConsoleWriter) Close() error {
 	return nil
 }
@@ -8,6 +8,8 @@ import (
 	"strings"
 	"testing"
 	"time"
+
+	"github.com/joepadmiraal/metrics-for-obs/internal/metric"
 )
 
 func TestConsoleWriter_WriteMetrics_HighRTT(t *testing.T) {
@@ -19,17 +21,13 @@ func TestConsoleWriter_WriteMetrics_HighRTT(t *testing.T) {
 	cw := NewConsoleWriter()
 
 	// Test with 1001ms RTT (1001000 microseconds)
-	data := MetricsData{
-		Timestamp:           time.Date(2025, 12, 16, 10, 0, 0, 0, time.UTC),
-		ObsRTT:              1001 * time.Millisecond,
-		ObsPingError:        nil,
-		GoogleRTT:           25 * time.Millisecond,
-		GooglePingError:     nil,
-		StreamActive:        true,
-		OutputBytes:         123456.0,
-		OutputSkippedFrames: 10.0,
-		StreamError:         nil,
-	}
+	data := newTestData(time.Date(2025, 12, 16, 10, 0, 0, 0, time.UTC), map[string]any{
+		"obs_rtt_ms":            1001 * time.Millisecond,
+		"google_rtt_ms":         25 * time.Millisecond,
+		"stream_active":         true,
+		"output_bytes":          123456.0,
+		"output_skipped_frames": 10.0,
+	})
 
 	err := cw.WriteMetrics(data)
 	if err != nil {
@@ -96,14 +94,13 @@ func TestConsoleWriter_WriteMetrics_NormalRTT(t *testing.T) {
 
 	cw := NewConsoleWriter()
 
-	data := MetricsData{
-		Timestamp:           time.Date(2025, 12, 23, 10, 0, 0, 0, time.UTC),
-		ObsRTT:              50 * time.Millisecond,
-		GoogleRTT:           25 * time.Millisecond,
-		StreamActive:        true,
-		OutputBytes:         1024.0,
-		OutputSkippedFrames: 5.0,
-	}
+	data := newTestData(time.Date(2025, 12, 23, 10, 0, 0, 0, time.UTC), map[string]any{
+		"obs_rtt_ms":            50 * time.Millisecond,
+		"google_rtt_ms":         25 * time.Millisecond,
+		"stream_active":         true,
+		"output_bytes":          1024.0,
+		"output_skipped_frames": 5.0,
+	})
 
 	err := cw.WriteMetrics(data)
 	if err != nil {
@@ -129,14 +126,11 @@ func TestConsoleWriter_WriteMetrics_ZeroValues(t *testing.T) {
 
 	cw := NewConsoleWriter()
 
-	data := MetricsData{
-		Timestamp:           time.Date(2025, 12, 23, 10, 0, 0, 0, time.UTC),
-		ObsRTT:              0,
-		GoogleRTT:           0,
-		StreamActive:        false,
-		OutputBytes:         0,
-		OutputSkippedFrames: 0,
-	}
+	data := newTestData(time.Date(2025, 12, 23, 10, 0, 0, 0, time.UTC), map[string]any{
+		"stream_active":         false,
+		"output_bytes":          0.0,
+		"output_skipped_frames": 0.0,
+	})
 
 	err := cw.WriteMetrics(data)
 	if err != nil {
@@ -166,14 +160,12 @@ func TestConsoleWriter_WriteMetrics_WithErrors(t *testing.T) {
 	obsErr := fmt.Errorf("obs ping error")
 	googleErr := fmt.Errorf("google ping error")
 
-	data := MetricsData{
-		Timestamp:       time.Date(2025, 12, 23, 10, 0, 0, 0, time.UTC),
-		ObsRTT:          0,
-		ObsPingError:    obsErr,
-		GoogleRTT:       0,
-		GooglePingError: googleErr,
-		StreamActive:    false,
-	}
+	data := newTestData(time.Date(2025, 12, 23, 10, 0, 0, 0, time.UTC), map[string]any{
+		"stream_active": false,
+	},
+		metric.SourceError{Source: "obs_ping", Err: obsErr},
+		metric.SourceError{Source: "google_ping", Err: googleErr},
+	)
 
 	err := cw.WriteMetrics(data)
 	if err != nil {
@@ -187,8 +179,8 @@ func TestConsoleWriter_WriteMetrics_WithErrors(t *testing.T) {
 	io.Copy(&buf, r)
 	output := buf.String()
 
-	if len(output) == 0 {
-		t.Error("Expected some output even with errors")
+	if !strings.Contains(output, "obs_ping: obs ping error; google_ping: google ping error") {
+		t.Errorf("Expected errors in output, got: %s", output)
 	}
 }
 
@@ -199,12 +191,11 @@ func TestConsoleWriter_WriteMetrics_InactiveStream(t *testing.T) {
 
 	cw := NewConsoleWriter()
 
-	data := MetricsData{
-		Timestamp:    time.Date(2025, 12, 23, 10, 0, 0, 0, time.UTC),
-		ObsRTT:       50 * time.Millisecond,
-		GoogleRTT:    25 * time.Millisecond,
-		StreamActive: false,
-	}
+	data := newTestData(time.Date(2025, 12, 23, 10, 0, 0, 0, time.UTC), map[string]any{
+		"obs_rtt_ms":    50 * time.Millisecond,
+		"google_rtt_ms": 25 * time.Millisecond,
+		"stream_active": false,
+	})
 
 	err := cw.WriteMetrics(data)
 	if err != nil {
@@ -231,24 +222,21 @@ func TestConsoleWriter_WriteMetrics_FormattingConsistency(t *testing.T) {
 	cw := NewConsoleWriter()
 
 	testCases := []MetricsData{
-		{
-			Timestamp:    time.Date(2025, 12, 23, 10, 0, 0, 0, time.UTC),
-			ObsRTT:       50 * time.Millisecond,
-			GoogleRTT:    25 * time.Millisecond,
-			StreamActive: true,
-		},
-		{
-			Timestamp:    time.Date(2025, 12, 23, 10, 1, 0, 0, time.UTC),
-			ObsRTT:       100 * time.Millisecond,
-			GoogleRTT:    50 * time.Millisecond,
-			StreamActive: true,
-		},
-		{
-			Timestamp:    time.Date(2025, 12, 23, 10, 2, 0, 0, time.UTC),
-			ObsRTT:       75 * time.Millisecond,
-			GoogleRTT:    30 * time.Millisecond,
-			StreamActive: false,
-		},
+		newTestData(time.Date(2025, 12, 23, 10, 0, 0, 0, time.UTC), map[string]any{
+			"obs_rtt_ms":    50 * time.Millisecond,
+			"google_rtt_ms": 25 * time.Millisecond,
+			"stream_active": true,
+		}),
+		newTestData(time.Date(2025, 12, 23, 10, 1, 0, 0, time.UTC), map[string]any{
+			"obs_rtt_ms":    100 * time.Millisecond,
+			"google_rtt_ms": 50 * time.Millisecond,
+			"stream_active": true,
+		}),
+		newTestData(time.Date(2025, 12, 23, 10, 2, 0, 0, time.UTC), map[string]any{
+			"obs_rtt_ms":    75 * time.Millisecond,
+			"google_rtt_ms": 30 * time.Millisecond,
+			"stream_active": false,
+		}),
 	}
 
 	for _, data := range testCases {
@@ -290,19 +278,18 @@ func TestConsoleWriter_WriteMetrics_AllMetrics(t *testing.T) {
 
 	cw := NewConsoleWriter()
 
-	data := MetricsData{
-		Timestamp:           time.Date(2025, 12, 23, 10, 0, 0, 0, time.UTC),
-		ObsRTT:              50 * time.Millisecond,
-		GoogleRTT:           25 * time.Millisecond,
-		StreamActive:        true,
-		OutputBytes:         1024.0,
-		OutputSkippedFrames: 5.0,
-		OutputFrames:        100.0,
-		ObsCpuUsage:         15.5,
-		ObsMemoryUsage:      512.0,
-		SystemCpuUsage:      45.2,
-		SystemMemoryUsage:   60.0,
-	}
+	data := newTestData(time.Date(2025, 12, 23, 10, 0, 0, 0, time.UTC), map[string]any{
+		"obs_rtt_ms":            50 * time.Millisecond,
+		"google_rtt_ms":         25 * time.Millisecond,
+		"stream_active":         true,
+		"output_bytes":          1024.0,
+		"output_skipped_frames": 5.0,
+		"output_frames":         100.0,
+		"obs_cpu_percent":       15.5,
+		"obs_memory_mb":         512.0,
+		"system_cpu_percent":    45.2,
+		"system_memory_percent": 60.0,
+	})
 
 	err := cw.WriteMetrics(data)
 	if err != nil {
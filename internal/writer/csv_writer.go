@@ -4,20 +4,23 @@ import (
 	"encoding/csv"
 	"fmt"
 	"os"
-	"runtime"
 	"sync"
 	"time"
+
+	"github.com/joepadmiraal/metrics-for-obs/internal/metric"
 )
 
 // CSVWriter handles writing metrics to a CSV file
 type CSVWriter struct {
 	file   *os.File
 	writer *csv.Writer
+	fields []metric.Field
 	mu     sync.Mutex
 }
 
-// NewCSVWriter creates a new CSV writer and writes the header
-func NewCSVWriter(filename, obsVersion, streamDomain string) (*CSVWriter, error) {
+// NewCSVWriter creates a new CSV writer and writes a line describing the OBS setup followed by a
+// header containing a column per field
+func NewCSVWriter(filename string, session Session, fields []metric.Field) (*CSVWriter, error) {
 	file, err := os.Create(filename)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create CSV file: %w", err)
@@ -26,31 +29,17 @@ func NewCSVWriter(filename, obsVersion, streamDomain string) (*CSVWriter, error)
 	writer := csv.NewWriter(file)
 
 	// Write header information
-	headerInfo := []string{
-		fmt.Sprintf("OBS Studio version: %s", obsVersion),
-		fmt.Sprintf("Stream domain: %s", streamDomain),
-		fmt.Sprintf("OS: %s", runtime.GOOS),
-	}
-	if err := writer.Write(headerInfo); err != nil {
+	if err := writer.Write(csvSession(session)); err != nil {
 		file.Close()
 		return nil, fmt.Errorf("failed to write CSV header info: %w", err)
 	}
 
 	// Write column header
-	header := []string{
-		"timestamp",
-		"obs_rtt_ms",
-		"google_rtt_ms",
-		"stream_active",
-		"output_bytes",
-		"output_skipped_frames",
-		"output_frames",
-		"obs_cpu_percent",
-		"obs_memory_mb",
-		"system_cpu_percent",
-		"system_memory_percent",
-		"errors",
+	header := []string{"timestamp"}
+	for _, f := range fields {
+		header = append(header, f.Name)
 	}
+	header = append(header, "errors")
 	if err := writer.Write(header); err != nil {
 		file.Close()
 		return nil, fmt.Errorf("failed to write CSV header: %w", err)
@@ -60,67 +49,48 @@ func NewCSVWriter(filename, obsVersion, streamDomain string) (*CSVWriter, error)
 	return &CSVWriter{
 		file:   file,
 		writer: writer,
+		fields: fields,
 	}, nil
 }
 
-// WriteMetrics writes a single metrics data row to the CSV file
-func (cw *CSVWriter) WriteMetrics(data MetricsData) error {
+// WriteSession writes a changed OBS setup between the rows, as a line starting with session and the
+// time of the change followed by the same cells as the first line
+func (cw *CSVWriter) WriteSession(session Session) error {
 	cw.mu.Lock()
 	defer cw.mu.Unlock()
 
-	obsRttMs := ""
-	if data.ObsPingError == nil && data.ObsRTT > 0 {
-		obsRttMs = fmt.Sprintf("%.2f", float64(data.ObsRTT.Microseconds())/1000.0)
+	line := append([]string{"session", time.Now().Format(time.RFC3339)}, csvSession(session)...)
+	if err := cw.writer.Write(line); err != nil {
+		return fmt.Errorf("failed to write CSV session: %w", err)
 	}
+	cw.writer.Flush()
 
-	googleRttMs := ""
-	if data.GooglePingError == nil && data.GoogleRTT > 0 {
-		googleRttMs = fmt.Sprintf("%.2f", float64(data.GoogleRTT.Microseconds())/1000.0)
-	}
+	return cw.writer.Error()
+}
 
-	errors := ""
-	if data.ObsPingError != nil {
-		errors = fmt.Sprintf("obs_ping: %v", data.ObsPingError)
-	}
-	if data.GooglePingError != nil {
-		if errors != "" {
-			errors += "; "
-		}
-		errors += fmt.Sprintf("google_ping: %v", data.GooglePingError)
-	}
-	if data.StreamError != nil {
-		if errors != "" {
-			errors += "; "
-		}
-		errors += fmt.Sprintf("stream: %v", data.StreamError)
-	}
-	if data.ObsStatsError != nil {
-		if errors != "" {
-			errors += "; "
-		}
-		errors += fmt.Sprintf("obs_stats: %v", data.ObsStatsError)
-	}
-	if data.SystemMetricsError != nil {
-		if errors != "" {
-			errors += "; "
-		}
-		errors += fmt.Sprintf("system: %v", data.SystemMetricsError)
+// csvSession returns the setup as Label: value cells
+func csvSession(session Session) []string {
+	var cells []string
+	for _, a := range session.attributes() {
+		cells = append(cells, fmt.Sprintf("%s: %s", a.label, a.value))
 	}
+	return cells
+}
 
-	row := []string{
-		data.Timestamp.Format(time.RFC3339),
-		obsRttMs,
-		googleRttMs,
-		fmt.Sprintf("%t", data.StreamActive),
-		fmt.Sprintf("%.0f", data.OutputBytes),
-		fmt.Sprintf("%.0f", data.OutputSkippedFrames),
-		fmt.Sprintf("%.0f", data.OutputFrames),
-		fmt.Sprintf("%.2f", data.ObsCpuUsage),
-		fmt.Sprintf("%.2f", data.ObsMemoryUsage),
-		fmt.Sprintf("%.2f", data.SystemCpuUsage),
-		fmt.Sprintf("%.2f", data.SystemMemoryUsage),
-		errors,
+// WriteMetrics writes a single metrics data row to the CSV file
+func (cw *CSVWriter) WriteMetrics(data MetricsData) error {
+	cw.mu.Lock()
+	defer cw.mu.Unlock()
+
+	row := []string{data.Timestamp.Format(time.RFC3339)}
+	for _, f := range cw.fields {
+		value := ""
+		if s, ok := data.Sample(f.Name); ok {
+			value = formatValue(s)
+		}
+		row = append(row, value)
 	}
+	row = append(row, data.ErrorString())
 
 	if err := cw.writer.Write(row); err != nil {
 		return fmt.Errorf("failed to write CSV row: %w", err)
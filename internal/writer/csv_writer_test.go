@@ -7,13 +7,15 @@ import (
 	"strings"
 	"testing"
 	"time"
+
+	"github.com/joepadmiraal/metrics-for-obs/internal/metric"
 )
 
 func TestCSVWriter_NewCSVWriter_CreatesFile(t *testing.T) {
 	tmpDir := t.TempDir()
 	filename := filepath.Join(tmpDir, "test.csv")
 
-	cw, err := NewCSVWriter(filename, "30.0.0", "live.twitch.tv")
+	cw, err := NewCSVWriter(filename, testSession, testFields)
 
 	if err != nil {
 		t.Fatalf("NewCSVWriter failed: %v", err)
@@ -31,10 +33,7 @@ func TestCSVWriter_NewCSVWriter_CreatesFile(t *testing.T) {
 func TestCSVWriter_NewCSVWriter_WritesHeaders(t *testing.T) {
 	tmpDir := t.TempDir()
 	filename := filepath.Join(tmpDir, "test.csv")
-	obsVersion := "30.0.0"
-	streamDomain := "live.twitch.tv"
-
-	cw, err := NewCSVWriter(filename, obsVersion, streamDomain)
+	cw, err := NewCSVWriter(filename, testSession, testFields)
 	if err != nil {
 		t.Fatalf("NewCSVWriter failed: %v", err)
 	}
@@ -47,11 +46,10 @@ func TestCSVWriter_NewCSVWriter_WritesHeaders(t *testing.T) {
 
 	contentStr := string(content)
 
-	if !strings.Contains(contentStr, obsVersion) {
-		t.Error("CSV header should contain OBS version")
-	}
-	if !strings.Contains(contentStr, streamDomain) {
-		t.Error("CSV header should contain stream domain")
+	for _, info := range []string{"OBS Studio version: 30.0.0", "Stream domain: live.twitch.tv", "Output resolution: 1280x720", "Encoder: x264", "Bitrate (kbps): 6000"} {
+		if !strings.Contains(contentStr, info) {
+			t.Errorf("CSV header should contain %q", info)
+		}
 	}
 	if !strings.Contains(contentStr, "timestamp") {
 		t.Error("CSV header should contain column names")
@@ -62,24 +60,23 @@ func TestCSVWriter_WriteMetrics_SingleRow(t *testing.T) {
 	tmpDir := t.TempDir()
 	filename := filepath.Join(tmpDir, "test.csv")
 
-	cw, err := NewCSVWriter(filename, "30.0.0", "live.twitch.tv")
+	cw, err := NewCSVWriter(filename, testSession, testFields)
 	if err != nil {
 		t.Fatalf("NewCSVWriter failed: %v", err)
 	}
 
-	data := MetricsData{
-		Timestamp:           time.Date(2025, 12, 23, 10, 0, 0, 0, time.UTC),
-		ObsRTT:              50 * time.Millisecond,
-		GoogleRTT:           25 * time.Millisecond,
-		StreamActive:        true,
-		OutputBytes:         1024.0,
-		OutputSkippedFrames: 5.0,
-		OutputFrames:        100.0,
-		ObsCpuUsage:         15.5,
-		ObsMemoryUsage:      512.0,
-		SystemCpuUsage:      45.2,
-		SystemMemoryUsage:   60.0,
-	}
+	data := newTestData(time.Date(2025, 12, 23, 10, 0, 0, 0, time.UTC), map[string]any{
+		"obs_rtt_ms":            50 * time.Millisecond,
+		"google_rtt_ms":         25 * time.Millisecond,
+		"stream_active":         true,
+		"output_bytes":          1024.0,
+		"output_skipped_frames": 5.0,
+		"output_frames":         100.0,
+		"obs_cpu_percent":       15.5,
+		"obs_memory_mb":         512.0,
+		"system_cpu_percent":    45.2,
+		"system_memory_percent": 60.0,
+	})
 
 	err = cw.WriteMetrics(data)
 	if err != nil {
@@ -113,17 +110,16 @@ func TestCSVWriter_WriteMetrics_MultipleRows(t *testing.T) {
 	tmpDir := t.TempDir()
 	filename := filepath.Join(tmpDir, "test.csv")
 
-	cw, err := NewCSVWriter(filename, "30.0.0", "live.twitch.tv")
+	cw, err := NewCSVWriter(filename, testSession, testFields)
 	if err != nil {
 		t.Fatalf("NewCSVWriter failed: %v", err)
 	}
 
 	for i := 0; i < 3; i++ {
-		data := MetricsData{
-			Timestamp:    time.Date(2025, 12, 23, 10, i, 0, 0, time.UTC),
-			ObsRTT:       time.Duration(i*10) * time.Millisecond,
-			StreamActive: true,
-		}
+		data := newTestData(time.Date(2025, 12, 23, 10, i, 0, 0, time.UTC), map[string]any{
+			"obs_rtt_ms":    time.Duration(i*10) * time.Millisecond,
+			"stream_active": true,
+		})
 		err = cw.WriteMetrics(data)
 		if err != nil {
 			t.Fatalf("WriteMetrics failed on iteration %d: %v", i, err)
@@ -146,7 +142,7 @@ func TestCSVWriter_WriteMetrics_WithErrors(t *testing.T) {
 	tmpDir := t.TempDir()
 	filename := filepath.Join(tmpDir, "test.csv")
 
-	cw, err := NewCSVWriter(filename, "30.0.0", "live.twitch.tv")
+	cw, err := NewCSVWriter(filename, testSession, testFields)
 	if err != nil {
 		t.Fatalf("NewCSVWriter failed: %v", err)
 	}
@@ -154,12 +150,12 @@ func TestCSVWriter_WriteMetrics_WithErrors(t *testing.T) {
 	obsErr := fmt.Errorf("obs ping failed")
 	streamErr := fmt.Errorf("stream error")
 
-	data := MetricsData{
-		Timestamp:    time.Date(2025, 12, 23, 10, 0, 0, 0, time.UTC),
-		ObsPingError: obsErr,
-		StreamError:  streamErr,
-		StreamActive: false,
-	}
+	data := newTestData(time.Date(2025, 12, 23, 10, 0, 0, 0, time.UTC), map[string]any{
+		"stream_active": false,
+	},
+		metric.SourceError{Source: "obs_ping", Err: obsErr},
+		metric.SourceError{Source: "stream", Err: streamErr},
+	)
 
 	err = cw.WriteMetrics(data)
 	if err != nil {
@@ -184,7 +180,7 @@ func TestCSVWriter_WriteMetrics_WithErrors(t *testing.T) {
 func TestCSVWriter_NewCSVWriter_InvalidPath(t *testing.T) {
 	filename := "/invalid/path/that/does/not/exist/test.csv"
 
-	_, err := NewCSVWriter(filename, "30.0.0", "live.twitch.tv")
+	_, err := NewCSVWriter(filename, testSession, testFields)
 
 	if err == nil {
 		t.Error("Expected error when creating file in invalid path")
@@ -195,15 +191,12 @@ func TestCSVWriter_Close_FlushesData(t *testing.T) {
 	tmpDir := t.TempDir()
 	filename := filepath.Join(tmpDir, "test.csv")
 
-	cw, err := NewCSVWriter(filename, "30.0.0", "live.twitch.tv")
+	cw, err := NewCSVWriter(filename, testSession, testFields)
 	if err != nil {
 		t.Fatalf("NewCSVWriter failed: %v", err)
 	}
 
-	data := MetricsData{
-		Timestamp:    time.Now(),
-		StreamActive: true,
-	}
+	data := newTestData(time.Now(), map[string]any{"stream_active": true})
 	_ = cw.WriteMetrics(data)
 
 	err = cw.Close()
@@ -225,24 +218,21 @@ func TestCSVWriter_WriteMetrics_ZeroValues(t *testing.T) {
 	tmpDir := t.TempDir()
 	filename := filepath.Join(tmpDir, "test.csv")
 
-	cw, err := NewCSVWriter(filename, "30.0.0", "live.twitch.tv")
+	cw, err := NewCSVWriter(filename, testSession, testFields)
 	if err != nil {
 		t.Fatalf("NewCSVWriter failed: %v", err)
 	}
 
-	data := MetricsData{
-		Timestamp:           time.Date(2025, 12, 23, 10, 0, 0, 0, time.UTC),
-		ObsRTT:              0,
-		GoogleRTT:           0,
-		StreamActive:        false,
-		OutputBytes:         0,
-		OutputSkippedFrames: 0,
-		OutputFrames:        0,
-		ObsCpuUsage:         0,
-		ObsMemoryUsage:      0,
-		SystemCpuUsage:      0,
-		SystemMemoryUsage:   0,
-	}
+	data := newTestData(time.Date(2025, 12, 23, 10, 0, 0, 0, time.UTC), map[string]any{
+		"stream_active":         false,
+		"output_bytes":          0.0,
+		"output_skipped_frames": 0.0,
+		"output_frames":         0.0,
+		"obs_cpu_percent":       0.0,
+		"obs_memory_mb":         0.0,
+		"system_cpu_percent":    0.0,
+		"system_memory_percent": 0.0,
+	})
 
 	err = cw.WriteMetrics(data)
 	if err != nil {
@@ -265,16 +255,14 @@ func TestCSVWriter_WriteMetrics_SpecialCharactersInError(t *testing.T) {
 	tmpDir := t.TempDir()
 	filename := filepath.Join(tmpDir, "test.csv")
 
-	cw, err := NewCSVWriter(filename, "30.0.0", "live.twitch.tv")
+	cw, err := NewCSVWriter(filename, testSession, testFields)
 	if err != nil {
 		t.Fatalf("NewCSVWriter failed: %v", err)
 	}
 
-	data := MetricsData{
-		Timestamp:    time.Now(),
-		StreamError:  fmt.Errorf("error with \"quotes\" and, commas"),
-		StreamActive: false,
-	}
+	data := newTestData(time.Now(), map[string]any{"stream_active": false},
+		metric.SourceError{Source: "stream", Err: fmt.Errorf("error with \"quotes\" and, commas")},
+	)
 
 	err = cw.WriteMetrics(data)
 	if err != nil {
@@ -296,17 +284,16 @@ func TestCSVWriter_WriteMetrics_HighRTTValues(t *testing.T) {
 	tmpDir := t.TempDir()
 	filename := filepath.Join(tmpDir, "test.csv")
 
-	cw, err := NewCSVWriter(filename, "30.0.0", "live.twitch.tv")
+	cw, err := NewCSVWriter(filename, testSession, testFields)
 	if err != nil {
 		t.Fatalf("NewCSVWriter failed: %v", err)
 	}
 
-	data := MetricsData{
-		Timestamp:    time.Now(),
-		ObsRTT:       1500 * time.Millisecond,
-		GoogleRTT:    2000 * time.Millisecond,
-		StreamActive: true,
-	}
+	data := newTestData(time.Now(), map[string]any{
+		"obs_rtt_ms":    1500 * time.Millisecond,
+		"google_rtt_ms": 2000 * time.Millisecond,
+		"stream_active": true,
+	})
 
 	err = cw.WriteMetrics(data)
 	if err != nil {
@@ -324,3 +311,79 @@ func TestCSVWriter_WriteMetrics_HighRTTValues(t *testing.T) {
 		t.Error("CSV should contain high RTT value in milliseconds")
 	}
 }
+
+func TestCSVWriter_WriteMetrics_ColumnsFollowFields(t *testing.T) {
+	tmpDir := t.TempDir()
+	filename := filepath.Join(tmpDir, "test.csv")
+	fields := []metric.Field{
+		{Name: "custom_value", Type: metric.FloatValue, Precision: 1},
+		{Name: "custom_flag", Type: metric.BoolValue},
+	}
+
+	cw, err := NewCSVWriter(filename, testSession, fields)
+	if err != nil {
+		t.Fatalf("NewCSVWriter failed: %v", err)
+	}
+
+	data := MetricsData{
+		Timestamp: time.Date(2025, 12, 23, 10, 0, 0, 0, time.UTC),
+		Samples: []metric.Sample{
+			{Field: fields[1], Value: true},
+			{Field: fields[0], Value: 2.34},
+		},
+	}
+	if err := cw.WriteMetrics(data); err != nil {
+		t.Fatalf("WriteMetrics failed: %v", err)
+	}
+	cw.Close()
+
+	content, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatalf("Failed to read CSV file: %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(string(content)), "\n")
+	if lines[1] != "timestamp,custom_value,custom_flag,errors" {
+		t.Errorf("Unexpected column header: %s", lines[1])
+	}
+	if lines[2] != "2025-12-23T10:00:00Z,2.3,true," {
+		t.Errorf("Unexpected data row: %s", lines[2])
+	}
+}
+
+func TestCSVWriter_WriteSession_WritesSessionLine(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "test.csv")
+	cw, err := NewCSVWriter(filename, testSession, testFields)
+	if err != nil {
+		t.Fatalf("NewCSVWriter failed: %v", err)
+	}
+
+	cw.WriteMetrics(newTestData(time.Now(), map[string]any{"obs_cpu_percent": 2.5}))
+	if err := cw.WriteSession(Session{ObsVersion: "31.0.0", StreamDomain: "a.rtmp.youtube.com", Encoder: "jim_nvenc"}); err != nil {
+		t.Fatalf("WriteSession failed: %v", err)
+	}
+	cw.WriteMetrics(newTestData(time.Now(), map[string]any{"obs_cpu_percent": 3.5}))
+	cw.Close()
+
+	content, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatalf("Failed to read CSV file: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(content)), "\n")
+	if len(lines) != 5 {
+		t.Fatalf("Expected setup, header, row, session and row lines, got %d lines", len(lines))
+	}
+
+	session := strings.Split(lines[3], ",")
+	if session[0] != "session" {
+		t.Errorf("Expected the line to start with session, got %q", lines[3])
+	}
+	if _, err := time.Parse(time.RFC3339, session[1]); err != nil {
+		t.Errorf("Expected the time of the change, got %q", session[1])
+	}
+	for _, info := range []string{"OBS Studio version: 31.0.0", "Stream domain: a.rtmp.youtube.com", "Encoder: jim_nvenc", "Bitrate (kbps): "} {
+		if !strings.Contains(lines[3], info) {
+			t.Errorf("Expected the session line to contain %q, got %q", info, lines[3])
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package writer
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/joepadmiraal/metrics-for-obs/internal/metric"
+)
+
+// EventLog writes every OBS event as a JSON object on its own line, with the exact time it was received
+type EventLog struct {
+	file *os.File
+	mu   sync.Mutex
+}
+
+type eventLogLine struct {
+	Timestamp string `json:"timestamp"`
+	Type      string `json:"type"`
+	Detail    string `json:"detail,omitempty"`
+}
+
+// NewEventLog creates the events log file
+func NewEventLog(filename string) (*EventLog, error) {
+	file, err := os.Create(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create events log: %w", err)
+	}
+	return &EventLog{file: file}, nil
+}
+
+// WriteEvent appends an event, lines are written unbuffered as events are rare
+func (el *EventLog) WriteEvent(e metric.Event) error {
+	line, err := json.Marshal(eventLogLine{
+		Timestamp: e.Time.Format(time.RFC3339Nano),
+		Type:      e.Type,
+		Detail:    e.Detail,
+	})
+	if err != nil {
+		return err
+	}
+
+	el.mu.Lock()
+	defer el.mu.Unlock()
+
+	if _, err := el.file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("failed to write event: %w", err)
+	}
+	return nil
+}
+
+// Close closes the events log
+func (el *EventLog) Close() error {
+	el.mu.Lock()
+	defer el.mu.Unlock()
+	return el.file.Close()
+}
@@ -0,0 +1,45 @@
+package writer
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/joepadmiraal/metrics-for-obs/internal/metric"
+)
+
+func TestEventLog_WriteEvent(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "events.jsonl")
+
+	el, err := NewEventLog(filename)
+	if err != nil {
+		t.Fatalf("NewEventLog failed: %v", err)
+	}
+	received := time.Date(2025, 12, 23, 15, 1, 25, 123456789, time.UTC)
+	el.WriteEvent(metric.Event{Time: received, Type: "CurrentProgramSceneChanged", Detail: "Gameplay"})
+	el.WriteEvent(metric.Event{Time: received, Type: "ExitStarted"})
+	if err := el.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	lines := readJSONLines(t, filename)
+	if len(lines) != 2 {
+		t.Fatalf("Expected 2 lines, got %d", len(lines))
+	}
+	if lines[0]["timestamp"] != "2025-12-23T15:01:25.123456789Z" {
+		t.Errorf("Expected the exact receive time, got %v", lines[0]["timestamp"])
+	}
+	if lines[0]["type"] != "CurrentProgramSceneChanged" || lines[0]["detail"] != "Gameplay" {
+		t.Errorf("Unexpected event %v", lines[0])
+	}
+	if _, ok := lines[1]["detail"]; ok {
+		t.Errorf("Expected no detail for an event without one, got %v", lines[1])
+	}
+}
+
+func TestEventLog_NewEventLog_InvalidPath(t *testing.T) {
+	_, err := NewEventLog(filepath.Join(t.TempDir(), "missing", "events.jsonl"))
+	if err == nil {
+		t.Error("Expected error for a path in a missing directory")
+	}
+}
@@ -0,0 +1,344 @@
+package writer
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/joepadmiraal/metrics-for-obs/internal/metric"
+)
+
+const influxMeasurement = "metrics_for_obs"
+
+// InfluxConfig configures the InfluxDB output, an empty URL disables it
+type InfluxConfig struct {
+	URL           string // http(s)://host:8086 for the v2 write API or udp://host:8089 for a UDP listener
+	Org           string
+	Bucket        string
+	Token         string
+	BatchSize     int           // rows per request, default 10
+	FlushInterval time.Duration // maximum time a row waits for its batch to fill, default 10s
+	MaxRetries    int           // retries of a failed batch before it is kept for the next flush, default 3, negative disables retries
+	RetryDelay    time.Duration // delay before the first retry, doubled on every retry, default 1s
+	MaxPending    int           // rows kept while InfluxDB is unreachable, the oldest are dropped first, default 1000
+}
+
+// InfluxWriter writes metrics rows as InfluxDB line protocol in batches. A full batch, or a partly
+// filled one that waited for FlushInterval, is sent by the next WriteMetrics call.
+type InfluxWriter struct {
+	transport influxTransport
+	config    InfluxConfig
+	host      string
+	tags      string
+	fields    []metric.Field
+	pending   [][]byte
+	lastSend  time.Time
+	closeOnce sync.Once
+	mu        sync.Mutex
+}
+
+type influxTransport interface {
+	send(body []byte) error
+	close() error
+}
+
+// NewInfluxWriter creates a writer that tags every row with the host name and the OBS setup
+func NewInfluxWriter(config InfluxConfig, session Session, fields []metric.Field) (*InfluxWriter, error) {
+	transport, err := newInfluxTransport(config)
+	if err != nil {
+		return nil, err
+	}
+
+	if config.BatchSize <= 0 {
+		config.BatchSize = 10
+	}
+	if config.FlushInterval <= 0 {
+		config.FlushInterval = 10 * time.Second
+	}
+	if config.MaxRetries < 0 {
+		config.MaxRetries = 0
+	} else if config.MaxRetries == 0 {
+		config.MaxRetries = 3
+	}
+	if config.RetryDelay <= 0 {
+		config.RetryDelay = time.Second
+	}
+	if config.MaxPending <= 0 {
+		config.MaxPending = 1000
+	}
+
+	host, _ := os.Hostname()
+
+	iw := &InfluxWriter{
+		transport: transport,
+		config:    config,
+		host:      host,
+		fields:    fields,
+		lastSend:  time.Now(),
+	}
+	iw.setSession(session)
+
+	return iw, nil
+}
+
+func newInfluxTransport(config InfluxConfig) (influxTransport, error) {
+	u, err := url.Parse(config.URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid InfluxDB URL: %w", err)
+	}
+
+	switch u.Scheme {
+	case "http", "https":
+		query := url.Values{}
+		query.Set("org", config.Org)
+		query.Set("bucket", config.Bucket)
+		query.Set("precision", "ns")
+		u.Path = strings.TrimSuffix(u.Path, "/") + "/api/v2/write"
+		u.RawQuery = query.Encode()
+
+		return &influxHTTPTransport{
+			url:    u.String(),
+			token:  config.Token,
+			client: &http.Client{Timeout: 10 * time.Second},
+		}, nil
+	case "udp":
+		conn, err := net.Dial("udp", u.Host)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open InfluxDB UDP connection: %w", err)
+		}
+		return &influxUDPTransport{conn: conn}, nil
+	}
+	return nil, fmt.Errorf("unsupported InfluxDB URL scheme %q, use http, https or udp", u.Scheme)
+}
+
+// WriteSession tags the following rows with the changed OBS setup
+func (iw *InfluxWriter) WriteSession(session Session) error {
+	iw.mu.Lock()
+	defer iw.mu.Unlock()
+	iw.setSession(session)
+	return nil
+}
+
+func (iw *InfluxWriter) setSession(session Session) {
+	tags := [][2]string{{"host", iw.host}}
+	for _, a := range session.attributes() {
+		tags = append(tags, [2]string{a.key, a.value})
+	}
+	iw.tags = influxTags(tags)
+}
+
+// WriteMetrics adds a row to the batch and sends the rows that are due
+func (iw *InfluxWriter) WriteMetrics(data MetricsData) error {
+	iw.mu.Lock()
+	defer iw.mu.Unlock()
+
+	if line := iw.formatLine(data); line != nil {
+		iw.pending = append(iw.pending, line)
+	}
+	return iw.send(time.Since(iw.lastSend) >= iw.config.FlushInterval)
+}
+
+// formatLine renders a row as a single line protocol line, rows without any value return nil.
+// The caller must hold mu.
+func (iw *InfluxWriter) formatLine(data MetricsData) []byte {
+	var fieldSet []string
+	for _, f := range iw.fields {
+		s, ok := data.Sample(f.Name)
+		if !ok {
+			continue
+		}
+		if value, ok := influxFieldValue(s); ok {
+			fieldSet = append(fieldSet, escapeInfluxKey(f.Name)+"="+value)
+		}
+	}
+	if len(data.Errors) > 0 {
+		fieldSet = append(fieldSet, "errors="+quoteInfluxString(data.ErrorString()))
+	}
+	if len(fieldSet) == 0 {
+		return nil
+	}
+
+	return fmt.Appendf(nil, "%s%s %s %d\n",
+		influxMeasurement, iw.tags, strings.Join(fieldSet, ","), data.Timestamp.UnixNano())
+}
+
+// send delivers the pending rows in batches, a batch that keeps failing is kept for the next call.
+// Unless all is set a partly filled batch waits for more rows. The caller must hold mu.
+func (iw *InfluxWriter) send(all bool) error {
+	if all {
+		iw.lastSend = time.Now()
+	}
+	for len(iw.pending) > 0 {
+		n := min(len(iw.pending), iw.config.BatchSize)
+		if !all && n < iw.config.BatchSize {
+			return nil
+		}
+
+		err := iw.sendWithRetry(bytes.Join(iw.pending[:n], nil))
+		var statusErr *influxStatusError
+		if err == nil || (errors.As(err, &statusErr) && !statusErr.retryable()) {
+			// A rejected batch won't be accepted on a later call either
+			iw.pending = iw.pending[n:]
+		} else if excess := len(iw.pending) - iw.config.MaxPending; excess > 0 {
+			iw.pending = iw.pending[excess:]
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (iw *InfluxWriter) sendWithRetry(body []byte) error {
+	delay := iw.config.RetryDelay
+
+	var err error
+	for attempt := 0; attempt <= iw.config.MaxRetries; attempt++ {
+		if attempt > 0 {
+			time.Sleep(delay)
+			delay *= 2
+		}
+
+		err = iw.transport.send(body)
+		if err == nil {
+			return nil
+		}
+		var statusErr *influxStatusError
+		if errors.As(err, &statusErr) && !statusErr.retryable() {
+			return err
+		}
+	}
+	return err
+}
+
+// Close sends the remaining rows and releases the connection
+func (iw *InfluxWriter) Close() error {
+	var err error
+	iw.closeOnce.Do(func() {
+		iw.mu.Lock()
+		pending := iw.pending
+		iw.pending = nil
+		iw.mu.Unlock()
+
+		for len(pending) > 0 {
+			n := min(len(pending), iw.config.BatchSize)
+			if err = iw.transport.send(bytes.Join(pending[:n], nil)); err != nil {
+				break
+			}
+			pending = pending[n:]
+		}
+		err = errors.Join(err, iw.transport.close())
+	})
+	return err
+}
+
+type influxStatusError struct {
+	code int
+	body string
+}
+
+func (e *influxStatusError) Error() string {
+	return fmt.Sprintf("InfluxDB responded with %d: %s", e.code, e.body)
+}
+
+func (e *influxStatusError) retryable() bool {
+	return e.code == http.StatusTooManyRequests || e.code >= 500
+}
+
+type influxHTTPTransport struct {
+	url    string
+	token  string
+	client *http.Client
+}
+
+func (t *influxHTTPTransport) send(body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, t.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	if t.token != "" {
+		req.Header.Set("Authorization", "Token "+t.token)
+	}
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return &influxStatusError{code: resp.StatusCode, body: strings.TrimSpace(string(msg))}
+	}
+	return nil
+}
+
+func (t *influxHTTPTransport) close() error {
+	t.client.CloseIdleConnections()
+	return nil
+}
+
+type influxUDPTransport struct {
+	conn net.Conn
+}
+
+func (t *influxUDPTransport) send(body []byte) error {
+	_, err := t.conn.Write(body)
+	return err
+}
+
+func (t *influxUDPTransport) close() error {
+	return t.conn.Close()
+}
+
+// influxFieldValue renders a sample as a line protocol field value, missing values and NaN are skipped
+func influxFieldValue(s metric.Sample) (string, bool) {
+	switch v := s.Value.(type) {
+	case bool:
+		return strconv.FormatBool(v), true
+	case float64, time.Duration:
+		f, _ := s.Float64()
+		if math.IsNaN(f) || math.IsInf(f, 0) {
+			return "", false
+		}
+		return strconv.FormatFloat(f, 'f', -1, 64), true
+	case string:
+		return `"` + influxStringEscaper.Replace(v) + `"`, true
+	}
+	return "", false
+}
+
+// influxTags renders key/value pairs as a tag set, empty values are left out as InfluxDB rejects them
+func influxTags(tags [][2]string) string {
+	var b strings.Builder
+	for _, tag := range tags {
+		if tag[1] == "" {
+			continue
+		}
+		b.WriteString("," + escapeInfluxKey(tag[0]) + "=" + escapeInfluxKey(tag[1]))
+	}
+	return b.String()
+}
+
+var influxKeyEscaper = strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `)
+
+func escapeInfluxKey(s string) string {
+	return influxKeyEscaper.Replace(s)
+}
+
+var influxStringEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+
+func quoteInfluxString(s string) string {
+	return `"` + influxStringEscaper.Replace(s) + `"`
+}
@@ -0,0 +1,315 @@
+package writer
+
+import (
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/joepadmiraal/metrics-for-obs/internal/metric"
+)
+
+// influxStandIn records the bodies posted to the write endpoint and answers with the queued status codes
+type influxStandIn struct {
+	server   *httptest.Server
+	requests []*http.Request
+	bodies   []string
+	statuses []int
+	mu       sync.Mutex
+}
+
+func newInfluxStandIn(t *testing.T, statuses ...int) *influxStandIn {
+	s := &influxStandIn{statuses: statuses}
+	s.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+
+		s.mu.Lock()
+		s.requests = append(s.requests, r)
+		s.bodies = append(s.bodies, string(body))
+		status := http.StatusNoContent
+		if len(s.statuses) > 0 {
+			status = s.statuses[0]
+			s.statuses = s.statuses[1:]
+		}
+		s.mu.Unlock()
+
+		w.WriteHeader(status)
+		if status != http.StatusNoContent {
+			w.Write([]byte(`{"code":"invalid","message":"rejected"}`))
+		}
+	}))
+	t.Cleanup(s.server.Close)
+	return s
+}
+
+func (s *influxStandIn) received() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.bodies...)
+}
+
+func TestInfluxWriter_FormatLine(t *testing.T) {
+	iw := &InfluxWriter{
+		tags:   influxTags([][2]string{{"host", "studio pc"}, {"obs_version", "30.0.0"}, {"stream_domain", "live.twitch.tv"}}),
+		fields: testFields,
+	}
+
+	data := newTestData(time.Unix(1766484000, 123), map[string]any{
+		"obs_rtt_ms":      4740 * time.Microsecond,
+		"stream_active":   true,
+		"output_bytes":    327347.0,
+		"obs_cpu_percent": 2.8,
+	}, metric.SourceError{Source: "google_ping", Err: errors.New(`lookup "google.com" failed`)})
+
+	expected := `metrics_for_obs,host=studio\ pc,obs_version=30.0.0,stream_domain=live.twitch.tv ` +
+		`obs_rtt_ms=4.74,stream_active=true,output_bytes=327347,obs_cpu_percent=2.8,` +
+		`errors="google_ping: lookup \"google.com\" failed" 1766484000000000123` + "\n"
+
+	if got := string(iw.formatLine(data)); got != expected {
+		t.Errorf("Expected\n%q\ngot\n%q", expected, got)
+	}
+}
+
+func TestInfluxWriter_WriteSession_UpdatesTags(t *testing.T) {
+	iw := &InfluxWriter{host: "pc", fields: testFields}
+	iw.setSession(testSession)
+
+	data := newTestData(time.Unix(1766484000, 0), map[string]any{"stream_active": true})
+	expected := `metrics_for_obs,host=pc,obs_version=30.0.0,stream_domain=live.twitch.tv,os=` + runtime.GOOS +
+		`,service_type=rtmp_common,base_resolution=1920x1080,output_resolution=1280x720,fps=60,output_mode=Simple,encoder=x264,bitrate_kbps=6000 ` +
+		`stream_active=true 1766484000000000000` + "\n"
+	if got := string(iw.formatLine(data)); got != expected {
+		t.Errorf("Expected\n%q\ngot\n%q", expected, got)
+	}
+
+	iw.WriteSession(Session{ObsVersion: "30.0.0", StreamDomain: "a.rtmp.youtube.com", Encoder: "jim_nvenc"})
+	expected = `metrics_for_obs,host=pc,obs_version=30.0.0,stream_domain=a.rtmp.youtube.com,os=` + runtime.GOOS +
+		`,encoder=jim_nvenc stream_active=true 1766484000000000000` + "\n"
+	if got := string(iw.formatLine(data)); got != expected {
+		t.Errorf("Expected\n%q\ngot\n%q", expected, got)
+	}
+}
+
+func TestInfluxWriter_FormatLine_NoValues(t *testing.T) {
+	iw := &InfluxWriter{fields: testFields}
+
+	if line := iw.formatLine(newTestData(time.Now(), nil)); line != nil {
+		t.Errorf("Expected no line for a row without values, got %q", line)
+	}
+}
+
+func TestInfluxFieldValue_String(t *testing.T) {
+	got, ok := influxFieldValue(metric.Sample{Field: metric.Field{Type: metric.StringValue}, Value: `00:01:02 "live"`})
+
+	if !ok || got != `"00:01:02 \"live\""` {
+		t.Errorf("Expected a quoted string field, got %q (ok=%v)", got, ok)
+	}
+}
+
+func TestInfluxTags_SkipsEmptyValues(t *testing.T) {
+	got := influxTags([][2]string{{"host", "pc"}, {"obs_version", ""}, {"stream_domain", "a,b=c"}})
+
+	if expected := `,host=pc,stream_domain=a\,b\=c`; got != expected {
+		t.Errorf("Expected %q, got %q", expected, got)
+	}
+}
+
+func TestInfluxWriter_HTTP_BatchesRows(t *testing.T) {
+	standIn := newInfluxStandIn(t)
+
+	iw, err := NewInfluxWriter(InfluxConfig{
+		URL:       standIn.server.URL,
+		Org:       "my-org",
+		Bucket:    "obs",
+		Token:     "secret",
+		BatchSize: 2,
+	}, testSession, testFields)
+	if err != nil {
+		t.Fatalf("NewInfluxWriter failed: %v", err)
+	}
+
+	for i := 0; i < 3; i++ {
+		if err := iw.WriteMetrics(newTestData(time.Now(), map[string]any{"output_frames": float64(i)})); err != nil {
+			t.Fatalf("WriteMetrics failed: %v", err)
+		}
+	}
+
+	if len(standIn.received()) != 1 {
+		t.Fatalf("Expected 1 request, got %d", len(standIn.received()))
+	}
+	if lines := strings.Count(standIn.received()[0], "\n"); lines != 2 {
+		t.Errorf("Expected the first batch to hold 2 rows, got %d", lines)
+	}
+
+	if err := iw.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	bodies := standIn.received()
+	if len(bodies) != 2 || !strings.Contains(bodies[1], "output_frames=2") {
+		t.Errorf("Expected Close to send the remaining row, got %v", bodies)
+	}
+
+	req := standIn.requests[0]
+	if req.URL.Path != "/api/v2/write" {
+		t.Errorf("Expected path /api/v2/write, got %s", req.URL.Path)
+	}
+	query := req.URL.Query()
+	if query.Get("org") != "my-org" || query.Get("bucket") != "obs" || query.Get("precision") != "ns" {
+		t.Errorf("Unexpected query %v", query)
+	}
+	if auth := req.Header.Get("Authorization"); auth != "Token secret" {
+		t.Errorf("Expected token authorization, got %q", auth)
+	}
+}
+
+func TestInfluxWriter_HTTP_RetriesServerErrors(t *testing.T) {
+	standIn := newInfluxStandIn(t, http.StatusServiceUnavailable, http.StatusServiceUnavailable)
+
+	iw, err := NewInfluxWriter(InfluxConfig{
+		URL:        standIn.server.URL,
+		BatchSize:  1,
+		RetryDelay: time.Millisecond,
+	}, testSession, testFields)
+	if err != nil {
+		t.Fatalf("NewInfluxWriter failed: %v", err)
+	}
+	defer iw.Close()
+
+	if err := iw.WriteMetrics(newTestData(time.Now(), map[string]any{"output_frames": 30.0})); err != nil {
+		t.Errorf("Expected no error after a successful retry, got %v", err)
+	}
+
+	bodies := standIn.received()
+	if len(bodies) != 3 {
+		t.Fatalf("Expected 2 retries, got %d requests", len(bodies))
+	}
+	if bodies[0] != bodies[2] {
+		t.Errorf("Expected the same batch to be retried, got %q and %q", bodies[0], bodies[2])
+	}
+}
+
+func TestInfluxWriter_HTTP_KeepsRowsWhileUnreachable(t *testing.T) {
+	standIn := newInfluxStandIn(t, http.StatusServiceUnavailable, http.StatusServiceUnavailable)
+
+	iw, err := NewInfluxWriter(InfluxConfig{
+		URL:        standIn.server.URL,
+		BatchSize:  1,
+		MaxRetries: 1,
+		RetryDelay: time.Millisecond,
+	}, testSession, testFields)
+	if err != nil {
+		t.Fatalf("NewInfluxWriter failed: %v", err)
+	}
+
+	err = iw.WriteMetrics(newTestData(time.Now(), map[string]any{"output_frames": 30.0}))
+	if err == nil || !strings.Contains(err.Error(), "503") {
+		t.Errorf("Expected the send error to be reported, got %v", err)
+	}
+	if n := len(standIn.received()); n != 2 {
+		t.Errorf("Expected 1 retry, got %d requests", n)
+	}
+
+	if err := iw.WriteMetrics(newTestData(time.Now(), map[string]any{"output_frames": 60.0})); err != nil {
+		t.Errorf("Expected no error once InfluxDB is back, got %v", err)
+	}
+	iw.Close()
+
+	bodies := standIn.received()
+	if len(bodies) != 4 || !strings.Contains(bodies[2], "output_frames=30") || !strings.Contains(bodies[3], "output_frames=60") {
+		t.Errorf("Expected the failed row to be sent before the new one, got %v", bodies[2:])
+	}
+}
+
+func TestInfluxWriter_HTTP_DropsRejectedRows(t *testing.T) {
+	standIn := newInfluxStandIn(t, http.StatusBadRequest)
+
+	iw, err := NewInfluxWriter(InfluxConfig{
+		URL:        standIn.server.URL,
+		BatchSize:  1,
+		RetryDelay: time.Millisecond,
+	}, testSession, testFields)
+	if err != nil {
+		t.Fatalf("NewInfluxWriter failed: %v", err)
+	}
+
+	err = iw.WriteMetrics(newTestData(time.Now(), map[string]any{"output_frames": 30.0}))
+	if err == nil || !strings.Contains(err.Error(), "400") {
+		t.Errorf("Expected the rejection to be reported, got %v", err)
+	}
+
+	iw.Close()
+	if bodies := standIn.received(); len(bodies) != 1 {
+		t.Errorf("Expected a rejected row not to be retried, got %d requests", len(bodies))
+	}
+}
+
+func TestInfluxWriter_HTTP_FlushesPartialBatchAfterInterval(t *testing.T) {
+	standIn := newInfluxStandIn(t)
+
+	iw, err := NewInfluxWriter(InfluxConfig{
+		URL:           standIn.server.URL,
+		BatchSize:     10,
+		FlushInterval: 20 * time.Millisecond,
+	}, testSession, testFields)
+	if err != nil {
+		t.Fatalf("NewInfluxWriter failed: %v", err)
+	}
+	defer iw.Close()
+
+	iw.WriteMetrics(newTestData(time.Now(), map[string]any{"output_frames": 30.0}))
+	if n := len(standIn.received()); n != 0 {
+		t.Fatalf("Expected a partly filled batch to wait, got %d requests", n)
+	}
+
+	time.Sleep(30 * time.Millisecond)
+	iw.WriteMetrics(newTestData(time.Now(), map[string]any{"output_frames": 60.0}))
+
+	bodies := standIn.received()
+	if len(bodies) != 1 || strings.Count(bodies[0], "\n") != 2 {
+		t.Errorf("Expected both rows in one request after the flush interval, got %v", bodies)
+	}
+}
+
+func TestInfluxWriter_UDP(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer conn.Close()
+
+	iw, err := NewInfluxWriter(InfluxConfig{
+		URL:       "udp://" + conn.LocalAddr().String(),
+		BatchSize: 2,
+	}, testSession, testFields)
+	if err != nil {
+		t.Fatalf("NewInfluxWriter failed: %v", err)
+	}
+	defer iw.Close()
+
+	iw.WriteMetrics(newTestData(time.Now(), map[string]any{"obs_cpu_percent": 2.5}))
+	iw.WriteMetrics(newTestData(time.Now(), map[string]any{"obs_cpu_percent": 3.5}))
+
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	buf := make([]byte, 65535)
+	n, _, err := conn.ReadFrom(buf)
+	if err != nil {
+		t.Fatalf("Failed to read datagram: %v", err)
+	}
+
+	datagram := string(buf[:n])
+	if !strings.Contains(datagram, "obs_cpu_percent=2.5") || !strings.Contains(datagram, "obs_cpu_percent=3.5") {
+		t.Errorf("Expected both rows in one datagram, got %q", datagram)
+	}
+}
+
+func TestNewInfluxWriter_UnsupportedScheme(t *testing.T) {
+	if _, err := NewInfluxWriter(InfluxConfig{URL: "tcp://localhost:8086"}, Session{ObsVersion: "30.0.0"}, testFields); err == nil {
+		t.Error("Expected error for an unsupported scheme")
+	}
+}
@@ -0,0 +1,173 @@
+package writer
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/joepadmiraal/metrics-for-obs/internal/metric"
+)
+
+// JSONLWriter writes one JSON object per metrics row. Values keep their type, durations are
+// written in milliseconds and missing values are null. The OBS setup is written as a separate
+// object with a session key, first and again whenever it changes.
+type JSONLWriter struct {
+	file   *os.File
+	writer *bufio.Writer
+	fields []metric.Field
+	mu     sync.Mutex
+}
+
+type jsonlError struct {
+	Source string `json:"source"`
+	Error  string `json:"error"`
+}
+
+// NewJSONLWriter creates a new JSON Lines writer, the keys of every object follow the order of fields
+func NewJSONLWriter(filename string, session Session, fields []metric.Field) (*JSONLWriter, error) {
+	file, err := os.Create(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create JSONL file: %w", err)
+	}
+
+	jw := &JSONLWriter{
+		file:   file,
+		writer: bufio.NewWriter(file),
+		fields: fields,
+	}
+	if err := jw.WriteSession(session); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return jw, nil
+}
+
+// WriteSession writes the OBS setup as {"timestamp":...,"session":{...}}, settings OBS didn't report are null
+func (jw *JSONLWriter) WriteSession(session Session) error {
+	var buf bytes.Buffer
+
+	timestamp, err := json.Marshal(time.Now().Format(time.RFC3339Nano))
+	if err != nil {
+		return err
+	}
+	buf.WriteString(`{"timestamp":`)
+	buf.Write(timestamp)
+	buf.WriteString(`,"session":{`)
+	for i, a := range session.attributes() {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		key, err := json.Marshal(a.key)
+		if err != nil {
+			return err
+		}
+		var value any
+		if a.value != "" {
+			value = a.value
+		}
+		encoded, err := json.Marshal(value)
+		if err != nil {
+			return err
+		}
+		buf.Write(key)
+		buf.WriteByte(':')
+		buf.Write(encoded)
+	}
+	buf.WriteString("}}\n")
+
+	jw.mu.Lock()
+	defer jw.mu.Unlock()
+
+	if _, err := jw.writer.Write(buf.Bytes()); err != nil {
+		return fmt.Errorf("failed to write JSONL session: %w", err)
+	}
+	return jw.writer.Flush()
+}
+
+// WriteMetrics writes a single metrics data row as a JSON object on its own line
+func (jw *JSONLWriter) WriteMetrics(data MetricsData) error {
+	line, err := jw.encode(data)
+	if err != nil {
+		return err
+	}
+
+	jw.mu.Lock()
+	defer jw.mu.Unlock()
+
+	if _, err := jw.writer.Write(line); err != nil {
+		return fmt.Errorf("failed to write JSONL row: %w", err)
+	}
+	return jw.writer.Flush()
+}
+
+// encode builds the object by hand because a map would lose the field order
+func (jw *JSONLWriter) encode(data MetricsData) ([]byte, error) {
+	var buf bytes.Buffer
+
+	timestamp, err := json.Marshal(data.Timestamp.Format(time.RFC3339Nano))
+	if err != nil {
+		return nil, err
+	}
+	buf.WriteString(`{"timestamp":`)
+	buf.Write(timestamp)
+
+	for _, f := range jw.fields {
+		name, err := json.Marshal(f.Name)
+		if err != nil {
+			return nil, err
+		}
+		buf.WriteByte(',')
+		buf.Write(name)
+		buf.WriteByte(':')
+
+		s, _ := data.Sample(f.Name)
+		buf.Write(jsonValue(s))
+	}
+
+	errs := make([]jsonlError, len(data.Errors))
+	for i, e := range data.Errors {
+		errs[i] = jsonlError{Source: e.Source, Error: e.Err.Error()}
+	}
+	errJSON, err := json.Marshal(errs)
+	if err != nil {
+		return nil, err
+	}
+	buf.WriteString(`,"errors":`)
+	buf.Write(errJSON)
+	buf.WriteString("}\n")
+
+	return buf.Bytes(), nil
+}
+
+// jsonValue renders a sample as a JSON literal, values JSON can't represent such as NaN become null
+func jsonValue(s metric.Sample) []byte {
+	var v any
+	switch s.Value.(type) {
+	case bool, string:
+		v = s.Value
+	case float64, time.Duration:
+		v, _ = s.Float64()
+	}
+
+	b, err := json.Marshal(v)
+	if err != nil {
+		return []byte("null")
+	}
+	return b
+}
+
+// Close flushes and closes the JSONL file
+func (jw *JSONLWriter) Close() error {
+	jw.mu.Lock()
+	defer jw.mu.Unlock()
+
+	if err := jw.writer.Flush(); err != nil {
+		jw.file.Close()
+		return err
+	}
+	return jw.file.Close()
+}
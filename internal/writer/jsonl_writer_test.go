@@ -0,0 +1,221 @@
+package writer
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/joepadmiraal/metrics-for-obs/internal/metric"
+)
+
+// readJSONLines returns the metrics rows of the file, the session lines are left out
+func readJSONLines(t *testing.T, filename string) []map[string]any {
+	t.Helper()
+
+	file, err := os.Open(filename)
+	if err != nil {
+		t.Fatalf("Failed to open JSONL file: %v", err)
+	}
+	defer file.Close()
+
+	var rows []map[string]any
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var row map[string]any
+		if err := json.Unmarshal(scanner.Bytes(), &row); err != nil {
+			t.Fatalf("Line is not valid JSON: %v: %s", err, scanner.Text())
+		}
+		if _, ok := row["session"]; !ok {
+			rows = append(rows, row)
+		}
+	}
+	return rows
+}
+
+func TestJSONLWriter_WriteMetrics_TypedValues(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "test.jsonl")
+
+	jw, err := NewJSONLWriter(filename, testSession, testFields)
+	if err != nil {
+		t.Fatalf("NewJSONLWriter failed: %v", err)
+	}
+
+	data := newTestData(time.Date(2025, 12, 23, 10, 0, 0, 500000000, time.UTC), map[string]any{
+		"obs_rtt_ms":      4740 * time.Microsecond,
+		"stream_active":   true,
+		"output_bytes":    327347.0,
+		"obs_cpu_percent": 2.8,
+	})
+	if err := jw.WriteMetrics(data); err != nil {
+		t.Fatalf("WriteMetrics failed: %v", err)
+	}
+	jw.Close()
+
+	rows := readJSONLines(t, filename)
+	if len(rows) != 1 {
+		t.Fatalf("Expected 1 row, got %d", len(rows))
+	}
+	row := rows[0]
+
+	tests := []struct {
+		key      string
+		expected any
+	}{
+		{key: "timestamp", expected: "2025-12-23T10:00:00.5Z"},
+		{key: "obs_rtt_ms", expected: 4.74},
+		{key: "stream_active", expected: true},
+		{key: "output_bytes", expected: 327347.0},
+		{key: "obs_cpu_percent", expected: 2.8},
+		{key: "google_rtt_ms", expected: nil},
+	}
+	for _, tt := range tests {
+		value, ok := row[tt.key]
+		if !ok {
+			t.Errorf("Expected key %s to be present", tt.key)
+			continue
+		}
+		if value != tt.expected {
+			t.Errorf("Expected %s to be %v (%T), got %v (%T)", tt.key, tt.expected, tt.expected, value, value)
+		}
+	}
+
+	errs, ok := row["errors"].([]any)
+	if !ok || len(errs) != 0 {
+		t.Errorf("Expected errors to be an empty array, got %v", row["errors"])
+	}
+}
+
+func TestJSONLWriter_WriteMetrics_ErrorsKeyedBySource(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "test.jsonl")
+
+	jw, err := NewJSONLWriter(filename, testSession, testFields)
+	if err != nil {
+		t.Fatalf("NewJSONLWriter failed: %v", err)
+	}
+
+	data := newTestData(time.Now(), nil,
+		metric.SourceError{Source: "obs_ping", Err: errors.New("no response received")},
+		metric.SourceError{Source: "stream", Err: errors.New(`request "GetStreamStatus" failed`)},
+	)
+	jw.WriteMetrics(data)
+	jw.Close()
+
+	rows := readJSONLines(t, filename)
+	errs, ok := rows[0]["errors"].([]any)
+	if !ok || len(errs) != 2 {
+		t.Fatalf("Expected 2 errors, got %v", rows[0]["errors"])
+	}
+
+	first := errs[0].(map[string]any)
+	if first["source"] != "obs_ping" || first["error"] != "no response received" {
+		t.Errorf("Unexpected first error: %v", first)
+	}
+	second := errs[1].(map[string]any)
+	if second["source"] != "stream" || second["error"] != `request "GetStreamStatus" failed` {
+		t.Errorf("Unexpected second error: %v", second)
+	}
+}
+
+func TestJSONLWriter_WriteMetrics_KeysFollowFields(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "test.jsonl")
+
+	fields := []metric.Field{
+		{Name: "b_value", Type: metric.FloatValue, Kind: metric.Gauge},
+		{Name: "a_value", Type: metric.FloatValue, Kind: metric.Gauge},
+	}
+	jw, err := NewJSONLWriter(filename, testSession, fields)
+	if err != nil {
+		t.Fatalf("NewJSONLWriter failed: %v", err)
+	}
+
+	jw.WriteMetrics(MetricsData{
+		Timestamp: time.Date(2025, 12, 23, 10, 0, 0, 0, time.UTC),
+		Samples: []metric.Sample{
+			{Field: fields[1], Value: 1.0},
+			{Field: fields[0], Value: math.NaN()},
+		},
+	})
+	jw.Close()
+
+	content, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatalf("Failed to read JSONL file: %v", err)
+	}
+
+	expected := `{"timestamp":"2025-12-23T10:00:00Z","b_value":null,"a_value":1,"errors":[]}`
+	lines := strings.Split(strings.TrimSpace(string(content)), "\n")
+	if last := lines[len(lines)-1]; last != expected {
+		t.Errorf("Expected %q, got %q", expected, last)
+	}
+}
+
+func TestJSONLWriter_WriteMetrics_OneLinePerRow(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "test.jsonl")
+
+	jw, err := NewJSONLWriter(filename, testSession, testFields)
+	if err != nil {
+		t.Fatalf("NewJSONLWriter failed: %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		jw.WriteMetrics(newTestData(time.Now(), map[string]any{"output_frames": float64(i)}))
+	}
+	jw.Close()
+
+	content, _ := os.ReadFile(filename)
+	if lines := strings.Count(string(content), "\n"); lines != 4 {
+		t.Errorf("Expected a session line and 3 rows, got %d lines", lines)
+	}
+}
+
+func TestJSONLWriter_WriteSession(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "test.jsonl")
+
+	jw, err := NewJSONLWriter(filename, testSession, testFields)
+	if err != nil {
+		t.Fatalf("NewJSONLWriter failed: %v", err)
+	}
+	jw.WriteMetrics(newTestData(time.Now(), map[string]any{"output_frames": 60.0}))
+	jw.WriteSession(Session{ObsVersion: "30.0.0", StreamDomain: "live.twitch.tv", Encoder: "jim_nvenc", OutputMode: "Advanced"})
+	jw.Close()
+
+	content, _ := os.ReadFile(filename)
+	lines := strings.Split(strings.TrimSpace(string(content)), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("Expected 3 lines, got %d", len(lines))
+	}
+
+	var sessions []map[string]any
+	for _, i := range []int{0, 2} {
+		var line struct {
+			Timestamp string         `json:"timestamp"`
+			Session   map[string]any `json:"session"`
+		}
+		if err := json.Unmarshal([]byte(lines[i]), &line); err != nil {
+			t.Fatalf("Session line is not valid JSON: %v: %s", err, lines[i])
+		}
+		if line.Timestamp == "" {
+			t.Errorf("Expected the session line to have a timestamp: %s", lines[i])
+		}
+		sessions = append(sessions, line.Session)
+	}
+
+	if sessions[0]["encoder"] != "x264" || sessions[0]["bitrate_kbps"] != "6000" || sessions[0]["output_resolution"] != "1280x720" {
+		t.Errorf("Unexpected initial session %v", sessions[0])
+	}
+	if sessions[1]["encoder"] != "jim_nvenc" || sessions[1]["bitrate_kbps"] != nil {
+		t.Errorf("Expected the changed session with a null bitrate, got %v", sessions[1])
+	}
+}
+
+func TestJSONLWriter_NewJSONLWriter_InvalidPath(t *testing.T) {
+	_, err := NewJSONLWriter(filepath.Join(t.TempDir(), "missing", "test.jsonl"), testSession, testFields)
+	if err == nil {
+		t.Error("Expected error for a path in a missing directory")
+	}
+}
@@ -1,23 +1,50 @@
 package writer
 
-import "time"
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/joepadmiraal/metrics-for-obs/internal/metric"
+)
 
 // MetricsData holds all metrics data for a single measurement
 type MetricsData struct {
-	Timestamp           time.Time
-	ObsRTT              time.Duration
-	ObsPingError        error
-	GoogleRTT           time.Duration
-	GooglePingError     error
-	StreamActive        bool
-	OutputBytes         float64
-	OutputSkippedFrames float64
-	OutputFrames        float64
-	StreamError         error
-	ObsCpuUsage         float64
-	ObsMemoryUsage      float64
-	ObsStatsError       error
-	SystemCpuUsage      float64
-	SystemMemoryUsage   float64
-	SystemMetricsError  error
+	Timestamp time.Time
+	Samples   []metric.Sample
+	Errors    []metric.SourceError
+}
+
+// Sample returns the sample of the field with the given name
+func (d MetricsData) Sample(name string) (metric.Sample, bool) {
+	for _, s := range d.Samples {
+		if s.Name == name {
+			return s, true
+		}
+	}
+	return metric.Sample{}, false
+}
+
+// ErrorString joins all errors into a single semicolon-separated string
+func (d MetricsData) ErrorString() string {
+	parts := make([]string, len(d.Errors))
+	for i, e := range d.Errors {
+		parts[i] = fmt.Sprintf("%s: %v", e.Source, e.Err)
+	}
+	return strings.Join(parts, "; ")
+}
+
+// formatValue renders a sample for the text based writers, missing values become an empty string
+func formatValue(s metric.Sample) string {
+	switch v := s.Value.(type) {
+	case bool:
+		return strconv.FormatBool(v)
+	case float64, time.Duration:
+		f, _ := s.Float64()
+		return strconv.FormatFloat(f, 'f', s.Precision, 64)
+	case string:
+		return v
+	}
+	return ""
 }
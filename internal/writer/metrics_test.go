@@ -4,167 +4,93 @@ import (
 	"fmt"
 	"testing"
 	"time"
-)
 
-func TestMetricsData_Initialization(t *testing.T) {
-	data := MetricsData{
-		Timestamp:           time.Date(2025, 12, 23, 10, 0, 0, 0, time.UTC),
-		ObsRTT:              50 * time.Millisecond,
-		GoogleRTT:           25 * time.Millisecond,
-		StreamActive:        true,
-		OutputBytes:         1024.0,
-		OutputSkippedFrames: 5.0,
-		OutputFrames:        100.0,
-		ObsCpuUsage:         15.5,
-		ObsMemoryUsage:      512.0,
-		SystemCpuUsage:      45.2,
-		SystemMemoryUsage:   60.0,
-	}
+	"github.com/joepadmiraal/metrics-for-obs/internal/metric"
+)
 
-	if data.Timestamp.IsZero() {
-		t.Error("Expected Timestamp to be set")
-	}
-	if data.ObsRTT != 50*time.Millisecond {
-		t.Errorf("Expected ObsRTT to be 50ms, got %v", data.ObsRTT)
-	}
-	if data.StreamActive != true {
-		t.Error("Expected StreamActive to be true")
-	}
-	if data.OutputBytes != 1024.0 {
-		t.Errorf("Expected OutputBytes to be 1024.0, got %f", data.OutputBytes)
-	}
+var testFields = []metric.Field{
+	{Name: "obs_rtt_ms", Type: metric.DurationValue, Kind: metric.Gauge, Precision: 2},
+	{Name: "google_rtt_ms", Type: metric.DurationValue, Kind: metric.Gauge, Precision: 2},
+	{Name: "stream_active", Type: metric.BoolValue, Kind: metric.Gauge},
+	{Name: "output_bytes", Type: metric.FloatValue, Kind: metric.Counter},
+	{Name: "output_skipped_frames", Type: metric.FloatValue, Kind: metric.Counter},
+	{Name: "output_frames", Type: metric.FloatValue, Kind: metric.Counter},
+	{Name: "obs_cpu_percent", Type: metric.FloatValue, Kind: metric.Gauge, Precision: 2},
+	{Name: "obs_memory_mb", Type: metric.FloatValue, Kind: metric.Gauge, Precision: 2},
+	{Name: "system_cpu_percent", Type: metric.FloatValue, Kind: metric.Gauge, Precision: 2},
+	{Name: "system_memory_percent", Type: metric.FloatValue, Kind: metric.Gauge, Precision: 2},
 }
 
-func TestMetricsData_DefaultValues(t *testing.T) {
-	data := MetricsData{}
-
-	if !data.Timestamp.IsZero() {
-		t.Error("Expected default Timestamp to be zero")
-	}
-	if data.ObsRTT != 0 {
-		t.Errorf("Expected default ObsRTT to be 0, got %v", data.ObsRTT)
-	}
-	if data.GoogleRTT != 0 {
-		t.Errorf("Expected default GoogleRTT to be 0, got %v", data.GoogleRTT)
-	}
-	if data.StreamActive != false {
-		t.Error("Expected default StreamActive to be false")
-	}
-	if data.OutputBytes != 0 {
-		t.Errorf("Expected default OutputBytes to be 0, got %f", data.OutputBytes)
-	}
-	if data.OutputSkippedFrames != 0 {
-		t.Errorf("Expected default OutputSkippedFrames to be 0, got %f", data.OutputSkippedFrames)
-	}
-	if data.OutputFrames != 0 {
-		t.Errorf("Expected default OutputFrames to be 0, got %f", data.OutputFrames)
-	}
-	if data.ObsCpuUsage != 0 {
-		t.Errorf("Expected default ObsCpuUsage to be 0, got %f", data.ObsCpuUsage)
-	}
-	if data.ObsMemoryUsage != 0 {
-		t.Errorf("Expected default ObsMemoryUsage to be 0, got %f", data.ObsMemoryUsage)
-	}
-	if data.SystemCpuUsage != 0 {
-		t.Errorf("Expected default SystemCpuUsage to be 0, got %f", data.SystemCpuUsage)
-	}
-	if data.SystemMemoryUsage != 0 {
-		t.Errorf("Expected default SystemMemoryUsage to be 0, got %f", data.SystemMemoryUsage)
-	}
+var testSession = Session{
+	ObsVersion:       "30.0.0",
+	StreamDomain:     "live.twitch.tv",
+	ServiceType:      "rtmp_common",
+	BaseResolution:   "1920x1080",
+	OutputResolution: "1280x720",
+	FPS:              "60",
+	OutputMode:       "Simple",
+	Encoder:          "x264",
+	Bitrate:          "6000",
 }
 
-func TestMetricsData_ZeroValuesForOptionalFields(t *testing.T) {
-	data := MetricsData{
-		Timestamp:    time.Now(),
-		StreamActive: true,
-	}
-
-	if data.ObsPingError != nil {
-		t.Error("Expected ObsPingError to be nil")
-	}
-	if data.GooglePingError != nil {
-		t.Error("Expected GooglePingError to be nil")
-	}
-	if data.StreamError != nil {
-		t.Error("Expected StreamError to be nil")
-	}
-	if data.ObsStatsError != nil {
-		t.Error("Expected ObsStatsError to be nil")
-	}
-	if data.SystemMetricsError != nil {
-		t.Error("Expected SystemMetricsError to be nil")
+// newTestData builds a row with a sample for every test field, fields missing from values are nil
+func newTestData(timestamp time.Time, values map[string]any, errs ...metric.SourceError) MetricsData {
+	samples := make([]metric.Sample, len(testFields))
+	for i, f := range testFields {
+		samples[i] = metric.Sample{Field: f, Value: values[f.Name]}
 	}
+	return MetricsData{Timestamp: timestamp, Samples: samples, Errors: errs}
 }
 
-func TestMetricsData_WithErrors(t *testing.T) {
-	obsErr := fmt.Errorf("obs ping failed")
-	googleErr := fmt.Errorf("google ping failed")
-	streamErr := fmt.Errorf("stream error")
-	obsStatsErr := fmt.Errorf("obs stats error")
-	systemErr := fmt.Errorf("system metrics error")
-
-	data := MetricsData{
-		Timestamp:          time.Now(),
-		ObsPingError:       obsErr,
-		GooglePingError:    googleErr,
-		StreamError:        streamErr,
-		ObsStatsError:      obsStatsErr,
-		SystemMetricsError: systemErr,
-	}
+func TestMetricsData_Sample(t *testing.T) {
+	data := newTestData(time.Date(2025, 12, 23, 10, 0, 0, 0, time.UTC), map[string]any{
+		"obs_rtt_ms":    50 * time.Millisecond,
+		"stream_active": true,
+		"output_bytes":  1024.0,
+	})
 
-	if data.ObsPingError == nil {
-		t.Error("Expected ObsPingError to be set")
+	s, ok := data.Sample("obs_rtt_ms")
+	if !ok {
+		t.Fatal("Expected obs_rtt_ms sample to be present")
 	}
-	if data.GooglePingError == nil {
-		t.Error("Expected GooglePingError to be set")
+	if s.Value != 50*time.Millisecond {
+		t.Errorf("Expected obs_rtt_ms to be 50ms, got %v", s.Value)
 	}
-	if data.StreamError == nil {
-		t.Error("Expected StreamError to be set")
+	if s, _ := data.Sample("stream_active"); s.Value != true {
+		t.Error("Expected stream_active to be true")
 	}
-	if data.ObsStatsError == nil {
-		t.Error("Expected ObsStatsError to be set")
+	if s, _ := data.Sample("google_rtt_ms"); s.Value != nil {
+		t.Errorf("Expected unset google_rtt_ms to be nil, got %v", s.Value)
 	}
-	if data.SystemMetricsError == nil {
-		t.Error("Expected SystemMetricsError to be set")
+	if _, ok := data.Sample("unknown"); ok {
+		t.Error("Expected unknown sample to be absent")
 	}
 }
 
-func TestMetricsData_HighValues(t *testing.T) {
-	data := MetricsData{
-		Timestamp:           time.Now(),
-		ObsRTT:              5000 * time.Millisecond,
-		GoogleRTT:           3000 * time.Millisecond,
-		StreamActive:        true,
-		OutputBytes:         999999999.0,
-		OutputSkippedFrames: 10000.0,
-		OutputFrames:        100000.0,
-		ObsCpuUsage:         99.9,
-		ObsMemoryUsage:      8192.0,
-		SystemCpuUsage:      100.0,
-		SystemMemoryUsage:   99.9,
-	}
+func TestMetricsData_DefaultValues(t *testing.T) {
+	data := MetricsData{}
 
-	if data.ObsRTT != 5000*time.Millisecond {
-		t.Errorf("Expected high ObsRTT value, got %v", data.ObsRTT)
+	if !data.Timestamp.IsZero() {
+		t.Error("Expected default Timestamp to be zero")
 	}
-	if data.OutputBytes != 999999999.0 {
-		t.Errorf("Expected high OutputBytes value, got %f", data.OutputBytes)
+	if len(data.Samples) != 0 {
+		t.Errorf("Expected no samples, got %d", len(data.Samples))
 	}
-	if data.SystemCpuUsage != 100.0 {
-		t.Errorf("Expected SystemCpuUsage 100.0, got %f", data.SystemCpuUsage)
+	if data.ErrorString() != "" {
+		t.Errorf("Expected empty error string, got %q", data.ErrorString())
 	}
 }
 
-func TestMetricsData_NegativeValues(t *testing.T) {
-	data := MetricsData{
-		Timestamp:           time.Now(),
-		OutputBytes:         -100.0,
-		OutputSkippedFrames: -5.0,
-		ObsCpuUsage:         -10.0,
-	}
+func TestMetricsData_ErrorString(t *testing.T) {
+	data := newTestData(time.Now(), nil,
+		metric.SourceError{Source: "obs_ping", Err: fmt.Errorf("obs ping failed")},
+		metric.SourceError{Source: "stream", Err: fmt.Errorf("stream error")},
+		metric.SourceError{Source: "system", Err: fmt.Errorf("system metrics error")},
+	)
 
-	if data.OutputBytes >= 0 {
-		t.Logf("Note: Negative OutputBytes accepted: %f", data.OutputBytes)
+	expected := "obs_ping: obs ping failed; stream: stream error; system: system metrics error"
+	if data.ErrorString() != expected {
+		t.Errorf("Expected %q, got %q", expected, data.ErrorString())
 	}
 }
 
@@ -182,17 +108,54 @@ func TestMetricsData_TimestampPrecision(t *testing.T) {
 	}
 }
 
-func TestMetricsData_PartialData(t *testing.T) {
-	data := MetricsData{
-		Timestamp:    time.Now(),
-		ObsRTT:       50 * time.Millisecond,
-		StreamActive: true,
-	}
-
-	if data.GoogleRTT != 0 {
-		t.Error("Expected unset GoogleRTT to be zero")
-	}
-	if data.OutputBytes != 0 {
-		t.Error("Expected unset OutputBytes to be zero")
+func TestFormatValue(t *testing.T) {
+	tests := []struct {
+		name     string
+		sample   metric.Sample
+		expected string
+	}{
+		{
+			name:     "duration in milliseconds",
+			sample:   metric.Sample{Field: testFields[0], Value: 1001 * time.Millisecond},
+			expected: "1001.00",
+		},
+		{
+			name:     "bool",
+			sample:   metric.Sample{Field: testFields[2], Value: false},
+			expected: "false",
+		},
+		{
+			name:     "float without decimals",
+			sample:   metric.Sample{Field: testFields[3], Value: 999999999.0},
+			expected: "999999999",
+		},
+		{
+			name:     "float with decimals",
+			sample:   metric.Sample{Field: testFields[6], Value: 15.5},
+			expected: "15.50",
+		},
+		{
+			name:     "negative float",
+			sample:   metric.Sample{Field: testFields[3], Value: -100.0},
+			expected: "-100",
+		},
+		{
+			name:     "string",
+			sample:   metric.Sample{Field: metric.Field{Name: "output_timecode", Type: metric.StringValue}, Value: "00:01:02.500"},
+			expected: "00:01:02.500",
+		},
+		{
+			name:     "missing value",
+			sample:   metric.Sample{Field: testFields[1]},
+			expected: "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := formatValue(tt.sample); got != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, got)
+			}
+		})
 	}
 }
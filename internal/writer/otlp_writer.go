@@ -0,0 +1,388 @@
+package writer
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/joepadmiraal/metrics-for-obs/internal/metric"
+)
+
+const (
+	otlpTemporalityCumulative = 2
+	otlpScopeName             = "github.com/joepadmiraal/metrics-for-obs"
+)
+
+// otlpRTTBounds are the histogram bucket boundaries for round-trip times in milliseconds
+var otlpRTTBounds = []float64{1, 2, 5, 10, 20, 50, 100, 200, 500, 1000}
+
+// OTLPConfig configures the OpenTelemetry export, an empty endpoint disables it
+type OTLPConfig struct {
+	Endpoint string // base URL of the collector, e.g. http://localhost:4318, /v1/metrics is appended
+	Headers  map[string]string
+}
+
+// OTLPWriter exports metrics rows to an OpenTelemetry collector over OTLP/HTTP with JSON encoding.
+// Durations become histograms, counter fields cumulative sums and all other fields gauges. Every
+// export holds the complete state, so a failed export is superseded by the next one and isn't retried.
+type OTLPWriter struct {
+	url        string
+	headers    map[string]string
+	client     *http.Client
+	resource   []otlpKeyValue
+	fields     []metric.Field
+	startTime  time.Time
+	counters   map[string]float64
+	histograms map[string]*otlpHistogramState
+	errors     map[string]uint64
+	mu         sync.Mutex
+}
+
+type otlpHistogramState struct {
+	count   uint64
+	sum     float64
+	min     float64
+	max     float64
+	buckets []uint64
+}
+
+// NewOTLPWriter creates a writer that describes the exported resource with the OBS setup and OS
+func NewOTLPWriter(config OTLPConfig, session Session, fields []metric.Field) (*OTLPWriter, error) {
+	if !strings.HasPrefix(config.Endpoint, "http://") && !strings.HasPrefix(config.Endpoint, "https://") {
+		return nil, fmt.Errorf("invalid OTLP endpoint %q, expected an http or https URL", config.Endpoint)
+	}
+
+	url := strings.TrimSuffix(config.Endpoint, "/")
+	if !strings.HasSuffix(url, "/v1/metrics") {
+		url += "/v1/metrics"
+	}
+
+	ow := &OTLPWriter{
+		url:        url,
+		headers:    config.Headers,
+		client:     &http.Client{Timeout: 10 * time.Second},
+		resource:   otlpResourceAttributes(session),
+		fields:     fields,
+		startTime:  time.Now(),
+		counters:   make(map[string]float64),
+		histograms: make(map[string]*otlpHistogramState),
+		errors:     make(map[string]uint64),
+	}
+
+	return ow, nil
+}
+
+// WriteSession describes the following exports with the changed OBS setup
+func (ow *OTLPWriter) WriteSession(session Session) error {
+	ow.mu.Lock()
+	defer ow.mu.Unlock()
+	ow.resource = otlpResourceAttributes(session)
+	return nil
+}
+
+// otlpResourceAttributes follows the semantic conventions where they exist, settings OBS didn't
+// report are left out
+func otlpResourceAttributes(session Session) []otlpKeyValue {
+	attributes := []otlpKeyValue{otlpAttribute("service.name", "metrics-for-obs")}
+	for _, a := range session.attributes() {
+		key := "obs." + a.key
+		switch a.key {
+		case "obs_version":
+			key = "obs.version"
+		case "stream_domain":
+			key = "stream.domain"
+		case "os":
+			key = "os.type"
+		default:
+			if a.value == "" {
+				continue
+			}
+		}
+		attributes = append(attributes, otlpAttribute(key, a.value))
+	}
+	return attributes
+}
+
+// WriteMetrics adds a row to the exported state and exports it
+func (ow *OTLPWriter) WriteMetrics(data MetricsData) error {
+	ow.mu.Lock()
+	defer ow.mu.Unlock()
+
+	payload, err := json.Marshal(ow.update(data))
+	if err != nil {
+		return fmt.Errorf("failed to encode OTLP payload: %w", err)
+	}
+	return ow.export(payload)
+}
+
+// update applies a row to the cumulative state and returns the payload to export, the caller must hold mu
+func (ow *OTLPWriter) update(data MetricsData) otlpPayload {
+	start := strconv.FormatInt(ow.startTime.UnixNano(), 10)
+	now := strconv.FormatInt(data.Timestamp.UnixNano(), 10)
+
+	var metrics []otlpMetric
+	for _, f := range ow.fields {
+		var value float64
+		var ok bool
+		if s, found := data.Sample(f.Name); found {
+			value, ok = s.Float64()
+			ok = ok && !math.IsNaN(value) && !math.IsInf(value, 0)
+		}
+
+		switch {
+		case f.Type == metric.DurationValue:
+			h := ow.histogram(f.Name)
+			if ok {
+				h.observe(value)
+			}
+			metrics = append(metrics, otlpMetric{
+				Name: f.Name,
+				Unit: otlpUnit(f),
+				Histogram: &otlpHistogram{
+					AggregationTemporality: otlpTemporalityCumulative,
+					DataPoints:             []otlpHistogramDataPoint{h.dataPoint(start, now)},
+				},
+			})
+		case f.Kind == metric.Counter:
+			if ok {
+				ow.counters[f.Name] += value
+			}
+			total := ow.counters[f.Name]
+			metrics = append(metrics, otlpMetric{
+				Name: f.Name,
+				Unit: otlpUnit(f),
+				Sum: &otlpSum{
+					AggregationTemporality: otlpTemporalityCumulative,
+					IsMonotonic:            true,
+					DataPoints:             []otlpNumberDataPoint{{StartTimeUnixNano: start, TimeUnixNano: now, AsDouble: &total}},
+				},
+			})
+		case ok:
+			point := otlpNumberDataPoint{TimeUnixNano: now, AsDouble: &value}
+			if f.Type == metric.BoolValue {
+				asInt := strconv.FormatFloat(value, 'f', 0, 64)
+				point = otlpNumberDataPoint{TimeUnixNano: now, AsInt: &asInt}
+			}
+			metrics = append(metrics, otlpMetric{
+				Name:  f.Name,
+				Unit:  otlpUnit(f),
+				Gauge: &otlpGauge{DataPoints: []otlpNumberDataPoint{point}},
+			})
+		}
+	}
+
+	for _, e := range data.Errors {
+		ow.errors[e.Source]++
+	}
+	metrics = append(metrics, ow.errorsMetric(start, now))
+
+	return otlpPayload{ResourceMetrics: []otlpResourceMetrics{{
+		Resource: otlpResource{Attributes: ow.resource},
+		ScopeMetrics: []otlpScopeMetrics{{
+			Scope:   otlpScope{Name: otlpScopeName},
+			Metrics: metrics,
+		}},
+	}}}
+}
+
+func (ow *OTLPWriter) histogram(name string) *otlpHistogramState {
+	h, ok := ow.histograms[name]
+	if !ok {
+		h = &otlpHistogramState{buckets: make([]uint64, len(otlpRTTBounds)+1)}
+		ow.histograms[name] = h
+	}
+	return h
+}
+
+// errorsMetric counts the rows with an error per source, the caller must hold mu
+func (ow *OTLPWriter) errorsMetric(start, now string) otlpMetric {
+	sources := make([]string, 0, len(ow.errors))
+	for source := range ow.errors {
+		sources = append(sources, source)
+	}
+	sort.Strings(sources)
+
+	points := make([]otlpNumberDataPoint, len(sources))
+	for i, source := range sources {
+		count := strconv.FormatUint(ow.errors[source], 10)
+		points[i] = otlpNumberDataPoint{
+			Attributes:        []otlpKeyValue{otlpAttribute("source", source)},
+			StartTimeUnixNano: start,
+			TimeUnixNano:      now,
+			AsInt:             &count,
+		}
+	}
+
+	return otlpMetric{
+		Name: "errors",
+		Sum: &otlpSum{
+			AggregationTemporality: otlpTemporalityCumulative,
+			IsMonotonic:            true,
+			DataPoints:             points,
+		},
+	}
+}
+
+func (ow *OTLPWriter) export(payload []byte) error {
+	req, err := http.NewRequest(http.MethodPost, ow.url, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range ow.headers {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := ow.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("OTLP collector responded with %d: %s", resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
+
+// Close releases the connections to the collector
+func (ow *OTLPWriter) Close() error {
+	ow.client.CloseIdleConnections()
+	return nil
+}
+
+func (h *otlpHistogramState) observe(value float64) {
+	if h.count == 0 || value < h.min {
+		h.min = value
+	}
+	if h.count == 0 || value > h.max {
+		h.max = value
+	}
+	h.count++
+	h.sum += value
+	h.buckets[sort.SearchFloat64s(otlpRTTBounds, value)]++
+}
+
+func (h *otlpHistogramState) dataPoint(start, now string) otlpHistogramDataPoint {
+	buckets := make([]string, len(h.buckets))
+	for i, b := range h.buckets {
+		buckets[i] = strconv.FormatUint(b, 10)
+	}
+
+	point := otlpHistogramDataPoint{
+		StartTimeUnixNano: start,
+		TimeUnixNano:      now,
+		Count:             strconv.FormatUint(h.count, 10),
+		Sum:               h.sum,
+		BucketCounts:      buckets,
+		ExplicitBounds:    otlpRTTBounds,
+	}
+	if h.count > 0 {
+		point.Min = &h.min
+		point.Max = &h.max
+	}
+	return point
+}
+
+// otlpUnit returns the UCUM unit for the known field name suffixes
+func otlpUnit(f metric.Field) string {
+	switch {
+	case f.Type == metric.DurationValue || strings.HasSuffix(f.Name, "_ms"):
+		return "ms"
+	case strings.HasSuffix(f.Name, "_percent"):
+		return "%"
+	case strings.HasSuffix(f.Name, "_bytes"):
+		return "By"
+	case strings.HasSuffix(f.Name, "_mb"):
+		return "MBy"
+	}
+	return ""
+}
+
+func otlpAttribute(key, value string) otlpKeyValue {
+	return otlpKeyValue{Key: key, Value: otlpAnyValue{StringValue: value}}
+}
+
+// The types below follow the JSON mapping of the OTLP protobuf messages, 64 bit integers are strings
+
+type otlpPayload struct {
+	ResourceMetrics []otlpResourceMetrics `json:"resourceMetrics"`
+}
+
+type otlpResourceMetrics struct {
+	Resource     otlpResource       `json:"resource"`
+	ScopeMetrics []otlpScopeMetrics `json:"scopeMetrics"`
+}
+
+type otlpResource struct {
+	Attributes []otlpKeyValue `json:"attributes"`
+}
+
+type otlpKeyValue struct {
+	Key   string       `json:"key"`
+	Value otlpAnyValue `json:"value"`
+}
+
+type otlpAnyValue struct {
+	StringValue string `json:"stringValue"`
+}
+
+type otlpScopeMetrics struct {
+	Scope   otlpScope    `json:"scope"`
+	Metrics []otlpMetric `json:"metrics"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpMetric struct {
+	Name      string         `json:"name"`
+	Unit      string         `json:"unit,omitempty"`
+	Gauge     *otlpGauge     `json:"gauge,omitempty"`
+	Sum       *otlpSum       `json:"sum,omitempty"`
+	Histogram *otlpHistogram `json:"histogram,omitempty"`
+}
+
+type otlpGauge struct {
+	DataPoints []otlpNumberDataPoint `json:"dataPoints"`
+}
+
+type otlpSum struct {
+	DataPoints             []otlpNumberDataPoint `json:"dataPoints"`
+	AggregationTemporality int                   `json:"aggregationTemporality"`
+	IsMonotonic            bool                  `json:"isMonotonic"`
+}
+
+type otlpHistogram struct {
+	DataPoints             []otlpHistogramDataPoint `json:"dataPoints"`
+	AggregationTemporality int                      `json:"aggregationTemporality"`
+}
+
+type otlpNumberDataPoint struct {
+	Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+	StartTimeUnixNano string         `json:"startTimeUnixNano,omitempty"`
+	TimeUnixNano      string         `json:"timeUnixNano"`
+	AsDouble          *float64       `json:"asDouble,omitempty"`
+	AsInt             *string        `json:"asInt,omitempty"`
+}
+
+type otlpHistogramDataPoint struct {
+	StartTimeUnixNano string    `json:"startTimeUnixNano"`
+	TimeUnixNano      string    `json:"timeUnixNano"`
+	Count             string    `json:"count"`
+	Sum               float64   `json:"sum"`
+	BucketCounts      []string  `json:"bucketCounts"`
+	ExplicitBounds    []float64 `json:"explicitBounds"`
+	Min               *float64  `json:"min,omitempty"`
+	Max               *float64  `json:"max,omitempty"`
+}
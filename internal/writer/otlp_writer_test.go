@@ -0,0 +1,229 @@
+package writer
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/joepadmiraal/metrics-for-obs/internal/metric"
+)
+
+// otlpStandIn decodes the exports posted to /v1/metrics
+type otlpStandIn struct {
+	server   *httptest.Server
+	payloads []otlpPayload
+	headers  []http.Header
+	paths    []string
+	status   int
+	mu       sync.Mutex
+}
+
+func newOTLPStandIn(t *testing.T, status int) *otlpStandIn {
+	s := &otlpStandIn{status: status}
+	s.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+
+		var payload otlpPayload
+		if err := json.Unmarshal(body, &payload); err != nil {
+			t.Errorf("Export is not valid JSON: %v", err)
+		}
+
+		s.mu.Lock()
+		s.payloads = append(s.payloads, payload)
+		s.headers = append(s.headers, r.Header)
+		s.paths = append(s.paths, r.URL.Path)
+		s.mu.Unlock()
+
+		w.WriteHeader(s.status)
+	}))
+	t.Cleanup(s.server.Close)
+	return s
+}
+
+func (s *otlpStandIn) count() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.payloads)
+}
+
+func (s *otlpStandIn) last() otlpPayload {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.payloads[len(s.payloads)-1]
+}
+
+func findOTLPMetric(t *testing.T, payload otlpPayload, name string) otlpMetric {
+	t.Helper()
+
+	for _, m := range payload.ResourceMetrics[0].ScopeMetrics[0].Metrics {
+		if m.Name == name {
+			return m
+		}
+	}
+	t.Fatalf("Metric %s not found in export", name)
+	return otlpMetric{}
+}
+
+func TestOTLPWriter_WriteMetrics_MapsFieldsToMetricTypes(t *testing.T) {
+	standIn := newOTLPStandIn(t, http.StatusOK)
+
+	ow, err := NewOTLPWriter(OTLPConfig{
+		Endpoint: standIn.server.URL,
+		Headers:  map[string]string{"Authorization": "Bearer secret"},
+	}, testSession, testFields)
+	if err != nil {
+		t.Fatalf("NewOTLPWriter failed: %v", err)
+	}
+
+	ow.WriteMetrics(newTestData(time.Now(), map[string]any{
+		"obs_rtt_ms":      4 * time.Millisecond,
+		"stream_active":   true,
+		"output_bytes":    1000.0,
+		"obs_cpu_percent": 2.8,
+	}))
+	if err := ow.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	if standIn.count() != 1 {
+		t.Fatalf("Expected 1 export, got %d", standIn.count())
+	}
+	if standIn.paths[0] != "/v1/metrics" {
+		t.Errorf("Expected path /v1/metrics, got %s", standIn.paths[0])
+	}
+	if ct := standIn.headers[0].Get("Content-Type"); ct != "application/json" {
+		t.Errorf("Expected JSON content type, got %q", ct)
+	}
+	if auth := standIn.headers[0].Get("Authorization"); auth != "Bearer secret" {
+		t.Errorf("Expected the configured header, got %q", auth)
+	}
+
+	payload := standIn.last()
+
+	attributes := make(map[string]string)
+	for _, kv := range payload.ResourceMetrics[0].Resource.Attributes {
+		attributes[kv.Key] = kv.Value.StringValue
+	}
+	expectedAttributes := map[string]string{
+		"service.name":  "metrics-for-obs",
+		"obs.version":   "30.0.0",
+		"os.type":       runtime.GOOS,
+		"stream.domain": "live.twitch.tv",
+		"obs.encoder":   "x264",
+		"obs.fps":       "60",
+	}
+	for key, expected := range expectedAttributes {
+		if attributes[key] != expected {
+			t.Errorf("Expected resource attribute %s to be %q, got %q", key, expected, attributes[key])
+		}
+	}
+
+	rtt := findOTLPMetric(t, payload, "obs_rtt_ms")
+	if rtt.Histogram == nil || rtt.Unit != "ms" {
+		t.Errorf("Expected obs_rtt_ms to be a histogram in ms, got %+v", rtt)
+	}
+
+	bytes := findOTLPMetric(t, payload, "output_bytes")
+	if bytes.Sum == nil || !bytes.Sum.IsMonotonic || bytes.Sum.AggregationTemporality != otlpTemporalityCumulative {
+		t.Errorf("Expected output_bytes to be a cumulative monotonic sum, got %+v", bytes)
+	}
+
+	cpu := findOTLPMetric(t, payload, "obs_cpu_percent")
+	if cpu.Gauge == nil || *cpu.Gauge.DataPoints[0].AsDouble != 2.8 {
+		t.Errorf("Expected obs_cpu_percent to be a gauge of 2.8, got %+v", cpu)
+	}
+
+	active := findOTLPMetric(t, payload, "stream_active")
+	if active.Gauge == nil || active.Gauge.DataPoints[0].AsInt == nil || *active.Gauge.DataPoints[0].AsInt != "1" {
+		t.Errorf("Expected stream_active to be an integer gauge of 1, got %+v", active)
+	}
+}
+
+func TestOTLPWriter_WriteMetrics_MissingGaugeIsOmitted(t *testing.T) {
+	ow := &OTLPWriter{
+		fields:     testFields,
+		counters:   make(map[string]float64),
+		histograms: make(map[string]*otlpHistogramState),
+		errors:     make(map[string]uint64),
+	}
+
+	payload := ow.update(newTestData(time.Now(), map[string]any{}))
+
+	for _, m := range payload.ResourceMetrics[0].ScopeMetrics[0].Metrics {
+		if m.Name == "obs_cpu_percent" {
+			t.Errorf("Expected obs_cpu_percent without a value to be left out, got %+v", m)
+		}
+	}
+}
+
+func TestOTLPWriter_WriteMetrics_CumulativeState(t *testing.T) {
+	ow := &OTLPWriter{
+		fields:     testFields,
+		counters:   make(map[string]float64),
+		histograms: make(map[string]*otlpHistogramState),
+		errors:     make(map[string]uint64),
+	}
+
+	ow.update(newTestData(time.Now(), map[string]any{"obs_rtt_ms": 4 * time.Millisecond, "output_bytes": 1000.0}))
+	ow.update(newTestData(time.Now(), map[string]any{"obs_rtt_ms": 30 * time.Millisecond, "output_bytes": 500.0},
+		metric.SourceError{Source: "obs_ping", Err: errors.New("timeout")}))
+	payload := ow.update(newTestData(time.Now(), map[string]any{"obs_rtt_ms": 1500 * time.Millisecond},
+		metric.SourceError{Source: "obs_ping", Err: errors.New("timeout")}))
+
+	bytes := findOTLPMetric(t, payload, "output_bytes")
+	if total := *bytes.Sum.DataPoints[0].AsDouble; total != 1500 {
+		t.Errorf("Expected output_bytes total to be 1500, got %v", total)
+	}
+
+	rtt := findOTLPMetric(t, payload, "obs_rtt_ms").Histogram.DataPoints[0]
+	if rtt.Count != "3" || rtt.Sum != 1534 || *rtt.Min != 4 || *rtt.Max != 1500 {
+		t.Errorf("Unexpected histogram summary: count %s, sum %v, min %v, max %v", rtt.Count, rtt.Sum, *rtt.Min, *rtt.Max)
+	}
+	// 4ms falls in (2, 5], 30ms in (20, 50] and 1500ms in the overflow bucket
+	expectedBuckets := []string{"0", "0", "1", "0", "0", "1", "0", "0", "0", "0", "1"}
+	for i, expected := range expectedBuckets {
+		if rtt.BucketCounts[i] != expected {
+			t.Errorf("Expected bucket %d to be %s, got %s", i, expected, rtt.BucketCounts[i])
+		}
+	}
+
+	errs := findOTLPMetric(t, payload, "errors").Sum.DataPoints
+	if len(errs) != 1 || errs[0].Attributes[0].Value.StringValue != "obs_ping" || *errs[0].AsInt != "2" {
+		t.Errorf("Expected 2 errors for obs_ping, got %+v", errs)
+	}
+}
+
+func TestOTLPWriter_WriteMetrics_ReportsExportErrors(t *testing.T) {
+	standIn := newOTLPStandIn(t, http.StatusBadRequest)
+
+	ow, err := NewOTLPWriter(OTLPConfig{Endpoint: standIn.server.URL + "/v1/metrics"}, Session{ObsVersion: "30.0.0"}, testFields)
+	if err != nil {
+		t.Fatalf("NewOTLPWriter failed: %v", err)
+	}
+	defer ow.Close()
+
+	err = ow.WriteMetrics(newTestData(time.Now(), nil))
+
+	if standIn.count() != 1 {
+		t.Fatalf("Expected 1 export, got %d", standIn.count())
+	}
+	if standIn.paths[0] != "/v1/metrics" {
+		t.Errorf("Expected /v1/metrics not to be appended twice, got %s", standIn.paths[0])
+	}
+	if err == nil || !strings.Contains(err.Error(), "400") {
+		t.Errorf("Expected the export error to be reported, got %v", err)
+	}
+}
+
+func TestNewOTLPWriter_InvalidEndpoint(t *testing.T) {
+	if _, err := NewOTLPWriter(OTLPConfig{Endpoint: "localhost:4318"}, Session{ObsVersion: "30.0.0"}, testFields); err == nil {
+		t.Error("Expected error for an endpoint without scheme")
+	}
+}
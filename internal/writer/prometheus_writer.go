@@ -0,0 +1,188 @@
+package writer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/joepadmiraal/metrics-for-obs/internal/metric"
+)
+
+// PrometheusWriter exposes the latest metrics on an HTTP endpoint in the Prometheus text format.
+// Gauges report the value of the last row, counter fields hold per-interval deltas and are summed
+// into a running total.
+type PrometheusWriter struct {
+	fields   []metric.Field
+	labels   string
+	info     string
+	gauges   map[string]float64
+	counters map[string]float64
+	errors   map[string]float64
+	server   *http.Server
+	addr     string
+	mu       sync.Mutex
+}
+
+// NewPrometheusWriter creates a writer whose values are labelled with the OBS version and stream domain,
+// the complete OBS setup is exposed as the labels of obs_session_info. When addr is not empty it
+// serves the metrics on http://addr/metrics.
+func NewPrometheusWriter(addr string, session Session, fields []metric.Field) (*PrometheusWriter, error) {
+	pw := &PrometheusWriter{
+		fields:   fields,
+		gauges:   make(map[string]float64),
+		counters: make(map[string]float64),
+		errors:   make(map[string]float64),
+	}
+	pw.setSession(session)
+
+	if addr == "" {
+		return pw, nil
+	}
+
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen for Prometheus scrapes: %w", err)
+	}
+
+	pw.addr = listener.Addr().String()
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", pw)
+	pw.server = &http.Server{Handler: mux, ReadHeaderTimeout: 5 * time.Second}
+
+	go func() {
+		if err := pw.server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			fmt.Printf("Prometheus endpoint error: %v\n", err)
+		}
+	}()
+
+	return pw, nil
+}
+
+// Addr returns the address the metrics are served on, it is empty when no endpoint is running
+func (pw *PrometheusWriter) Addr() string {
+	return pw.addr
+}
+
+// WriteSession relabels the values with the changed OBS setup
+func (pw *PrometheusWriter) WriteSession(session Session) error {
+	pw.mu.Lock()
+	defer pw.mu.Unlock()
+	pw.setSession(session)
+	return nil
+}
+
+func (pw *PrometheusWriter) setSession(session Session) {
+	pw.labels = fmt.Sprintf(`obs_version="%s",stream_domain="%s"`,
+		escapeLabelValue(session.ObsVersion), escapeLabelValue(session.StreamDomain))
+
+	var info []string
+	for _, a := range session.attributes() {
+		info = append(info, fmt.Sprintf(`%s="%s"`, a.key, escapeLabelValue(a.value)))
+	}
+	pw.info = strings.Join(info, ",")
+}
+
+// WriteMetrics updates the exposed values with a metrics row
+func (pw *PrometheusWriter) WriteMetrics(data MetricsData) error {
+	pw.mu.Lock()
+	defer pw.mu.Unlock()
+
+	for _, f := range pw.fields {
+		s, ok := data.Sample(f.Name)
+		if !ok {
+			delete(pw.gauges, f.Name)
+			continue
+		}
+		value, ok := s.Float64()
+
+		switch f.Kind {
+		case metric.Counter:
+			if ok {
+				pw.counters[f.Name] += value
+			}
+		default:
+			if ok {
+				pw.gauges[f.Name] = value
+			} else {
+				delete(pw.gauges, f.Name)
+			}
+		}
+	}
+
+	for _, e := range data.Errors {
+		pw.errors[e.Source]++
+	}
+
+	return nil
+}
+
+// ServeHTTP writes the current values in the Prometheus text exposition format
+func (pw *PrometheusWriter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	pw.writeTo(w)
+}
+
+func (pw *PrometheusWriter) writeTo(w io.Writer) {
+	pw.mu.Lock()
+	defer pw.mu.Unlock()
+
+	fmt.Fprintf(w, "# TYPE obs_session_info gauge\n")
+	fmt.Fprintf(w, "obs_session_info{%s} 1\n", pw.info)
+
+	for _, f := range pw.fields {
+		if f.Kind == metric.Counter {
+			name := f.Name + "_total"
+			fmt.Fprintf(w, "# TYPE %s counter\n", name)
+			fmt.Fprintf(w, "%s{%s} %s\n", name, pw.labels, formatPrometheusValue(pw.counters[f.Name]))
+			continue
+		}
+
+		value, ok := pw.gauges[f.Name]
+		if !ok {
+			continue
+		}
+		fmt.Fprintf(w, "# TYPE %s gauge\n", f.Name)
+		fmt.Fprintf(w, "%s{%s} %s\n", f.Name, pw.labels, formatPrometheusValue(value))
+	}
+
+	sources := make([]string, 0, len(pw.errors))
+	for source := range pw.errors {
+		sources = append(sources, source)
+	}
+	sort.Strings(sources)
+
+	fmt.Fprintf(w, "# TYPE errors_total counter\n")
+	for _, source := range sources {
+		fmt.Fprintf(w, "errors_total{%s,source=\"%s\"} %s\n",
+			pw.labels, escapeLabelValue(source), formatPrometheusValue(pw.errors[source]))
+	}
+}
+
+// Close stops the HTTP endpoint
+func (pw *PrometheusWriter) Close() error {
+	if pw.server == nil {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return pw.server.Shutdown(ctx)
+}
+
+func formatPrometheusValue(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabelValue(v string) string {
+	return labelValueEscaper.Replace(v)
+}
@@ -0,0 +1,191 @@
+package writer
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/joepadmiraal/metrics-for-obs/internal/metric"
+)
+
+const testLabels = `obs_version="30.0.0",stream_domain="live.twitch.tv"`
+
+func scrape(t *testing.T, pw *PrometheusWriter) string {
+	t.Helper()
+
+	rec := httptest.NewRecorder()
+	pw.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain") {
+		t.Errorf("Expected text/plain content type, got %q", ct)
+	}
+	return rec.Body.String()
+}
+
+func TestPrometheusWriter_WriteMetrics_Gauges(t *testing.T) {
+	pw, err := NewPrometheusWriter("", testSession, testFields)
+	if err != nil {
+		t.Fatalf("NewPrometheusWriter failed: %v", err)
+	}
+
+	data := newTestData(time.Now(), map[string]any{
+		"obs_rtt_ms":      1500 * time.Microsecond,
+		"stream_active":   true,
+		"obs_cpu_percent": 15.5,
+	})
+	if err := pw.WriteMetrics(data); err != nil {
+		t.Fatalf("WriteMetrics failed: %v", err)
+	}
+
+	body := scrape(t, pw)
+
+	expected := []string{
+		"# TYPE obs_rtt_ms gauge\nobs_rtt_ms{" + testLabels + "} 1.5\n",
+		"# TYPE stream_active gauge\nstream_active{" + testLabels + "} 1\n",
+		"# TYPE obs_cpu_percent gauge\nobs_cpu_percent{" + testLabels + "} 15.5\n",
+	}
+	for _, e := range expected {
+		if !strings.Contains(body, e) {
+			t.Errorf("Expected output to contain %q, got:\n%s", e, body)
+		}
+	}
+}
+
+func TestPrometheusWriter_WriteSession(t *testing.T) {
+	pw, _ := NewPrometheusWriter("", testSession, testFields)
+	pw.WriteMetrics(newTestData(time.Now(), map[string]any{"obs_cpu_percent": 15.5}))
+
+	body := scrape(t, pw)
+	info := `obs_session_info{obs_version="30.0.0",stream_domain="live.twitch.tv",os="` + runtime.GOOS +
+		`",service_type="rtmp_common",base_resolution="1920x1080",output_resolution="1280x720",fps="60",` +
+		`output_mode="Simple",encoder="x264",bitrate_kbps="6000"} 1`
+	if !strings.Contains(body, info) {
+		t.Errorf("Expected output to contain %q, got:\n%s", info, body)
+	}
+
+	pw.WriteSession(Session{ObsVersion: "30.0.0", StreamDomain: "a.rtmp.youtube.com", Encoder: "jim_nvenc"})
+
+	body = scrape(t, pw)
+	expected := []string{
+		`obs_cpu_percent{obs_version="30.0.0",stream_domain="a.rtmp.youtube.com"} 15.5`,
+		`encoder="jim_nvenc",bitrate_kbps=""} 1`,
+	}
+	for _, e := range expected {
+		if !strings.Contains(body, e) {
+			t.Errorf("Expected output to contain %q, got:\n%s", e, body)
+		}
+	}
+}
+
+func TestPrometheusWriter_WriteMetrics_MissingGaugeIsOmitted(t *testing.T) {
+	pw, _ := NewPrometheusWriter("", testSession, testFields)
+
+	pw.WriteMetrics(newTestData(time.Now(), map[string]any{"obs_cpu_percent": 15.5}))
+	pw.WriteMetrics(newTestData(time.Now(), map[string]any{}))
+
+	body := scrape(t, pw)
+	if strings.Contains(body, "obs_cpu_percent") {
+		t.Errorf("Expected obs_cpu_percent to be omitted after a row without a value, got:\n%s", body)
+	}
+}
+
+func TestPrometheusWriter_WriteMetrics_CountersAccumulate(t *testing.T) {
+	pw, _ := NewPrometheusWriter("", testSession, testFields)
+
+	pw.WriteMetrics(newTestData(time.Now(), map[string]any{"output_bytes": 1000.0, "output_frames": 30.0}))
+	pw.WriteMetrics(newTestData(time.Now(), map[string]any{"output_bytes": 500.0, "output_frames": 30.0}))
+	pw.WriteMetrics(newTestData(time.Now(), map[string]any{}))
+
+	body := scrape(t, pw)
+
+	expected := []string{
+		"# TYPE output_bytes_total counter\noutput_bytes_total{" + testLabels + "} 1500\n",
+		"output_frames_total{" + testLabels + "} 60\n",
+		"output_skipped_frames_total{" + testLabels + "} 0\n",
+	}
+	for _, e := range expected {
+		if !strings.Contains(body, e) {
+			t.Errorf("Expected output to contain %q, got:\n%s", e, body)
+		}
+	}
+}
+
+func TestPrometheusWriter_WriteMetrics_CountsErrorsPerSource(t *testing.T) {
+	pw, _ := NewPrometheusWriter("", testSession, testFields)
+
+	pw.WriteMetrics(newTestData(time.Now(), nil,
+		metric.SourceError{Source: "obs_ping", Err: errors.New("timeout")},
+		metric.SourceError{Source: "stream", Err: errors.New("disconnected")},
+	))
+	pw.WriteMetrics(newTestData(time.Now(), nil,
+		metric.SourceError{Source: "obs_ping", Err: errors.New("timeout")},
+	))
+
+	body := scrape(t, pw)
+
+	expected := []string{
+		"errors_total{" + testLabels + `,source="obs_ping"} 2` + "\n",
+		"errors_total{" + testLabels + `,source="stream"} 1` + "\n",
+	}
+	for _, e := range expected {
+		if !strings.Contains(body, e) {
+			t.Errorf("Expected output to contain %q, got:\n%s", e, body)
+		}
+	}
+}
+
+func TestPrometheusWriter_NewPrometheusWriter_ServesMetrics(t *testing.T) {
+	pw, err := NewPrometheusWriter("127.0.0.1:0", testSession, testFields)
+	if err != nil {
+		t.Fatalf("NewPrometheusWriter failed: %v", err)
+	}
+	defer pw.Close()
+
+	pw.WriteMetrics(newTestData(time.Now(), map[string]any{"obs_memory_mb": 512.0}))
+
+	resp, err := http.Get("http://" + pw.Addr() + "/metrics")
+	if err != nil {
+		t.Fatalf("Scrape failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	if !strings.Contains(string(body), "obs_memory_mb{"+testLabels+"} 512\n") {
+		t.Errorf("Expected scraped output to contain obs_memory_mb, got:\n%s", body)
+	}
+}
+
+func TestPrometheusWriter_NewPrometheusWriter_AddressInUse(t *testing.T) {
+	first, err := NewPrometheusWriter("127.0.0.1:0", testSession, testFields)
+	if err != nil {
+		t.Fatalf("NewPrometheusWriter failed: %v", err)
+	}
+	defer first.Close()
+
+	if _, err := NewPrometheusWriter(first.Addr(), testSession, testFields); err == nil {
+		t.Error("Expected error when the address is already in use")
+	}
+}
+
+func TestEscapeLabelValue(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{input: "live.twitch.tv", expected: "live.twitch.tv"},
+		{input: `say "hi"`, expected: `say \"hi\"`},
+		{input: `C:\obs`, expected: `C:\\obs`},
+		{input: "two\nlines", expected: `two\nlines`},
+	}
+
+	for _, tt := range tests {
+		if got := escapeLabelValue(tt.input); got != tt.expected {
+			t.Errorf("escapeLabelValue(%q) = %q, expected %q", tt.input, got, tt.expected)
+		}
+	}
+}
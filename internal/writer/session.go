@@ -0,0 +1,44 @@
+package writer
+
+import "runtime"
+
+// Session describes the OBS setup the metrics are recorded with, settings OBS didn't report are empty
+type Session struct {
+	ObsVersion       string
+	StreamDomain     string
+	ServiceType      string // rtmp_common for a listed service, rtmp_custom for a custom server
+	BaseResolution   string // canvas size, e.g. 1920x1080
+	OutputResolution string // scaled size the encoder receives
+	FPS              string
+	OutputMode       string // Simple or Advanced
+	Encoder          string
+	Bitrate          string // video bitrate in kbps, only known in the simple output mode
+}
+
+// SessionWriter is implemented by writers that record the OBS setup again when it changes during a
+// run, for example after switching profiles. Every writer receives the initial setup when it is created.
+type SessionWriter interface {
+	WriteSession(session Session) error
+}
+
+type sessionAttribute struct {
+	key   string
+	label string
+	value string
+}
+
+// attributes returns the setup in a fixed order together with the OS of this machine
+func (s Session) attributes() []sessionAttribute {
+	return []sessionAttribute{
+		{"obs_version", "OBS Studio version", s.ObsVersion},
+		{"stream_domain", "Stream domain", s.StreamDomain},
+		{"os", "OS", runtime.GOOS},
+		{"service_type", "Service type", s.ServiceType},
+		{"base_resolution", "Base resolution", s.BaseResolution},
+		{"output_resolution", "Output resolution", s.OutputResolution},
+		{"fps", "FPS", s.FPS},
+		{"output_mode", "Output mode", s.OutputMode},
+		{"encoder", "Encoder", s.Encoder},
+		{"bitrate_kbps", "Bitrate (kbps)", s.Bitrate},
+	}
+}
@@ -0,0 +1,257 @@
+package writer
+
+import (
+	"database/sql"
+	"fmt"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/joepadmiraal/metrics-for-obs/internal/metric"
+	_ "modernc.org/sqlite"
+)
+
+// sqliteTimeFormat sorts as text and is understood by the SQLite date and time functions
+const sqliteTimeFormat = "2006-01-02T15:04:05.000Z"
+
+// SQLiteWriter stores every run as a row in the sessions table and its metrics rows in the samples
+// table, the OBS setup of a run is kept in the settings table with a row per change. The file is
+// reused across runs, so sessions can be compared with SQL.
+type SQLiteWriter struct {
+	db        *sql.DB
+	sessionID int64
+	fields    []metric.Field
+	insert    *sql.Stmt
+	mu        sync.Mutex
+}
+
+// NewSQLiteWriter opens or creates the database, adds columns for fields it doesn't know yet and starts a new session
+func NewSQLiteWriter(filename string, session Session, fields []metric.Field) (*SQLiteWriter, error) {
+	db, err := sql.Open("sqlite", filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open SQLite database: %w", err)
+	}
+	// SQLite allows a single writer, one connection avoids busy errors between them
+	db.SetMaxOpenConns(1)
+
+	sw := &SQLiteWriter{db: db, fields: fields}
+	if err := sw.init(session); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return sw, nil
+}
+
+func (sw *SQLiteWriter) init(session Session) error {
+	statements := []string{
+		`PRAGMA journal_mode=WAL`,
+		`CREATE TABLE IF NOT EXISTS sessions (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			obs_version TEXT NOT NULL,
+			stream_domain TEXT NOT NULL,
+			os TEXT NOT NULL,
+			started_at TEXT NOT NULL,
+			ended_at TEXT
+		)`,
+		`CREATE TABLE IF NOT EXISTS samples (
+			session_id INTEGER NOT NULL REFERENCES sessions(id),
+			timestamp TEXT NOT NULL,
+			errors TEXT NOT NULL DEFAULT ''
+		)`,
+		`CREATE INDEX IF NOT EXISTS samples_session_timestamp ON samples (session_id, timestamp)`,
+		`CREATE TABLE IF NOT EXISTS settings (
+			session_id INTEGER NOT NULL REFERENCES sessions(id),
+			captured_at TEXT NOT NULL,
+			obs_version TEXT,
+			stream_domain TEXT,
+			os TEXT,
+			service_type TEXT,
+			base_resolution TEXT,
+			output_resolution TEXT,
+			fps REAL,
+			output_mode TEXT,
+			encoder TEXT,
+			bitrate_kbps REAL
+		)`,
+	}
+	for _, stmt := range statements {
+		if _, err := sw.db.Exec(stmt); err != nil {
+			return fmt.Errorf("failed to create SQLite schema: %w", err)
+		}
+	}
+
+	if err := sw.addMissingColumns(); err != nil {
+		return err
+	}
+	if err := sw.addMissingSettingsColumns(); err != nil {
+		return err
+	}
+
+	result, err := sw.db.Exec(
+		`INSERT INTO sessions (obs_version, stream_domain, os, started_at) VALUES (?, ?, ?, ?)`,
+		session.ObsVersion, session.StreamDomain, runtime.GOOS, time.Now().UTC().Format(sqliteTimeFormat),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to start SQLite session: %w", err)
+	}
+	if sw.sessionID, err = result.LastInsertId(); err != nil {
+		return fmt.Errorf("failed to start SQLite session: %w", err)
+	}
+	if err := sw.insertSettings(session); err != nil {
+		return err
+	}
+
+	columns := []string{"session_id", "timestamp", "errors"}
+	for _, f := range sw.fields {
+		columns = append(columns, quoteIdentifier(f.Name))
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(columns)), ", ")
+	sw.insert, err = sw.db.Prepare(fmt.Sprintf(
+		"INSERT INTO samples (%s) VALUES (%s)", strings.Join(columns, ", "), placeholders))
+	if err != nil {
+		return fmt.Errorf("failed to prepare SQLite insert: %w", err)
+	}
+
+	return nil
+}
+
+// columns returns the names of the columns of a table
+func (sw *SQLiteWriter) columns(table string) (map[string]bool, error) {
+	rows, err := sw.db.Query(`SELECT name FROM pragma_table_info(?)`, table)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read SQLite schema: %w", err)
+	}
+	defer rows.Close()
+
+	existing := make(map[string]bool)
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, fmt.Errorf("failed to read SQLite schema: %w", err)
+		}
+		existing[name] = true
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read SQLite schema: %w", err)
+	}
+	return existing, nil
+}
+
+// addMissingColumns adds a column per field that earlier sessions didn't have, older rows keep NULL there
+func (sw *SQLiteWriter) addMissingColumns() error {
+	existing, err := sw.columns("samples")
+	if err != nil {
+		return err
+	}
+
+	for _, f := range sw.fields {
+		if existing[f.Name] {
+			continue
+		}
+		columnType := "REAL"
+		switch f.Type {
+		case metric.BoolValue:
+			columnType = "INTEGER"
+		case metric.StringValue:
+			columnType = "TEXT"
+		}
+		if _, err := sw.db.Exec(fmt.Sprintf("ALTER TABLE samples ADD COLUMN %s %s", quoteIdentifier(f.Name), columnType)); err != nil {
+			return fmt.Errorf("failed to add column %s: %w", f.Name, err)
+		}
+	}
+	return nil
+}
+
+// addMissingSettingsColumns adds the settings that databases of older versions didn't store yet
+func (sw *SQLiteWriter) addMissingSettingsColumns() error {
+	existing, err := sw.columns("settings")
+	if err != nil {
+		return err
+	}
+
+	for _, name := range []string{"obs_version", "os"} {
+		if existing[name] {
+			continue
+		}
+		if _, err := sw.db.Exec(fmt.Sprintf("ALTER TABLE settings ADD COLUMN %s TEXT", name)); err != nil {
+			return fmt.Errorf("failed to add settings column %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// WriteSession adds a row with the changed OBS setup to the settings table
+func (sw *SQLiteWriter) WriteSession(session Session) error {
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+	return sw.insertSettings(session)
+}
+
+// insertSettings stores the complete setup of the current session, a column per attribute. Settings
+// OBS didn't report are NULL.
+func (sw *SQLiteWriter) insertSettings(session Session) error {
+	columns := []string{"session_id", "captured_at"}
+	args := []any{sw.sessionID, time.Now().UTC().Format(sqliteTimeFormat)}
+	for _, a := range session.attributes() {
+		columns = append(columns, a.key)
+		if a.value == "" {
+			args = append(args, nil)
+		} else {
+			args = append(args, a.value)
+		}
+	}
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(columns)), ", ")
+	_, err := sw.db.Exec(fmt.Sprintf("INSERT INTO settings (%s) VALUES (%s)", strings.Join(columns, ", "), placeholders), args...)
+	if err != nil {
+		return fmt.Errorf("failed to store SQLite settings: %w", err)
+	}
+	return nil
+}
+
+// WriteMetrics inserts a metrics row into the current session, missing values are stored as NULL
+func (sw *SQLiteWriter) WriteMetrics(data MetricsData) error {
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+
+	args := []any{sw.sessionID, data.Timestamp.UTC().Format(sqliteTimeFormat), data.ErrorString()}
+	for _, f := range sw.fields {
+		var value any
+		if s, ok := data.Sample(f.Name); ok {
+			if v, ok := s.Float64(); ok {
+				value = v
+			} else if v, ok := s.Value.(string); ok {
+				value = v
+			}
+		}
+		args = append(args, value)
+	}
+
+	if _, err := sw.insert.Exec(args...); err != nil {
+		return fmt.Errorf("failed to insert SQLite row: %w", err)
+	}
+	return nil
+}
+
+// Close ends the session and closes the database
+func (sw *SQLiteWriter) Close() error {
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+
+	_, err := sw.db.Exec(`UPDATE sessions SET ended_at = ? WHERE id = ?`,
+		time.Now().UTC().Format(sqliteTimeFormat), sw.sessionID)
+	if err != nil {
+		err = fmt.Errorf("failed to end SQLite session: %w", err)
+	}
+
+	sw.insert.Close()
+	if closeErr := sw.db.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+func quoteIdentifier(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
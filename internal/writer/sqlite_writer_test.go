@@ -0,0 +1,231 @@
+package writer
+
+import (
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/joepadmiraal/metrics-for-obs/internal/metric"
+)
+
+func openTestDB(t *testing.T, filename string) *sql.DB {
+	t.Helper()
+
+	db, err := sql.Open("sqlite", filename)
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func TestSQLiteWriter_WriteMetrics_StoresSessionAndSamples(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "metrics.db")
+
+	sw, err := NewSQLiteWriter(filename, testSession, testFields)
+	if err != nil {
+		t.Fatalf("NewSQLiteWriter failed: %v", err)
+	}
+
+	ts := time.Date(2025, 12, 23, 10, 0, 0, 0, time.UTC)
+	err = sw.WriteMetrics(newTestData(ts, map[string]any{
+		"obs_rtt_ms":      4740 * time.Microsecond,
+		"stream_active":   true,
+		"output_bytes":    327347.0,
+		"obs_cpu_percent": 2.8,
+	}, metric.SourceError{Source: "google_ping", Err: errors.New("timeout")}))
+	if err != nil {
+		t.Fatalf("WriteMetrics failed: %v", err)
+	}
+	if err := sw.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	db := openTestDB(t, filename)
+
+	var obsVersion, streamDomain, os, startedAt string
+	var endedAt sql.NullString
+	err = db.QueryRow(`SELECT obs_version, stream_domain, os, started_at, ended_at FROM sessions`).
+		Scan(&obsVersion, &streamDomain, &os, &startedAt, &endedAt)
+	if err != nil {
+		t.Fatalf("Failed to read session: %v", err)
+	}
+	if obsVersion != "30.0.0" || streamDomain != "live.twitch.tv" || os != runtime.GOOS {
+		t.Errorf("Unexpected session %s, %s, %s", obsVersion, streamDomain, os)
+	}
+	if !endedAt.Valid || endedAt.String < startedAt {
+		t.Errorf("Expected ended_at to be set after started_at, got %v and %s", endedAt, startedAt)
+	}
+
+	var timestamp, errs string
+	var rtt, bytes, cpu float64
+	var active int
+	var googleRTT sql.NullFloat64
+	err = db.QueryRow(`SELECT timestamp, obs_rtt_ms, google_rtt_ms, stream_active, output_bytes, obs_cpu_percent, errors
+		FROM samples WHERE session_id = 1`).Scan(&timestamp, &rtt, &googleRTT, &active, &bytes, &cpu, &errs)
+	if err != nil {
+		t.Fatalf("Failed to read sample: %v", err)
+	}
+
+	if timestamp != "2025-12-23T10:00:00.000Z" {
+		t.Errorf("Unexpected timestamp %s", timestamp)
+	}
+	if rtt != 4.74 || active != 1 || bytes != 327347 || cpu != 2.8 {
+		t.Errorf("Unexpected values rtt=%v active=%v bytes=%v cpu=%v", rtt, active, bytes, cpu)
+	}
+	if googleRTT.Valid {
+		t.Errorf("Expected a missing value to be NULL, got %v", googleRTT.Float64)
+	}
+	if errs != "google_ping: timeout" {
+		t.Errorf("Unexpected errors %q", errs)
+	}
+}
+
+func TestSQLiteWriter_NewSQLiteWriter_AppendsSessions(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "metrics.db")
+
+	first, err := NewSQLiteWriter(filename, testSession, testFields[:2])
+	if err != nil {
+		t.Fatalf("NewSQLiteWriter failed: %v", err)
+	}
+	first.WriteMetrics(newTestData(time.Now(), map[string]any{"obs_rtt_ms": 5 * time.Millisecond}))
+	first.Close()
+
+	// A later version collects an extra field
+	second, err := NewSQLiteWriter(filename, Session{ObsVersion: "31.0.0", StreamDomain: "a.rtmp.youtube.com"}, testFields)
+	if err != nil {
+		t.Fatalf("NewSQLiteWriter on an existing database failed: %v", err)
+	}
+	second.WriteMetrics(newTestData(time.Now(), map[string]any{"obs_rtt_ms": 7 * time.Millisecond, "obs_cpu_percent": 3.0}))
+	second.WriteMetrics(newTestData(time.Now(), map[string]any{"obs_rtt_ms": 9 * time.Millisecond, "obs_cpu_percent": 3.0}))
+	second.Close()
+
+	db := openTestDB(t, filename)
+
+	rows, err := db.Query(`SELECT s.id, s.obs_version, count(*), avg(obs_rtt_ms)
+		FROM sessions s JOIN samples ON samples.session_id = s.id GROUP BY s.id ORDER BY s.id`)
+	if err != nil {
+		t.Fatalf("Failed to compare sessions: %v", err)
+	}
+	defer rows.Close()
+
+	expected := []struct {
+		version string
+		count   int
+		avgRTT  float64
+	}{
+		{version: "30.0.0", count: 1, avgRTT: 5},
+		{version: "31.0.0", count: 2, avgRTT: 8},
+	}
+	i := 0
+	for rows.Next() {
+		var id, count int
+		var version string
+		var avgRTT float64
+		if err := rows.Scan(&id, &version, &count, &avgRTT); err != nil {
+			t.Fatalf("Failed to scan: %v", err)
+		}
+		if i >= len(expected) {
+			t.Fatalf("Unexpected extra session %d", id)
+		}
+		if version != expected[i].version || count != expected[i].count || avgRTT != expected[i].avgRTT {
+			t.Errorf("Session %d: expected %+v, got version=%s count=%d avg=%v", id, expected[i], version, count, avgRTT)
+		}
+		i++
+	}
+	if i != len(expected) {
+		t.Errorf("Expected %d sessions, got %d", len(expected), i)
+	}
+
+	var cpu sql.NullFloat64
+	if err := db.QueryRow(`SELECT obs_cpu_percent FROM samples WHERE session_id = 1`).Scan(&cpu); err != nil {
+		t.Fatalf("Failed to read added column: %v", err)
+	}
+	if cpu.Valid {
+		t.Errorf("Expected rows of the older session to be NULL in the added column, got %v", cpu.Float64)
+	}
+}
+
+func TestSQLiteWriter_NewSQLiteWriter_InvalidPath(t *testing.T) {
+	_, err := NewSQLiteWriter(filepath.Join(t.TempDir(), "missing", "metrics.db"), Session{ObsVersion: "30.0.0"}, testFields)
+	if err == nil {
+		t.Error("Expected error for a path in a missing directory")
+	}
+}
+
+func TestSQLiteWriter_WriteSession_StoresSettings(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "metrics.db")
+
+	sw, err := NewSQLiteWriter(filename, testSession, testFields)
+	if err != nil {
+		t.Fatalf("NewSQLiteWriter failed: %v", err)
+	}
+	if err := sw.WriteSession(Session{ObsVersion: "31.0.0", StreamDomain: "live.twitch.tv", OutputMode: "Advanced", Encoder: "jim_nvenc"}); err != nil {
+		t.Fatalf("WriteSession failed: %v", err)
+	}
+	sw.Close()
+
+	db := openTestDB(t, filename)
+
+	rows, err := db.Query(`SELECT obs_version, os, output_resolution, fps, encoder, bitrate_kbps FROM settings WHERE session_id = 1 ORDER BY rowid`)
+	if err != nil {
+		t.Fatalf("Failed to read settings: %v", err)
+	}
+	defer rows.Close()
+
+	type settings struct {
+		version    string
+		os         string
+		resolution sql.NullString
+		fps        sql.NullFloat64
+		encoder    string
+		bitrate    sql.NullFloat64
+	}
+	var got []settings
+	for rows.Next() {
+		var s settings
+		if err := rows.Scan(&s.version, &s.os, &s.resolution, &s.fps, &s.encoder, &s.bitrate); err != nil {
+			t.Fatalf("Failed to scan: %v", err)
+		}
+		got = append(got, s)
+	}
+
+	if len(got) != 2 {
+		t.Fatalf("Expected the initial and the changed settings, got %d rows", len(got))
+	}
+	if got[0].version != "30.0.0" || got[0].os != runtime.GOOS || got[0].resolution.String != "1280x720" || got[0].fps.Float64 != 60 || got[0].encoder != "x264" || got[0].bitrate.Float64 != 6000 {
+		t.Errorf("Unexpected initial settings %+v", got[0])
+	}
+	if got[1].version != "31.0.0" || got[1].encoder != "jim_nvenc" || got[1].resolution.Valid || got[1].bitrate.Valid {
+		t.Errorf("Expected settings OBS didn't report to be NULL, got %+v", got[1])
+	}
+}
+
+func TestSQLiteWriter_NewSQLiteWriter_AddsSettingsColumns(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "metrics.db")
+
+	// Databases of older versions stored the settings without the OBS version and the OS
+	db := openTestDB(t, filename)
+	if _, err := db.Exec(`CREATE TABLE settings (session_id INTEGER NOT NULL, captured_at TEXT NOT NULL,
+		stream_domain TEXT, service_type TEXT, base_resolution TEXT, output_resolution TEXT, fps REAL,
+		output_mode TEXT, encoder TEXT, bitrate_kbps REAL)`); err != nil {
+		t.Fatalf("Failed to create the old settings table: %v", err)
+	}
+
+	sw, err := NewSQLiteWriter(filename, testSession, testFields)
+	if err != nil {
+		t.Fatalf("NewSQLiteWriter on an older database failed: %v", err)
+	}
+	sw.Close()
+
+	var version, os string
+	if err := db.QueryRow(`SELECT obs_version, os FROM settings`).Scan(&version, &os); err != nil {
+		t.Fatalf("Failed to read the added columns: %v", err)
+	}
+	if version != "30.0.0" || os != runtime.GOOS {
+		t.Errorf("Expected the OBS version and OS in the settings, got %q and %q", version, os)
+	}
+}
@@ -0,0 +1,157 @@
+package writer
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/joepadmiraal/metrics-for-obs/internal/metric"
+)
+
+// statsdMaxPacketSize keeps datagrams below the usual MTU so they aren't fragmented
+const statsdMaxPacketSize = 1432
+
+// StatsDConfig configures the StatsD output, an empty address disables it
+type StatsDConfig struct {
+	Addr      string   // host:port of the StatsD agent, usually localhost:8125
+	Prefix    string   // prepended to every metric name followed by a dot
+	DogStatsD bool     // add the OBS settings and Tags as DogStatsD tags
+	Tags      []string // extra DogStatsD tags in key:value form
+}
+
+// StatsDWriter sends every row to a StatsD agent over UDP. Counter fields are sent as counters,
+// all other fields as gauges.
+type StatsDWriter struct {
+	conn      net.Conn
+	prefix    string
+	dogStatsD bool
+	extraTags []string
+	tags      string
+	fields    []metric.Field
+	mu        sync.Mutex
+}
+
+// NewStatsDWriter creates a writer that sends to the StatsD agent at config.Addr
+func NewStatsDWriter(config StatsDConfig, session Session, fields []metric.Field) (*StatsDWriter, error) {
+	conn, err := net.Dial("udp", config.Addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open StatsD connection: %w", err)
+	}
+
+	prefix := strings.TrimSuffix(config.Prefix, ".")
+	if prefix != "" {
+		prefix += "."
+	}
+
+	sw := &StatsDWriter{
+		conn:      conn,
+		prefix:    prefix,
+		dogStatsD: config.DogStatsD,
+		extraTags: config.Tags,
+		fields:    fields,
+	}
+	sw.setSession(session)
+	return sw, nil
+}
+
+// WriteSession tags the following values with the changed OBS setup
+func (sw *StatsDWriter) WriteSession(session Session) error {
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+	sw.setSession(session)
+	return nil
+}
+
+func (sw *StatsDWriter) setSession(session Session) {
+	if !sw.dogStatsD {
+		return
+	}
+	// Settings OBS didn't report are left out, an empty tag value would only group them under ""
+	var all []string
+	for _, a := range session.attributes() {
+		if a.value != "" {
+			all = append(all, a.key+":"+a.value)
+		}
+	}
+	all = append(all, sw.extraTags...)
+	sw.tags = "|#" + strings.Join(all, ",")
+}
+
+// WriteMetrics sends the values of a row, rows are split over several datagrams when needed
+func (sw *StatsDWriter) WriteMetrics(data MetricsData) error {
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+
+	var errs []error
+	for _, packet := range sw.packets(sw.lines(data)) {
+		if _, err := sw.conn.Write(packet); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (sw *StatsDWriter) lines(data MetricsData) []string {
+	var lines []string
+	for _, f := range sw.fields {
+		s, ok := data.Sample(f.Name)
+		if !ok {
+			continue
+		}
+		value, ok := s.Float64()
+		if !ok || math.IsNaN(value) || math.IsInf(value, 0) {
+			continue
+		}
+
+		name := sw.prefix + f.Name
+		formatted := strconv.FormatFloat(value, 'f', -1, 64)
+		switch {
+		case f.Kind == metric.Counter:
+			lines = append(lines, name+":"+formatted+"|c"+sw.tags)
+		case value < 0:
+			// A signed gauge value is applied as a change, so set it to zero first
+			lines = append(lines, name+":0|g"+sw.tags, name+":"+formatted+"|g"+sw.tags)
+		default:
+			lines = append(lines, name+":"+formatted+"|g"+sw.tags)
+		}
+	}
+
+	for _, e := range data.Errors {
+		if sw.tags != "" {
+			lines = append(lines, sw.prefix+"errors:1|c"+sw.tags+",source:"+e.Source)
+		} else {
+			lines = append(lines, sw.prefix+"errors."+e.Source+":1|c")
+		}
+	}
+	return lines
+}
+
+// packets joins lines into newline separated datagrams of at most statsdMaxPacketSize bytes
+func (sw *StatsDWriter) packets(lines []string) [][]byte {
+	var packets [][]byte
+	var current bytes.Buffer
+	for _, line := range lines {
+		if current.Len() > 0 && current.Len()+1+len(line) > statsdMaxPacketSize {
+			packets = append(packets, bytes.Clone(current.Bytes()))
+			current.Reset()
+		}
+		if current.Len() > 0 {
+			current.WriteByte('\n')
+		}
+		current.WriteString(line)
+	}
+	if current.Len() > 0 {
+		packets = append(packets, current.Bytes())
+	}
+	return packets
+}
+
+// Close closes the UDP connection
+func (sw *StatsDWriter) Close() error {
+	return sw.conn.Close()
+}
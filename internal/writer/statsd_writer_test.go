@@ -0,0 +1,130 @@
+package writer
+
+import (
+	"errors"
+	"net"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/joepadmiraal/metrics-for-obs/internal/metric"
+)
+
+func listenStatsD(t *testing.T) net.PacketConn {
+	t.Helper()
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func readDatagram(t *testing.T, conn net.PacketConn) string {
+	t.Helper()
+
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	buf := make([]byte, 65535)
+	n, _, err := conn.ReadFrom(buf)
+	if err != nil {
+		t.Fatalf("Failed to read datagram: %v", err)
+	}
+	return string(buf[:n])
+}
+
+func TestStatsDWriter_WriteMetrics_GaugesAndCounters(t *testing.T) {
+	conn := listenStatsD(t)
+
+	sw, err := NewStatsDWriter(StatsDConfig{Addr: conn.LocalAddr().String(), Prefix: "obs."}, testSession, testFields)
+	if err != nil {
+		t.Fatalf("NewStatsDWriter failed: %v", err)
+	}
+	defer sw.Close()
+
+	err = sw.WriteMetrics(newTestData(time.Now(), map[string]any{
+		"obs_rtt_ms":      4740 * time.Microsecond,
+		"stream_active":   true,
+		"output_bytes":    327347.0,
+		"obs_cpu_percent": 2.8,
+	}, metric.SourceError{Source: "google_ping", Err: errors.New("timeout")}))
+	if err != nil {
+		t.Fatalf("WriteMetrics failed: %v", err)
+	}
+
+	expected := strings.Join([]string{
+		"obs.obs_rtt_ms:4.74|g",
+		"obs.stream_active:1|g",
+		"obs.output_bytes:327347|c",
+		"obs.obs_cpu_percent:2.8|g",
+		"obs.errors.google_ping:1|c",
+	}, "\n")
+	if got := readDatagram(t, conn); got != expected {
+		t.Errorf("Expected\n%s\ngot\n%s", expected, got)
+	}
+}
+
+func TestStatsDWriter_WriteMetrics_DogStatsDTags(t *testing.T) {
+	conn := listenStatsD(t)
+
+	sw, err := NewStatsDWriter(StatsDConfig{
+		Addr:      conn.LocalAddr().String(),
+		DogStatsD: true,
+		Tags:      []string{"env:prod"},
+	}, testSession, testFields)
+	if err != nil {
+		t.Fatalf("NewStatsDWriter failed: %v", err)
+	}
+	defer sw.Close()
+
+	sw.WriteMetrics(newTestData(time.Now(), map[string]any{"obs_memory_mb": 512.0},
+		metric.SourceError{Source: "stream", Err: errors.New("disconnected")}))
+
+	tags := "obs_version:30.0.0,stream_domain:live.twitch.tv,os:" + runtime.GOOS + ",service_type:rtmp_common," +
+		"base_resolution:1920x1080,output_resolution:1280x720,fps:60,output_mode:Simple,encoder:x264,bitrate_kbps:6000,env:prod"
+	expected := "obs_memory_mb:512|g|#" + tags + "\n" +
+		"errors:1|c|#" + tags + ",source:stream"
+	if got := readDatagram(t, conn); got != expected {
+		t.Errorf("Expected\n%s\ngot\n%s", expected, got)
+	}
+
+	sw.WriteSession(Session{ObsVersion: "31.0.0", StreamDomain: "a.rtmp.youtube.com", OutputMode: "Advanced", Encoder: "jim_nvenc"})
+	sw.WriteMetrics(newTestData(time.Now(), map[string]any{"obs_memory_mb": 512.0}))
+
+	expected = "obs_memory_mb:512|g|#obs_version:31.0.0,stream_domain:a.rtmp.youtube.com,os:" + runtime.GOOS +
+		",output_mode:Advanced,encoder:jim_nvenc,env:prod"
+	if got := readDatagram(t, conn); got != expected {
+		t.Errorf("Expected the changed settings as tags\n%s\ngot\n%s", expected, got)
+	}
+}
+
+func TestStatsDWriter_Lines_NegativeGauge(t *testing.T) {
+	sw := &StatsDWriter{fields: []metric.Field{{Name: "delta", Type: metric.FloatValue, Kind: metric.Gauge}}}
+
+	lines := sw.lines(MetricsData{Samples: []metric.Sample{{Field: sw.fields[0], Value: -5.0}}})
+
+	expected := []string{"delta:0|g", "delta:-5|g"}
+	if strings.Join(lines, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("Expected %v, got %v", expected, lines)
+	}
+}
+
+func TestStatsDWriter_Packets_SplitsLargeRows(t *testing.T) {
+	sw := &StatsDWriter{}
+
+	line := strings.Repeat("a", 600) + ":1|g"
+	packets := sw.packets([]string{line, line, line})
+
+	if len(packets) != 2 {
+		t.Fatalf("Expected 2 packets, got %d", len(packets))
+	}
+	for _, p := range packets {
+		if len(p) > statsdMaxPacketSize {
+			t.Errorf("Packet of %d bytes exceeds the maximum size", len(p))
+		}
+	}
+	if string(packets[1]) != line {
+		t.Errorf("Expected the last line in its own packet, got %q", packets[1])
+	}
+}
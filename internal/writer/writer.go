@@ -0,0 +1,266 @@
+package writer
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Writer is implemented by every output the monitor sends metrics rows to
+type Writer interface {
+	WriteMetrics(data MetricsData) error
+	Close() error
+}
+
+const (
+	// writeQueueSize is the number of rows a writer can fall behind before its oldest queued row is dropped
+	writeQueueSize = 100
+	// writeTimeout is how long the registry waits for a writer before moving on, the errors of a slower
+	// write are returned with the next row
+	writeTimeout = 100 * time.Millisecond
+)
+
+// queuedWriter hands the rows and sessions to a writer from its own goroutine, so a writer that blocks
+// only delays itself
+type queuedWriter struct {
+	name    string
+	writer  Writer
+	jobs    []writeJob
+	errs    []error
+	dropped int
+	closed  bool
+	wake    chan struct{}
+	stopped chan struct{}
+	mu      sync.Mutex
+}
+
+// writeJob is a queued row or session, done is closed once the writer handled it or it was dropped
+type writeJob struct {
+	row     *MetricsData
+	session *Session
+	done    chan struct{}
+}
+
+func newQueuedWriter(name string, w Writer) *queuedWriter {
+	q := &queuedWriter{
+		name:    name,
+		writer:  w,
+		wake:    make(chan struct{}, 1),
+		stopped: make(chan struct{}),
+	}
+	go q.run()
+	return q
+}
+
+// push queues a job, a full queue drops its oldest row. Sessions are never dropped, the rows after
+// them would be written with the wrong setup.
+func (q *queuedWriter) push(job writeJob) {
+	q.mu.Lock()
+	if job.row != nil {
+		rows := 0
+		for _, j := range q.jobs {
+			if j.row != nil {
+				rows++
+			}
+		}
+		if rows >= writeQueueSize {
+			i := slices.IndexFunc(q.jobs, func(j writeJob) bool { return j.row != nil })
+			close(q.jobs[i].done)
+			q.jobs = slices.Delete(q.jobs, i, i+1)
+			q.dropped++
+		}
+	}
+	q.jobs = append(q.jobs, job)
+	q.mu.Unlock()
+
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (q *queuedWriter) run() {
+	defer close(q.stopped)
+
+	for {
+		q.mu.Lock()
+		if len(q.jobs) == 0 {
+			closed := q.closed
+			q.mu.Unlock()
+			if closed {
+				return
+			}
+			<-q.wake
+			continue
+		}
+		job := q.jobs[0]
+		q.jobs = q.jobs[1:]
+		q.mu.Unlock()
+
+		var err error
+		if job.row != nil {
+			err = safeWrite(q.writer, *job.row)
+		} else if sw, ok := q.writer.(SessionWriter); ok {
+			err = sw.WriteSession(*job.session)
+		}
+
+		q.mu.Lock()
+		if err != nil {
+			q.errs = append(q.errs, err)
+		}
+		q.mu.Unlock()
+		close(job.done)
+	}
+}
+
+// takeErrors returns the errors of the writes that finished since the last call, and the rows dropped
+func (q *queuedWriter) takeErrors() []error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	var errs []error
+	if q.dropped > 0 {
+		errs = append(errs, fmt.Errorf("%s: falling behind, dropped %d rows", q.name, q.dropped))
+		q.dropped = 0
+	}
+	for _, err := range q.errs {
+		errs = append(errs, fmt.Errorf("%s: %w", q.name, err))
+	}
+	q.errs = nil
+	return errs
+}
+
+// close waits until the queued jobs are written and closes the writer
+func (q *queuedWriter) close() error {
+	q.mu.Lock()
+	q.closed = true
+	q.mu.Unlock()
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+	<-q.stopped
+
+	return q.writer.Close()
+}
+
+// Registry fans each metrics row out to all registered writers. Every writer gets the rows from its
+// own goroutine and queue, so a slow or failing writer never prevents the remaining writers from
+// receiving the row.
+type Registry struct {
+	writers []*queuedWriter
+	mu      sync.Mutex
+}
+
+// NewRegistry creates an empty writer registry
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// Register adds a writer under the given name, the name is used to prefix its errors
+func (r *Registry) Register(name string, w Writer) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, qw := range r.writers {
+		if qw.name == name {
+			return fmt.Errorf("writer %q already registered", name)
+		}
+	}
+	r.writers = append(r.writers, newQueuedWriter(name, w))
+	return nil
+}
+
+// Names returns the names of all registered writers in registration order
+func (r *Registry) Names() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	names := make([]string, len(r.writers))
+	for i, qw := range r.writers {
+		names[i] = qw.name
+	}
+	return names
+}
+
+// WriteMetrics queues the row for every registered writer and joins their errors. It waits up to
+// writeTimeout for the writers to finish.
+func (r *Registry) WriteMetrics(data MetricsData) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.write(r.writers, func() writeJob {
+		return writeJob{row: &data, done: make(chan struct{})}
+	})
+}
+
+// WriteSession hands a changed OBS setup to every writer that records it and joins their errors. The
+// session is queued behind the rows already waiting for the writer.
+func (r *Registry) WriteSession(session Session) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var writers []*queuedWriter
+	for _, qw := range r.writers {
+		if _, ok := qw.writer.(SessionWriter); ok {
+			writers = append(writers, qw)
+		}
+	}
+	return r.write(writers, func() writeJob {
+		return writeJob{session: &session, done: make(chan struct{})}
+	})
+}
+
+// write queues a job for each writer and collects their errors, the caller must hold mu
+func (r *Registry) write(writers []*queuedWriter, newJob func() writeJob) error {
+	jobs := make([]writeJob, len(writers))
+	for i, qw := range writers {
+		jobs[i] = newJob()
+		qw.push(jobs[i])
+	}
+
+	timeout := time.NewTimer(writeTimeout)
+	defer timeout.Stop()
+wait:
+	for _, job := range jobs {
+		select {
+		case <-job.done:
+		case <-timeout.C:
+			break wait
+		}
+	}
+
+	var errs []error
+	for _, qw := range r.writers {
+		errs = append(errs, qw.takeErrors()...)
+	}
+	return errors.Join(errs...)
+}
+
+// Close writes the queued rows, closes every registered writer and joins their errors
+func (r *Registry) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var errs []error
+	for _, qw := range r.writers {
+		err := qw.close()
+		errs = append(errs, qw.takeErrors()...)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", qw.name, err))
+		}
+	}
+	r.writers = nil
+	return errors.Join(errs...)
+}
+
+func safeWrite(w Writer, data MetricsData) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return w.WriteMetrics(data)
+}
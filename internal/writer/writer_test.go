@@ -0,0 +1,222 @@
+package writer
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type recordingWriter struct {
+	rows     []MetricsData
+	writeErr error
+	closeErr error
+	closed   bool
+	mu       sync.Mutex
+}
+
+func (w *recordingWriter) WriteMetrics(data MetricsData) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.rows = append(w.rows, data)
+	return w.writeErr
+}
+
+func (w *recordingWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.closed = true
+	return w.closeErr
+}
+
+type sessionRecordingWriter struct {
+	recordingWriter
+	sessions []Session
+}
+
+func (w *sessionRecordingWriter) WriteSession(session Session) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.sessions = append(w.sessions, session)
+	return nil
+}
+
+// blockingWriter blocks every write until release is closed
+type blockingWriter struct {
+	release chan struct{}
+}
+
+func (w blockingWriter) WriteMetrics(data MetricsData) error {
+	<-w.release
+	return fmt.Errorf("timed out")
+}
+
+func (blockingWriter) Close() error { return nil }
+
+type panickingWriter struct{}
+
+func (panickingWriter) WriteMetrics(data MetricsData) error { panic("boom") }
+func (panickingWriter) Close() error                        { return nil }
+
+func TestRegistry_WriteMetrics_FansOutToAllWriters(t *testing.T) {
+	r := NewRegistry()
+	first := &recordingWriter{}
+	second := &recordingWriter{}
+	if err := r.Register("first", first); err != nil {
+		t.Fatalf("Register failed: %v", err)
+	}
+	if err := r.Register("second", second); err != nil {
+		t.Fatalf("Register failed: %v", err)
+	}
+
+	data := MetricsData{Timestamp: time.Date(2025, 12, 23, 10, 0, 0, 0, time.UTC)}
+	if err := r.WriteMetrics(data); err != nil {
+		t.Fatalf("WriteMetrics failed: %v", err)
+	}
+
+	if len(first.rows) != 1 || len(second.rows) != 1 {
+		t.Fatalf("Expected each writer to receive 1 row, got %d and %d", len(first.rows), len(second.rows))
+	}
+	if !first.rows[0].Timestamp.Equal(data.Timestamp) {
+		t.Error("Expected row to be passed through unchanged")
+	}
+}
+
+func TestRegistry_WriteMetrics_IsolatesFailingWriter(t *testing.T) {
+	r := NewRegistry()
+	failing := &recordingWriter{writeErr: fmt.Errorf("disk full")}
+	healthy := &recordingWriter{}
+	r.Register("failing", failing)
+	r.Register("panicking", panickingWriter{})
+	r.Register("healthy", healthy)
+
+	err := r.WriteMetrics(MetricsData{Timestamp: time.Now()})
+
+	if err == nil {
+		t.Fatal("Expected error from failing writer")
+	}
+	if !strings.Contains(err.Error(), "failing: disk full") {
+		t.Errorf("Expected error to be prefixed with writer name, got: %v", err)
+	}
+	if !strings.Contains(err.Error(), "panicking: panic: boom") {
+		t.Errorf("Expected panic to be reported as error, got: %v", err)
+	}
+	if len(healthy.rows) != 1 {
+		t.Errorf("Expected healthy writer to still receive the row, got %d rows", len(healthy.rows))
+	}
+}
+
+func TestRegistry_Register_DuplicateName(t *testing.T) {
+	r := NewRegistry()
+	if err := r.Register("csv", &recordingWriter{}); err != nil {
+		t.Fatalf("Register failed: %v", err)
+	}
+
+	if err := r.Register("csv", &recordingWriter{}); err == nil {
+		t.Error("Expected error when registering a duplicate name")
+	}
+	if names := r.Names(); len(names) != 1 || names[0] != "csv" {
+		t.Errorf("Expected names [csv], got %v", names)
+	}
+}
+
+func TestRegistry_Close_ClosesAllWriters(t *testing.T) {
+	r := NewRegistry()
+	failing := &recordingWriter{closeErr: fmt.Errorf("close failed")}
+	healthy := &recordingWriter{}
+	r.Register("failing", failing)
+	r.Register("healthy", healthy)
+
+	err := r.Close()
+
+	if err == nil || !strings.Contains(err.Error(), "failing: close failed") {
+		t.Errorf("Expected close error from failing writer, got: %v", err)
+	}
+	if !failing.closed || !healthy.closed {
+		t.Error("Expected all writers to be closed")
+	}
+	if len(r.Names()) != 0 {
+		t.Error("Expected registry to be empty after Close")
+	}
+}
+
+func TestRegistry_WriteMetrics_Empty(t *testing.T) {
+	r := NewRegistry()
+
+	if err := r.WriteMetrics(MetricsData{Timestamp: time.Now()}); err != nil {
+		t.Errorf("Expected no error for empty registry, got %v", err)
+	}
+}
+
+func TestRegistry_WriteSession_OnlySessionWriters(t *testing.T) {
+	r := NewRegistry()
+	plain := &recordingWriter{}
+	session := &sessionRecordingWriter{}
+	r.Register("plain", plain)
+	r.Register("session", session)
+
+	if err := r.WriteSession(testSession); err != nil {
+		t.Fatalf("WriteSession failed: %v", err)
+	}
+
+	if len(session.sessions) != 1 || session.sessions[0] != testSession {
+		t.Errorf("Expected the session writer to receive the session, got %v", session.sessions)
+	}
+	if len(plain.rows) != 0 {
+		t.Errorf("Expected the plain writer to be left alone, got %v", plain.rows)
+	}
+}
+
+func TestRegistry_WriteMetrics_BlockingWriterDoesNotStallOthers(t *testing.T) {
+	r := NewRegistry()
+	blocking := blockingWriter{release: make(chan struct{})}
+	healthy := &recordingWriter{}
+	r.Register("blocking", blocking)
+	r.Register("healthy", healthy)
+
+	start := time.Now()
+	if err := r.WriteMetrics(MetricsData{Timestamp: time.Now()}); err != nil {
+		t.Errorf("Expected no error while the blocking writer is still writing, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*writeTimeout {
+		t.Errorf("Expected WriteMetrics to return after the write timeout, took %v", elapsed)
+	}
+	healthy.mu.Lock()
+	rows := len(healthy.rows)
+	healthy.mu.Unlock()
+	if rows != 1 {
+		t.Errorf("Expected the healthy writer to receive the row, got %d rows", rows)
+	}
+
+	close(blocking.release)
+	err := r.WriteMetrics(MetricsData{Timestamp: time.Now()})
+	if err == nil || !strings.Contains(err.Error(), "blocking: timed out") {
+		t.Errorf("Expected the error of the slow write with the next row, got %v", err)
+	}
+	r.Close()
+}
+
+func TestQueuedWriter_Push_DropsOldestRow(t *testing.T) {
+	// Without its goroutine the writer never takes a job from the queue
+	q := &queuedWriter{name: "slow", writer: &recordingWriter{}, wake: make(chan struct{}, 1)}
+	first := writeJob{row: &MetricsData{}, done: make(chan struct{})}
+	q.push(first)
+	q.push(writeJob{session: &testSession, done: make(chan struct{})})
+	for range writeQueueSize {
+		q.push(writeJob{row: &MetricsData{}, done: make(chan struct{})})
+	}
+
+	select {
+	case <-first.done:
+	default:
+		t.Error("Expected the oldest row to be dropped")
+	}
+	if len(q.jobs) != writeQueueSize+1 || q.jobs[0].session == nil {
+		t.Errorf("Expected the session and %d rows to stay queued, got %d jobs", writeQueueSize, len(q.jobs))
+	}
+	errs := q.takeErrors()
+	if len(errs) != 1 || errs[0].Error() != "slow: falling behind, dropped 1 rows" {
+		t.Errorf("Expected the dropped row to be reported, got %v", errs)
+	}
+}
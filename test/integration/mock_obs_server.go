@@ -2,6 +2,8 @@ package integration
 
 import (
 	"encoding/json"
+	"fmt"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"strings"
@@ -25,10 +27,34 @@ type MockOBSServer struct {
 	memoryUsage      float64
 	disconnectClient bool
 	disconnectMu     sync.RWMutex
+	profile          map[string]string
+	profileMu        sync.RWMutex
+	writeMu          sync.Mutex
 }
 
 func NewMockOBSServer() *MockOBSServer {
-	mock := &MockOBSServer{
+	mock := newMockOBSServer()
+	mock.server = httptest.NewServer(http.HandlerFunc(mock.handleWebSocket))
+	return mock
+}
+
+// NewMockOBSServerAt starts the mock on a fixed address, like OBS coming up on its configured port
+func NewMockOBSServerAt(addr string) (*MockOBSServer, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	mock := newMockOBSServer()
+	mock.server = httptest.NewUnstartedServer(http.HandlerFunc(mock.handleWebSocket))
+	mock.server.Listener.Close()
+	mock.server.Listener = listener
+	mock.server.Start()
+	return mock, nil
+}
+
+func newMockOBSServer() *MockOBSServer {
+	return &MockOBSServer{
 		upgrader: websocket.Upgrader{
 			CheckOrigin: func(r *http.Request) bool { return true },
 		},
@@ -36,10 +62,12 @@ func NewMockOBSServer() *MockOBSServer {
 		outputBytes:  0,
 		cpuUsage:     10.5,
 		memoryUsage:  256.0,
+		profile: map[string]string{
+			"Output/Mode":                "Simple",
+			"SimpleOutput/StreamEncoder": "x264",
+			"SimpleOutput/VBitrate":      "6000",
+		},
 	}
-
-	mock.server = httptest.NewServer(http.HandlerFunc(mock.handleWebSocket))
-	return mock
 }
 
 func (m *MockOBSServer) URL() string {
@@ -77,6 +105,13 @@ func (m *MockOBSServer) IncrementStreamMetrics(bytes, skipped, frames float64) {
 	m.totalFrames += frames
 }
 
+// SetProfileParameter changes a setting of the current profile, like switching to another profile
+func (m *MockOBSServer) SetProfileParameter(category, name, value string) {
+	m.profileMu.Lock()
+	defer m.profileMu.Unlock()
+	m.profile[category+"/"+name] = value
+}
+
 func (m *MockOBSServer) DisconnectClients() {
 	m.disconnectMu.Lock()
 	m.disconnectClient = true
@@ -90,6 +125,19 @@ func (m *MockOBSServer) DisconnectClients() {
 	m.clients = nil
 }
 
+// AcceptClients lets clients connect again after DisconnectClients, like OBS coming back after a restart
+func (m *MockOBSServer) AcceptClients() {
+	m.disconnectMu.Lock()
+	defer m.disconnectMu.Unlock()
+	m.disconnectClient = false
+}
+
+func (m *MockOBSServer) writeJSON(conn *websocket.Conn, v interface{}) error {
+	m.writeMu.Lock()
+	defer m.writeMu.Unlock()
+	return conn.WriteJSON(v)
+}
+
 func (m *MockOBSServer) handleWebSocket(w http.ResponseWriter, r *http.Request) {
 	conn, err := m.upgrader.Upgrade(w, r, nil)
 	if err != nil {
@@ -135,7 +183,7 @@ func (m *MockOBSServer) sendHello(conn *websocket.Conn) {
 			"authentication":      map[string]interface{}{},
 		},
 	}
-	conn.WriteJSON(hello)
+	m.writeJSON(conn, hello)
 }
 
 func (m *MockOBSServer) handleRequest(conn *websocket.Conn, request map[string]interface{}) {
@@ -176,6 +224,46 @@ func (m *MockOBSServer) handleRequest(conn *websocket.Conn, request map[string]i
 		responseData = m.getStreamStatusResponse()
 	case "GetStreamServiceSettings":
 		responseData = m.getStreamServiceSettingsResponse()
+	case "GetOutputList":
+		responseData = m.getOutputListResponse()
+	case "GetOutputStatus":
+		if data, ok := d["requestData"].(map[string]interface{}); ok && data["outputName"] == "simple_stream" {
+			responseData = m.getStreamStatusResponse()
+		} else {
+			responseData = map[string]interface{}{"outputActive": false}
+		}
+	case "GetInputList":
+		responseData = map[string]interface{}{
+			"inputs": []map[string]interface{}{{"inputName": "Mic/Aux", "inputKind": "pulse_input_capture"}},
+		}
+	case "GetCurrentProgramScene":
+		responseData = map[string]interface{}{"sceneName": "Gameplay", "currentProgramSceneName": "Gameplay"}
+	case "GetSceneItemList":
+		responseData = map[string]interface{}{
+			"sceneItems": []map[string]interface{}{
+				{"sourceName": "Game Capture", "sourceType": "OBS_SOURCE_TYPE_INPUT", "sceneItemEnabled": true},
+				{"sourceName": "Webcam", "sourceType": "OBS_SOURCE_TYPE_INPUT", "sceneItemEnabled": false},
+				{"sourceName": "Overlays", "sourceType": "OBS_SOURCE_TYPE_SCENE", "isGroup": true, "sceneItemEnabled": true},
+			},
+		}
+	case "GetGroupSceneItemList":
+		responseData = map[string]interface{}{
+			"sceneItems": []map[string]interface{}{
+				{"sourceName": "Alerts", "sourceType": "OBS_SOURCE_TYPE_INPUT", "sceneItemEnabled": true},
+			},
+		}
+	case "GetVideoSettings":
+		responseData = map[string]interface{}{
+			"baseWidth": 1920.0, "baseHeight": 1080.0, "outputWidth": 1280.0, "outputHeight": 720.0,
+			"fpsNumerator": 60000.0, "fpsDenominator": 1001.0,
+		}
+	case "GetProfileParameter":
+		data, _ := d["requestData"].(map[string]interface{})
+		m.profileMu.RLock()
+		responseData = map[string]interface{}{"parameterValue": m.profile[fmt.Sprintf("%v/%v", data["parameterCategory"], data["parameterName"])]}
+		m.profileMu.RUnlock()
+	case "GetRecordStatus":
+		responseData = map[string]interface{}{"outputActive": false, "outputPaused": false, "outputBytes": 0.0}
 	}
 
 	response := map[string]interface{}{
@@ -188,7 +276,7 @@ func (m *MockOBSServer) handleRequest(conn *websocket.Conn, request map[string]i
 		},
 	}
 
-	conn.WriteJSON(response)
+	m.writeJSON(conn, response)
 }
 
 func (m *MockOBSServer) sendIdentified(conn *websocket.Conn) {
@@ -198,7 +286,7 @@ func (m *MockOBSServer) sendIdentified(conn *websocket.Conn) {
 			"negotiatedRpcVersion": 1,
 		},
 	}
-	conn.WriteJSON(response)
+	m.writeJSON(conn, response)
 }
 
 func (m *MockOBSServer) getVersionResponse() map[string]interface{} {
@@ -249,6 +337,15 @@ func (m *MockOBSServer) getStreamStatusResponse() map[string]interface{} {
 	}
 }
 
+func (m *MockOBSServer) getOutputListResponse() map[string]interface{} {
+	return map[string]interface{}{
+		"outputs": []map[string]interface{}{
+			{"outputName": "simple_stream", "outputKind": "rtmp_output", "outputActive": false},
+			{"outputName": "simple_file_output", "outputKind": "ffmpeg_muxer", "outputActive": false},
+		},
+	}
+}
+
 func (m *MockOBSServer) getStreamServiceSettingsResponse() map[string]interface{} {
 	return map[string]interface{}{
 		"streamServiceType": "rtmp_common",
@@ -268,7 +365,33 @@ func (m *MockOBSServer) SendExitStartedEvent(conn *websocket.Conn) error {
 			"eventData":   map[string]interface{}{},
 		},
 	}
-	return conn.WriteJSON(event)
+	return m.writeJSON(conn, event)
+}
+
+func (m *MockOBSServer) BroadcastExitStarted() {
+	m.clientsMu.Lock()
+	defer m.clientsMu.Unlock()
+	for _, client := range m.clients {
+		m.SendExitStartedEvent(client)
+	}
+}
+
+// BroadcastEvent sends an OBS event such as CurrentProgramSceneChanged to all connected clients
+func (m *MockOBSServer) BroadcastEvent(eventType string, intent int, data map[string]interface{}) {
+	event := map[string]interface{}{
+		"op": 5,
+		"d": map[string]interface{}{
+			"eventType":   eventType,
+			"eventIntent": intent,
+			"eventData":   data,
+		},
+	}
+
+	m.clientsMu.Lock()
+	defer m.clientsMu.Unlock()
+	for _, client := range m.clients {
+		m.writeJSON(client, event)
+	}
 }
 
 func (m *MockOBSServer) ActiveClientCount() int {
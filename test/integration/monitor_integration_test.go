@@ -2,6 +2,12 @@ package integration
 
 import (
 	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
 	"os"
 	"path/filepath"
 	"strings"
@@ -233,8 +239,7 @@ func TestMonitor_Integration_ContextCancellation(t *testing.T) {
 	mon.Close()
 }
 
-func TestMonitor_Integration_OBSDisconnection(t *testing.T) {
-	t.Skip("Skipping OBS disconnection test - requires fix in goobs client disconnect detection")
+func TestMonitor_Integration_ReconnectAfterDisconnection(t *testing.T) {
 	mockServer := NewMockOBSServer()
 	defer mockServer.Close()
 
@@ -263,16 +268,139 @@ func TestMonitor_Integration_OBSDisconnection(t *testing.T) {
 	time.Sleep(200 * time.Millisecond)
 
 	mockServer.DisconnectClients()
+	// The disconnect has to show up right away, not after the requests in flight timed out
+	if !waitForLastValue(t, csvFile, "obs_connected", "false", time.Second) {
+		t.Fatal("Monitor did not notice the disconnect in time")
+	}
+	mockServer.AcceptClients()
+	if !waitForLastValue(t, csvFile, "obs_connected", "true", 5*time.Second) {
+		t.Fatal("Monitor did not reconnect in time")
+	}
 
 	select {
 	case <-mon.Done():
-	case <-time.After(5 * time.Second):
-		t.Fatal("Monitor did not detect disconnection")
+		t.Fatal("Monitor exited instead of reconnecting")
+	default:
+	}
+
+	mon.Shutdown()
+	select {
+	case <-mon.Done():
+	case <-time.After(2 * time.Second):
+		t.Fatal("Monitor did not shut down in time")
+	}
+	mon.Close()
+
+	connected := readColumn(t, csvFile, "obs_connected")
+	if !strings.Contains(strings.Join(connected, ","), "false") {
+		t.Fatalf("Expected rows with obs_connected=false while disconnected, got %v", connected)
+	}
+	if connected[len(connected)-1] != "true" {
+		t.Errorf("Expected obs_connected=true after reconnecting, got %v", connected)
+	}
+}
+
+func TestMonitor_Integration_ReconnectAfterExitStarted(t *testing.T) {
+	mockServer := NewMockOBSServer()
+	defer mockServer.Close()
+
+	host := strings.Replace(mockServer.URL(), "ws://", "", 1)
+
+	connInfo := monitor.ObsConnectionInfo{
+		Password:       "",
+		Host:           host,
+		CSVFile:        "",
+		MetricInterval: 50,
+		WriterInterval: 100,
+	}
+
+	mon, err := monitor.NewMonitor(connInfo)
+	if err != nil {
+		t.Fatalf("Failed to create monitor: %v", err)
+	}
+
+	if err := mon.Start(); err != nil {
+		t.Fatalf("Failed to start monitor: %v", err)
+	}
+
+	time.Sleep(200 * time.Millisecond)
+	mockServer.BroadcastExitStarted()
+	time.Sleep(1500 * time.Millisecond)
+
+	select {
+	case <-mon.Done():
+		t.Fatal("Monitor exited instead of reconnecting")
+	default:
+	}
+
+	if count := mockServer.ActiveClientCount(); count < 2 {
+		t.Errorf("Expected the monitor to open a new connection, got %d connections", count)
 	}
 
+	mon.Shutdown()
+	select {
+	case <-mon.Done():
+	case <-time.After(2 * time.Second):
+		t.Fatal("Monitor did not shut down in time")
+	}
 	mon.Close()
 }
 
+// waitForLastValue polls the CSV file until the last row has value in the named column, it returns false
+// when that doesn't happen within timeout
+func waitForLastValue(t *testing.T, csvFile, column, value string, timeout time.Duration) bool {
+	t.Helper()
+
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		if values := readColumn(t, csvFile, column); values[len(values)-1] == value {
+			return true
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	return false
+}
+
+// readColumn returns all data values of the named CSV column
+func readColumn(t *testing.T, csvFile, column string) []string {
+	t.Helper()
+
+	file, err := os.Open(csvFile)
+	if err != nil {
+		t.Fatalf("Failed to open CSV file: %v", err)
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1
+	records, err := reader.ReadAll()
+	if err != nil {
+		t.Fatalf("Failed to parse CSV file: %v", err)
+	}
+	if len(records) < 3 {
+		t.Fatalf("Expected header info, column header and data rows, got %d records", len(records))
+	}
+
+	index := -1
+	for i, name := range records[1] {
+		if name == column {
+			index = i
+		}
+	}
+	if index == -1 {
+		t.Fatalf("Column %s not found in header %v", column, records[1])
+	}
+
+	var values []string
+	for _, record := range records[2:] {
+		if record[0] == "session" {
+			continue
+		}
+		values = append(values, record[index])
+	}
+	return values
+}
+
 func TestMonitor_Integration_ConcurrentMetricCollection(t *testing.T) {
 	mockServer := NewMockOBSServer()
 	defer mockServer.Close()
@@ -384,6 +512,270 @@ func TestMonitor_Integration_StreamStateChanges(t *testing.T) {
 	}
 }
 
+func TestMonitor_Integration_OutputAndSceneColumns(t *testing.T) {
+	mockServer := NewMockOBSServer()
+	defer mockServer.Close()
+	mockServer.SetStreamActive(true)
+
+	tmpDir := t.TempDir()
+	csvFile := filepath.Join(tmpDir, "test-metrics.csv")
+
+	host := strings.Replace(mockServer.URL(), "ws://", "", 1)
+
+	connInfo := monitor.ObsConnectionInfo{
+		Password:       "",
+		Host:           host,
+		CSVFile:        csvFile,
+		MetricInterval: 50,
+		WriterInterval: 100,
+	}
+
+	mon, err := monitor.NewMonitor(connInfo)
+	if err != nil {
+		t.Fatalf("Failed to create monitor: %v", err)
+	}
+
+	if err := mon.Start(); err != nil {
+		t.Fatalf("Failed to start monitor: %v", err)
+	}
+
+	time.Sleep(350 * time.Millisecond)
+
+	mon.Shutdown()
+	select {
+	case <-mon.Done():
+	case <-time.After(2 * time.Second):
+		t.Fatal("Monitor did not shut down in time")
+	}
+	mon.Close()
+
+	for column, expected := range map[string]string{
+		"output_simple_stream_active":      "true",
+		"output_simple_file_output_active": "false",
+		"record_active":                    "false",
+		"program_scene":                    "Gameplay",
+		"visible_sources":                  "Game Capture, Overlays, Alerts",
+		"visible_source_count":             "3",
+	} {
+		values := readColumn(t, csvFile, column)
+		if len(values) == 0 {
+			t.Fatalf("Expected rows with a %s column", column)
+		}
+		if last := values[len(values)-1]; last != expected {
+			t.Errorf("Expected %s to be %s, got %s", column, expected, last)
+		}
+	}
+}
+
+func TestMonitor_Integration_EventRecorder(t *testing.T) {
+	mockServer := NewMockOBSServer()
+	defer mockServer.Close()
+
+	tmpDir := t.TempDir()
+	csvFile := filepath.Join(tmpDir, "test-metrics.csv")
+	eventsFile := filepath.Join(tmpDir, "events.jsonl")
+
+	host := strings.Replace(mockServer.URL(), "ws://", "", 1)
+
+	connInfo := monitor.ObsConnectionInfo{
+		Password:       "",
+		Host:           host,
+		CSVFile:        csvFile,
+		EventsFile:     eventsFile,
+		MetricInterval: 50,
+		WriterInterval: 100,
+	}
+
+	mon, err := monitor.NewMonitor(connInfo)
+	if err != nil {
+		t.Fatalf("Failed to create monitor: %v", err)
+	}
+
+	if err := mon.Start(); err != nil {
+		t.Fatalf("Failed to start monitor: %v", err)
+	}
+
+	time.Sleep(150 * time.Millisecond)
+	mockServer.BroadcastEvent("CurrentProgramSceneChanged", 4, map[string]interface{}{"sceneName": "Gameplay"})
+	time.Sleep(250 * time.Millisecond)
+
+	mon.Shutdown()
+	select {
+	case <-mon.Done():
+	case <-time.After(2 * time.Second):
+		t.Fatal("Monitor did not shut down in time")
+	}
+	mon.Close()
+
+	var annotated int
+	for _, value := range readColumn(t, csvFile, "events") {
+		if value != "" {
+			annotated++
+			if value != "CurrentProgramSceneChanged: Gameplay" {
+				t.Errorf("Unexpected events value %q", value)
+			}
+		}
+	}
+	if annotated != 1 {
+		t.Errorf("Expected exactly one row with the scene switch, got %d", annotated)
+	}
+
+	data, err := os.ReadFile(eventsFile)
+	if err != nil {
+		t.Fatalf("Failed to read events log: %v", err)
+	}
+	var event map[string]any
+	if err := json.Unmarshal(data, &event); err != nil {
+		t.Fatalf("Expected a single JSON event, got %s: %v", data, err)
+	}
+	if event["type"] != "CurrentProgramSceneChanged" || event["detail"] != "Gameplay" {
+		t.Errorf("Unexpected event %v", event)
+	}
+	if _, err := time.Parse(time.RFC3339Nano, fmt.Sprint(event["timestamp"])); err != nil {
+		t.Errorf("Expected an RFC 3339 timestamp, got %v", event["timestamp"])
+	}
+}
+
+func TestMonitor_Integration_SessionSettings(t *testing.T) {
+	mockServer := NewMockOBSServer()
+	defer mockServer.Close()
+
+	tmpDir := t.TempDir()
+	csvFile := filepath.Join(tmpDir, "test-metrics.csv")
+	jsonlFile := filepath.Join(tmpDir, "test-metrics.jsonl")
+
+	connInfo := monitor.ObsConnectionInfo{
+		Password:       "",
+		Host:           strings.Replace(mockServer.URL(), "ws://", "", 1),
+		CSVFile:        csvFile,
+		JSONLFile:      jsonlFile,
+		MetricInterval: 50,
+		WriterInterval: 100,
+	}
+
+	mon, err := monitor.NewMonitor(connInfo)
+	if err != nil {
+		t.Fatalf("Failed to create monitor: %v", err)
+	}
+
+	if err := mon.Start(); err != nil {
+		t.Fatalf("Failed to start monitor: %v", err)
+	}
+
+	time.Sleep(150 * time.Millisecond)
+	mockServer.SetProfileParameter("Output", "Mode", "Advanced")
+	mockServer.SetProfileParameter("AdvOut", "Encoder", "jim_nvenc")
+	mockServer.BroadcastEvent("CurrentProfileChanged", 2, map[string]interface{}{"profileName": "Advanced"})
+	time.Sleep(250 * time.Millisecond)
+
+	mon.Shutdown()
+	<-mon.Done()
+	mon.Close()
+
+	content, err := os.ReadFile(csvFile)
+	if err != nil {
+		t.Fatalf("Failed to read CSV file: %v", err)
+	}
+	info := strings.SplitN(string(content), "\n", 2)[0]
+	for _, expected := range []string{"Service type: rtmp_common", "Base resolution: 1920x1080", "Output resolution: 1280x720",
+		"FPS: 59.94", "Output mode: Simple", "Encoder: x264", "Bitrate (kbps): 6000"} {
+		if !strings.Contains(info, expected) {
+			t.Errorf("Expected the CSV info line to contain %q, got %s", expected, info)
+		}
+	}
+	var changed string
+	for _, line := range strings.Split(string(content), "\n") {
+		if strings.HasPrefix(line, "session,") {
+			changed = line
+		}
+	}
+	if !strings.Contains(changed, "Output mode: Advanced") || !strings.Contains(changed, "Encoder: jim_nvenc") {
+		t.Errorf("Expected a CSV session line with the changed settings, got %q", changed)
+	}
+
+	content, err = os.ReadFile(jsonlFile)
+	if err != nil {
+		t.Fatalf("Failed to read JSONL file: %v", err)
+	}
+	var sessions []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(string(content)), "\n") {
+		var row map[string]any
+		if err := json.Unmarshal([]byte(line), &row); err != nil {
+			t.Fatalf("Line is not valid JSON: %v", err)
+		}
+		if session, ok := row["session"].(map[string]any); ok {
+			sessions = append(sessions, session)
+		}
+	}
+	if len(sessions) != 2 {
+		t.Fatalf("Expected the initial and the changed session, got %v", sessions)
+	}
+	if sessions[0]["encoder"] != "x264" || sessions[0]["bitrate_kbps"] != "6000" {
+		t.Errorf("Unexpected initial session %v", sessions[0])
+	}
+	if sessions[1]["output_mode"] != "Advanced" || sessions[1]["encoder"] != "jim_nvenc" || sessions[1]["bitrate_kbps"] != nil {
+		t.Errorf("Unexpected session after the profile change %v", sessions[1])
+	}
+}
+
+func TestMonitor_Integration_AudioLevels(t *testing.T) {
+	mockServer := NewMockOBSServer()
+	defer mockServer.Close()
+
+	csvFile := filepath.Join(t.TempDir(), "test-metrics.csv")
+
+	host := strings.Replace(mockServer.URL(), "ws://", "", 1)
+
+	connInfo := monitor.ObsConnectionInfo{
+		Password:       "",
+		Host:           host,
+		CSVFile:        csvFile,
+		MetricInterval: 50,
+		WriterInterval: 100,
+	}
+
+	mon, err := monitor.NewMonitor(connInfo)
+	if err != nil {
+		t.Fatalf("Failed to create monitor: %v", err)
+	}
+
+	if err := mon.Start(); err != nil {
+		t.Fatalf("Failed to start monitor: %v", err)
+	}
+
+	// InputVolumeMeters is a high-volume event, intent 1 << 16
+	for i := 0; i < 8; i++ {
+		mockServer.BroadcastEvent("InputVolumeMeters", 1<<16, map[string]interface{}{
+			"inputs": []map[string]interface{}{
+				{"inputName": "Mic/Aux", "inputLevelsMul": [][]float64{{0.1, 0.1, 0.1}, {0.05, 0.05, 0.05}}},
+			},
+		})
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	mon.Shutdown()
+	select {
+	case <-mon.Done():
+	case <-time.After(2 * time.Second):
+		t.Fatal("Monitor did not shut down in time")
+	}
+	mon.Close()
+
+	var measured int
+	for _, value := range readColumn(t, csvFile, "audio_mic_aux_peak_dbfs") {
+		if value == "" {
+			continue
+		}
+		measured++
+		if value != "-20.0" {
+			t.Errorf("Expected a peak of -20.0 dBFS, got %s", value)
+		}
+	}
+	if measured == 0 {
+		t.Error("Expected rows with audio levels")
+	}
+}
+
 func TestMonitor_Integration_NoCSVWriter(t *testing.T) {
 	mockServer := NewMockOBSServer()
 	defer mockServer.Close()
@@ -418,6 +810,122 @@ func TestMonitor_Integration_NoCSVWriter(t *testing.T) {
 	mon.Close()
 }
 
+func TestMonitor_Integration_JSONLWriter(t *testing.T) {
+	mockServer := NewMockOBSServer()
+	defer mockServer.Close()
+
+	jsonlFile := filepath.Join(t.TempDir(), "test-metrics.jsonl")
+
+	connInfo := monitor.ObsConnectionInfo{
+		Password:       "",
+		Host:           strings.Replace(mockServer.URL(), "ws://", "", 1),
+		CSVFile:        "",
+		JSONLFile:      jsonlFile,
+		MetricInterval: 50,
+		WriterInterval: 100,
+	}
+
+	mon, err := monitor.NewMonitor(connInfo)
+	if err != nil {
+		t.Fatalf("Failed to create monitor: %v", err)
+	}
+
+	if err := mon.Start(); err != nil {
+		t.Fatalf("Failed to start monitor: %v", err)
+	}
+
+	time.Sleep(300 * time.Millisecond)
+
+	mon.Shutdown()
+	<-mon.Done()
+	mon.Close()
+
+	content, err := os.ReadFile(jsonlFile)
+	if err != nil {
+		t.Fatalf("Failed to read JSONL file: %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(string(content)), "\n")
+	if len(lines) < 2 {
+		t.Fatalf("Expected at least 2 rows, got %d", len(lines))
+	}
+
+	var row map[string]any
+	if err := json.Unmarshal([]byte(lines[len(lines)-1]), &row); err != nil {
+		t.Fatalf("Row is not valid JSON: %v", err)
+	}
+	if row["obs_cpu_percent"] != 10.5 {
+		t.Errorf("Expected obs_cpu_percent to be 10.5, got %v", row["obs_cpu_percent"])
+	}
+	if row["obs_connected"] != true {
+		t.Errorf("Expected obs_connected to be true, got %v", row["obs_connected"])
+	}
+	if ms, ok := row["window_ms"].(float64); !ok || ms < 50 || ms > 500 {
+		t.Errorf("Expected window_ms to be close to the writer interval, got %v", row["window_ms"])
+	}
+	if row["window_start"] == nil || row["window_end"] == nil {
+		t.Errorf("Expected the window start and end, got %v and %v", row["window_start"], row["window_end"])
+	}
+}
+
+func TestMonitor_Integration_PrometheusEndpoint(t *testing.T) {
+	mockServer := NewMockOBSServer()
+	defer mockServer.Close()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to reserve port: %v", err)
+	}
+	promAddr := listener.Addr().String()
+	listener.Close()
+
+	connInfo := monitor.ObsConnectionInfo{
+		Password:       "",
+		Host:           strings.Replace(mockServer.URL(), "ws://", "", 1),
+		CSVFile:        "",
+		PrometheusAddr: promAddr,
+		MetricInterval: 50,
+		WriterInterval: 100,
+	}
+
+	mon, err := monitor.NewMonitor(connInfo)
+	if err != nil {
+		t.Fatalf("Failed to create monitor: %v", err)
+	}
+
+	if err := mon.Start(); err != nil {
+		t.Fatalf("Failed to start monitor: %v", err)
+	}
+
+	time.Sleep(300 * time.Millisecond)
+
+	resp, err := http.Get("http://" + promAddr + "/metrics")
+	if err != nil {
+		t.Fatalf("Scrape failed: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	expected := []string{
+		`obs_cpu_percent{obs_version="30.0.0",stream_domain="test-ingest.example.com"} 10.5`,
+		`obs_connected{obs_version="30.0.0",stream_domain="test-ingest.example.com"} 1`,
+		"# TYPE output_bytes_total counter",
+	}
+	for _, e := range expected {
+		if !strings.Contains(string(body), e) {
+			t.Errorf("Expected scrape to contain %q, got:\n%s", e, body)
+		}
+	}
+
+	mon.Shutdown()
+	<-mon.Done()
+	mon.Close()
+
+	if _, err := http.Get("http://" + promAddr + "/metrics"); err == nil {
+		t.Error("Expected the endpoint to be stopped after Close")
+	}
+}
+
 func TestMonitor_Integration_ConnectionFailure(t *testing.T) {
 	connInfo := monitor.ObsConnectionInfo{
 		Password:       "",
@@ -439,6 +947,98 @@ func TestMonitor_Integration_ConnectionFailure(t *testing.T) {
 	}
 }
 
+func TestMonitor_Integration_WaitForObs(t *testing.T) {
+	// Reserve a free port that OBS will listen on later
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to reserve port: %v", err)
+	}
+	addr := listener.Addr().String()
+	listener.Close()
+
+	connInfo := monitor.ObsConnectionInfo{
+		Password:       "",
+		Host:           addr,
+		CSVFile:        "",
+		MetricInterval: 50,
+		WriterInterval: 100,
+		Wait:           true,
+		WaitTimeout:    10,
+	}
+
+	mon, err := monitor.NewMonitor(connInfo)
+	if err != nil {
+		t.Fatalf("Failed to create monitor: %v", err)
+	}
+
+	startErr := make(chan error, 1)
+	go func() {
+		startErr <- mon.Start()
+	}()
+
+	time.Sleep(500 * time.Millisecond)
+	select {
+	case err := <-startErr:
+		t.Fatalf("Expected Start to wait for OBS, returned %v", err)
+	default:
+	}
+
+	mockServer, err := NewMockOBSServerAt(addr)
+	if err != nil {
+		t.Fatalf("Failed to start mock server: %v", err)
+	}
+	defer mockServer.Close()
+
+	select {
+	case err := <-startErr:
+		if err != nil {
+			t.Fatalf("Expected Start to succeed once OBS is up, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Start did not return after OBS came up")
+	}
+
+	mon.Shutdown()
+	select {
+	case <-mon.Done():
+	case <-time.After(2 * time.Second):
+		t.Fatal("Monitor did not shut down in time")
+	}
+	mon.Close()
+}
+
+func TestMonitor_Integration_WaitTimeout(t *testing.T) {
+	connInfo := monitor.ObsConnectionInfo{
+		Password:       "",
+		Host:           "localhost:9999",
+		CSVFile:        "",
+		MetricInterval: 50,
+		WriterInterval: 100,
+		Wait:           true,
+		WaitTimeout:    1,
+	}
+
+	mon, err := monitor.NewMonitor(connInfo)
+	if err != nil {
+		t.Fatalf("Failed to create monitor: %v", err)
+	}
+
+	start := time.Now()
+	err = mon.Start()
+	elapsed := time.Since(start)
+
+	if err == nil {
+		mon.Close()
+		t.Fatal("Expected error when OBS does not come up, got nil")
+	}
+	if !strings.Contains(err.Error(), "OBS not available after 1s") {
+		t.Errorf("Expected timeout error, got %v", err)
+	}
+	if elapsed < time.Second || elapsed > 5*time.Second {
+		t.Errorf("Expected Start to give up after about 1s, took %v", elapsed)
+	}
+}
+
 func TestMonitor_Integration_FullMonitoringCycle(t *testing.T) {
 	mockServer := NewMockOBSServer()
 	defer mockServer.Close()